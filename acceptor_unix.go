@@ -29,8 +29,20 @@ import (
 )
 
 func (el *eventloop) accept0(fd int, _ netpoll.IOEvent, _ netpoll.IOFlags) error {
+	if el.listeners[fd].throttle != nil {
+		return nil // a stale event of the throttled listener
+	}
 	for {
+		if d := el.engine.takeAcceptToken(); d > 0 {
+			// Leave the rest of connections in the Accept queue until the rate allows.
+			el.throttleListener(el.listeners[fd], d)
+			return nil
+		}
+
 		nfd, sa, err := socket.Accept(fd)
+		if err != nil {
+			el.engine.putAcceptToken()
+		}
 		switch err {
 		case nil:
 		case unix.EAGAIN: // the Accept queue has been drained out, we can return now
@@ -45,16 +57,35 @@ func (el *eventloop) accept0(fd int, _ netpoll.IOEvent, _ netpoll.IOFlags) error
 			return errors.ErrAcceptSocket
 		}
 
+		ln := el.listeners[fd]
 		remoteAddr := socket.SockaddrToTCPOrUnixAddr(sa)
-		if el.engine.opts.TCPKeepAlive > 0 && el.listeners[fd].network == "tcp" {
+		if !el.engine.permits(sa) {
+			el.engine.deny(nfd, remoteAddr)
+			continue
+		}
+		if el.engine.opts.TCPKeepAlive > 0 && ln.network == "tcp" {
 			err = socket.SetKeepAlivePeriod(nfd, int(el.engine.opts.TCPKeepAlive.Seconds()))
 			if err != nil {
 				el.getLogger().Errorf("failed to set TCP keepalive on fd=%d: %v", fd, err)
 			}
 		}
 
-		el := el.engine.eventLoops.next(remoteAddr)
-		c := newTCPConn(nfd, el, sa, el.listeners[fd].addr, remoteAddr)
+		target, source, admitted, err := el.engine.admit(el.engine.eventLoops.next(remoteAddr), sa)
+		if err != nil {
+			el.engine.reject(nfd, remoteAddr, err)
+			continue
+		}
+		el := target
+		c := newTCPConn(nfd, el, sa, ln.addr, remoteAddr)
+		c.admitted, c.source = admitted, source
+		c.proxyPending = ln.proxyProtocol
+		if newTransform := el.engine.opts.StreamTransform; newTransform != nil {
+			c.transform = newTransform()
+			c.transformPending = true
+		}
+		if cfg := el.engine.tlsConfig.Load(); cfg != nil {
+			c.tls = newTLSSession(c, cfg, false)
+		}
 		err = el.poller.Trigger(queue.HighPriority, el.register, c)
 		if err != nil {
 			el.getLogger().Errorf("failed to enqueue the accepted socket fd=%d to poller: %v", c.fd, err)
@@ -68,8 +99,20 @@ func (el *eventloop) accept(fd int, ev netpoll.IOEvent, flags netpoll.IOFlags) e
 	if el.listeners[fd].network == "udp" {
 		return el.readUDP(fd, ev, flags)
 	}
+	if el.listeners[fd].throttle != nil {
+		return nil // a stale event of the throttled listener
+	}
+
+	if d := el.engine.takeAcceptToken(); d > 0 {
+		// Leave the rest of connections in the Accept queue until the rate allows.
+		el.throttleListener(el.listeners[fd], d)
+		return nil
+	}
 
 	nfd, sa, err := socket.Accept(fd)
+	if err != nil {
+		el.engine.putAcceptToken()
+	}
 	switch err {
 	case nil:
 	case unix.EINTR, unix.EAGAIN, unix.ECONNRESET, unix.ECONNABORTED:
@@ -83,6 +126,10 @@ func (el *eventloop) accept(fd int, ev netpoll.IOEvent, flags netpoll.IOFlags) e
 	}
 
 	remoteAddr := socket.SockaddrToTCPOrUnixAddr(sa)
+	if !el.engine.permits(sa) {
+		el.engine.deny(nfd, remoteAddr)
+		return nil
+	}
 	if el.engine.opts.TCPKeepAlive > 0 && el.listeners[fd].network == "tcp" {
 		err = socket.SetKeepAlivePeriod(nfd, int(el.engine.opts.TCPKeepAlive/time.Second))
 		if err != nil {
@@ -90,6 +137,31 @@ func (el *eventloop) accept(fd int, ev netpoll.IOEvent, flags netpoll.IOFlags) e
 		}
 	}
 
-	c := newTCPConn(nfd, el, sa, el.listeners[fd].addr, remoteAddr)
+	ln := el.listeners[fd]
+	target, source, admitted, err := el.engine.admit(el, sa)
+	if err != nil {
+		el.engine.reject(nfd, remoteAddr, err)
+		return nil
+	}
+	c := newTCPConn(nfd, target, sa, ln.addr, remoteAddr)
+	c.admitted, c.source = admitted, source
+	c.proxyPending = ln.proxyProtocol
+	if newTransform := el.engine.opts.StreamTransform; newTransform != nil {
+		c.transform = newTransform()
+		c.transformPending = true
+	}
+	if cfg := el.engine.tlsConfig.Load(); cfg != nil {
+		c.tls = newTLSSession(c, cfg, false)
+	}
+	if target != el {
+		// This event-loop has reached Options.MaxConnsPerLoop, hand the connection over to the spare one.
+		err = target.poller.Trigger(queue.HighPriority, target.register, c)
+		if err != nil {
+			el.getLogger().Errorf("failed to enqueue the accepted socket fd=%d to poller: %v", c.fd, err)
+			_ = unix.Close(nfd)
+			c.release()
+		}
+		return nil
+	}
 	return el.register0(c)
 }
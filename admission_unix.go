@@ -0,0 +1,302 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/panjf2000/gnet/v2/internal/queue"
+	"github.com/panjf2000/gnet/v2/internal/ratelimit"
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// sourceBucketsSweepInterval is how often the token buckets of the sources
+// that have been refilled up are dropped to keep the memory bounded.
+const sourceBucketsSweepInterval = 10 * time.Second
+
+// admission keeps count of the accepted connections against the connection limits
+// and the accept rates in Options.
+type admission struct {
+	limiter    *ratelimit.Limiter // token bucket for Options.AcceptRate, which is taken without mu
+	throttled  atomic.Uint64      // AdmissionStats.AcceptThrottled, which is counted without mu
+	handshakes atomic.Int32       // AdmissionStats.TLSHandshakes, which is counted without mu
+
+	mu            sync.Mutex
+	conns         int                                // number of admitted connections
+	loops         map[int]int                        // number of admitted connections per event-loop
+	sources       map[netip.Prefix]int               // number of admitted connections per source
+	sourceBuckets map[netip.Prefix]*ratelimit.Bucket // token buckets for Options.AcceptRatePerSource
+	lastSweep     time.Time                          // the last time when sourceBuckets were swept
+	stats         AdmissionStats
+}
+
+// limitsConns reports whether any of the connection limits or the accept rate per source is set.
+func (opts *Options) limitsConns() bool {
+	return opts.MaxConns > 0 || opts.MaxConnsPerLoop > 0 || opts.MaxConnsPerSource > 0 ||
+		opts.AcceptRatePerSource > 0
+}
+
+// sourceOf returns the source of the connection from sa by which MaxConnsPerSource is applied,
+// the returned prefix is invalid if sa is not an IP address.
+func (opts *Options) sourceOf(sa unix.Sockaddr) (source netip.Prefix) {
+	addr, ok := sockaddrToAddr(sa)
+	if !ok {
+		return
+	}
+
+	bits := opts.SourcePrefixLenV6
+	if addr.Is4() {
+		bits = opts.SourcePrefixLenV4
+	}
+	if bits <= 0 || bits > addr.BitLen() {
+		bits = addr.BitLen()
+	}
+	source, _ = addr.Prefix(bits)
+	return
+}
+
+// admit counts the connection accepted from sa for el against the connection limits before
+// the connection is created, an error is returned without counting it if any of the limits
+// has been reached. If el has reached MaxConnsPerLoop, the connection is counted for the
+// event-loop with the fewest connections among the others that haven't, which is returned
+// as target for the connection to be registered with. admitted reports whether it's counted,
+// which is handed over to the connection along with source, so that it's released along
+// with the connection.
+func (eng *engine) admit(el *eventloop, sa unix.Sockaddr) (target *eventloop, source netip.Prefix, admitted bool, err error) {
+	opts := eng.opts
+	if !opts.limitsConns() {
+		return el, netip.Prefix{}, false, nil
+	}
+
+	if opts.MaxConnsPerSource > 0 || opts.AcceptRatePerSource > 0 {
+		source = opts.sourceOf(sa)
+	}
+
+	a := &eng.admission
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if opts.MaxConns > 0 && a.conns >= opts.MaxConns {
+		a.stats.RejectedByMaxConns++
+		return nil, netip.Prefix{}, false, errorx.ErrTooManyConns
+	}
+	if opts.MaxConnsPerLoop > 0 && a.loops[el.idx] >= opts.MaxConnsPerLoop {
+		if el = a.spareLoop(eng, opts.MaxConnsPerLoop); el == nil {
+			a.stats.RejectedByMaxConnsPerLoop++
+			return nil, netip.Prefix{}, false, errorx.ErrTooManyConnsOnLoop
+		}
+	}
+	if opts.MaxConnsPerSource > 0 && source.IsValid() && a.sources[source] >= opts.MaxConnsPerSource {
+		a.stats.RejectedByMaxConnsPerSource++
+		return nil, netip.Prefix{}, false, errorx.ErrTooManyConnsFromSource
+	}
+	if opts.AcceptRatePerSource > 0 && source.IsValid() && !a.takeSourceToken(opts, source) {
+		a.stats.RejectedByAcceptRatePerSource++
+		return nil, netip.Prefix{}, false, errorx.ErrAcceptRateExceeded
+	}
+	if opts.MaxConnsPerSource <= 0 {
+		source = netip.Prefix{}
+	}
+
+	a.conns++
+	if a.loops == nil {
+		a.loops = make(map[int]int)
+	}
+	a.loops[el.idx]++
+	if source.IsValid() {
+		if a.sources == nil {
+			a.sources = make(map[netip.Prefix]int)
+		}
+		a.sources[source]++
+	}
+	return el, source, true, nil
+}
+
+// spareLoop returns the event-loop with the fewest admitted connections among the ones
+// that haven't reached maxConns, or nil if all of them have.
+func (a *admission) spareLoop(eng *engine, maxConns int) (spare *eventloop) {
+	fewest := maxConns
+	eng.eventLoops.iterate(func(i int, el *eventloop) bool {
+		if n := a.loops[el.idx]; n < fewest {
+			spare, fewest = el, n
+		}
+		return fewest > 0
+	})
+	return
+}
+
+// takeSourceToken takes a token from the bucket of source for Options.AcceptRatePerSource.
+func (a *admission) takeSourceToken(opts *Options, source netip.Prefix) bool {
+	now := time.Now()
+	if now.Sub(a.lastSweep) >= sourceBucketsSweepInterval {
+		for src, b := range a.sourceBuckets {
+			if b.Full(now) {
+				delete(a.sourceBuckets, src)
+			}
+		}
+		a.lastSweep = now
+	}
+
+	b, ok := a.sourceBuckets[source]
+	if !ok {
+		if a.sourceBuckets == nil {
+			a.sourceBuckets = make(map[netip.Prefix]*ratelimit.Bucket)
+		}
+		b = ratelimit.New(opts.AcceptRatePerSource, opts.AcceptBurstPerSource, now)
+		a.sourceBuckets[source] = b
+	}
+	return b.Take(now) == 0
+}
+
+// takeAcceptToken takes a token for accepting a connection under Options.AcceptRate,
+// it returns how long to wait before accepting again if the rate has been exceeded.
+func (eng *engine) takeAcceptToken() time.Duration {
+	a := &eng.admission
+	if a.limiter == nil {
+		return 0
+	}
+
+	d := a.limiter.Take(time.Now())
+	if d > 0 {
+		a.throttled.Add(1)
+	}
+	return d
+}
+
+// putAcceptToken returns the token taken by takeAcceptToken when no connection is accepted.
+func (eng *engine) putAcceptToken() {
+	if a := &eng.admission; a.limiter != nil {
+		a.limiter.Put()
+	}
+}
+
+// throttleListener stops watching ln for d after Options.AcceptRate has been exceeded.
+func (el *eventloop) throttleListener(ln *listener, d time.Duration) {
+	if ln.throttle != nil {
+		return // it will be watched again by the pending timer
+	}
+	if err := el.unwatchListener(ln); err != nil {
+		el.getLogger().Errorf("failed to throttle listener(%s): %v", ln.key(), err)
+		return
+	}
+	ln.throttle = time.AfterFunc(d, func() {
+		err := el.poller.Trigger(queue.HighPriority, el.unthrottleListener, ln)
+		if err != nil && el.engine.workerPool.shutdownCtx.Err() == nil {
+			el.getLogger().Errorf("failed to enqueue the task of unthrottling listener(%s): %v", ln.key(), err)
+		}
+	})
+}
+
+// unthrottleListener watches the listener throttled by throttleListener again.
+func (el *eventloop) unthrottleListener(a any) error {
+	ln := a.(*listener)
+	if ln.throttle == nil || el.listeners[ln.fd] != ln {
+		return nil // the listener has been removed
+	}
+	ln.throttle = nil
+	// The listeners of the ingress event-loop are edge-triggered.
+	if err := el.poller.AddRead(ln.pollAttachment, el == el.engine.ingress); err != nil {
+		el.getLogger().Errorf("failed to unthrottle listener(%s): %v", ln.key(), err)
+	}
+	return nil
+}
+
+// release stops counting c against the connection limits.
+func (eng *engine) release(c *conn) {
+	if !c.admitted {
+		return
+	}
+	c.admitted = false
+
+	a := &eng.admission
+	a.mu.Lock()
+	a.conns--
+	if a.loops[c.loop.idx]--; a.loops[c.loop.idx] <= 0 {
+		delete(a.loops, c.loop.idx)
+	}
+	if c.source.IsValid() {
+		if a.sources[c.source]--; a.sources[c.source] <= 0 {
+			delete(a.sources, c.source)
+		}
+	}
+	a.mu.Unlock()
+}
+
+// reject writes Options.RejectPayload to the socket fd accepted from remoteAddr which has been
+// rejected with err, and closes it.
+func (eng *engine) reject(fd int, remoteAddr net.Addr, err error) {
+	if len(eng.opts.RejectPayload) > 0 {
+		// The send buffer of a new socket is empty, so it must be able to hold a
+		// short payload, the payload is discarded if it can't be sent all at once.
+		_, _ = unix.Write(fd, eng.opts.RejectPayload)
+	}
+	eng.rejectFd(fd, remoteAddr, err)
+}
+
+// rejectFd closes the socket fd accepted from remoteAddr which has been rejected with err.
+func (eng *engine) rejectFd(fd int, remoteAddr net.Addr, err error) {
+	_ = unix.Close(fd)
+	eng.onReject(remoteAddr, err)
+}
+
+// onReject reports the connection from remoteAddr which has been rejected with err.
+func (eng *engine) onReject(remoteAddr net.Addr, err error) {
+	eng.opts.Logger.Debugf("rejected connection from %v: %v", remoteAddr, err)
+	if h, ok := eng.eventHandler.(RejectHandler); ok {
+		h.OnReject(remoteAddr, err)
+	}
+}
+
+// deny closes the socket fd accepted from remoteAddr which is denied by the IP filter.
+func (eng *engine) deny(fd int, remoteAddr net.Addr) {
+	a := &eng.admission
+	a.mu.Lock()
+	a.stats.RejectedByIPFilter++
+	a.mu.Unlock()
+	eng.rejectFd(fd, remoteAddr, errorx.ErrAddressDenied)
+}
+
+// dropPacket counts a UDP packet that is dropped by the IP filter.
+func (eng *engine) dropPacket() {
+	a := &eng.admission
+	a.mu.Lock()
+	a.stats.DroppedByIPFilter++
+	a.mu.Unlock()
+}
+
+// AdmissionStats returns the statistics of the connection limits, accept rates and IP filter of this Engine.
+func (e Engine) AdmissionStats() (stats AdmissionStats) {
+	if e.Validate() != nil {
+		return
+	}
+
+	a := &e.eng.admission
+	a.mu.Lock()
+	stats = a.stats
+	stats.Conns = a.conns
+	a.mu.Unlock()
+	stats.AcceptThrottled = a.throttled.Load()
+	stats.TLSHandshakes = int(a.handshakes.Load())
+	return
+}
@@ -0,0 +1,199 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+func TestAdmitSpareLoop(t *testing.T) {
+	eng := &engine{opts: &Options{MaxConnsPerLoop: 2}, eventLoops: new(roundRobinLoadBalancer)}
+	els := make([]*eventloop, 3)
+	for i := range els {
+		els[i] = &eventloop{engine: eng}
+		eng.eventLoops.register(els[i])
+	}
+	sa := &unix.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}
+
+	// The connections assigned to a full event-loop go to the one with the fewest connections.
+	counts := make(map[*eventloop]int)
+	for i := 0; i < 6; i++ {
+		el, _, admitted, err := eng.admit(els[0], sa)
+		require.NoError(t, err)
+		assert.True(t, admitted)
+		counts[el]++
+		if i == 2 {
+			assert.Equal(t, els[1], el, "the spare event-loop with the fewest connections")
+		}
+	}
+	for _, el := range els {
+		assert.Equal(t, 2, counts[el])
+	}
+
+	// All event-loops have been full.
+	el, _, admitted, err := eng.admit(els[2], sa)
+	assert.ErrorIs(t, err, errorx.ErrTooManyConnsOnLoop)
+	assert.Nil(t, el)
+	assert.False(t, admitted)
+	stats := eng.admission.stats
+	assert.EqualValues(t, 1, stats.RejectedByMaxConnsPerLoop)
+	assert.Equal(t, 6, eng.admission.conns)
+
+	// Releasing a connection makes room on its event-loop.
+	eng.release(&conn{loop: els[2], admitted: true})
+	el, _, _, err = eng.admit(els[0], sa)
+	require.NoError(t, err)
+	assert.Equal(t, els[2], el)
+}
+
+func TestConnLimits(t *testing.T) {
+	t.Run("max-conns", func(t *testing.T) {
+		testConnLimits(t, errorx.ErrTooManyConns, WithMaxConns(2))
+	})
+	t.Run("max-conns-per-loop", func(t *testing.T) {
+		testConnLimits(t, errorx.ErrTooManyConnsOnLoop, WithNumEventLoop(1), WithMaxConnsPerLoop(2))
+	})
+	t.Run("max-conns-per-loop-spare-loop", func(t *testing.T) {
+		testConnLimits(t, errorx.ErrTooManyConnsOnLoop, WithNumEventLoop(2), WithMaxConnsPerLoop(1),
+			WithLoadBalancing(SourceAddrHash))
+	})
+	t.Run("max-conns-per-source", func(t *testing.T) {
+		testConnLimits(t, errorx.ErrTooManyConnsFromSource, WithMaxConnsPerSource(2, 24, 0))
+	})
+	t.Run("reuseport", func(t *testing.T) {
+		testConnLimits(t, errorx.ErrTooManyConns, WithReusePort(true), WithMaxConns(2))
+	})
+}
+
+func testConnLimits(t *testing.T, expectedErr error, opts ...Option) {
+	s := &testAdmissionServer{rejectCh: make(chan error, 1)}
+	addr := runTestServer(t, s, "tcp", append(opts, WithRejectPayload([]byte("busy")))...)
+
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer c.Close() //nolint:gocritic
+		echoConn(t, c)
+		conns = append(conns, c)
+	}
+
+	// The connection over the limit receives the payload and gets closed.
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	expectRead(t, c, "busy")
+	_, err = c.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	_ = c.Close()
+	select {
+	case err = <-s.rejectCh:
+		assert.ErrorIs(t, err, expectedErr)
+	case <-time.After(time.Second):
+		require.FailNow(t, "OnReject is not fired")
+	}
+	stats := s.eng.AdmissionStats()
+	assert.EqualValues(t, 2, stats.Conns)
+	assert.EqualValues(t, 1, stats.RejectedByMaxConns+stats.RejectedByMaxConnsPerLoop+stats.RejectedByMaxConnsPerSource)
+
+	// Closing an admitted connection makes room for a new one.
+	_ = conns[0].Close()
+	require.Eventually(t, func() bool {
+		return s.eng.AdmissionStats().Conns == 1
+	}, time.Second, 10*time.Millisecond)
+	c, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	echoConn(t, c)
+	assert.EqualValues(t, 2, s.eng.AdmissionStats().Conns)
+}
+
+type testAdmissionServer struct {
+	testBaseServer
+	rejectCh chan error
+}
+
+func (s *testAdmissionServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testAdmissionServer) OnReject(_ net.Addr, err error) {
+	s.rejectCh <- err
+}
+
+func TestAcceptRate(t *testing.T) {
+	t.Run("reactor", func(t *testing.T) {
+		testAcceptRate(t)
+	})
+	t.Run("reuseport", func(t *testing.T) {
+		testAcceptRate(t, WithReusePort(true))
+	})
+	t.Run("per-source", func(t *testing.T) {
+		s := &testAdmissionServer{rejectCh: make(chan error, 1)}
+		addr := runTestServer(t, s, "tcp", WithAcceptRatePerSource(1, 1))
+
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer c.Close()
+		echoConn(t, c)
+
+		// The second connection from the same source within a second is rejected.
+		c, err = net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer c.Close()
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err = c.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+		select {
+		case err = <-s.rejectCh:
+			assert.ErrorIs(t, err, errorx.ErrAcceptRateExceeded)
+		case <-time.After(time.Second):
+			require.FailNow(t, "OnReject is not fired")
+		}
+		assert.EqualValues(t, 1, s.eng.AdmissionStats().RejectedByAcceptRatePerSource)
+	})
+}
+
+func testAcceptRate(t *testing.T, opts ...Option) {
+	s := &testAcceptRateServer{openCh: make(chan time.Time, 8)}
+	addr := runTestServer(t, s, "tcp", append(opts, WithAcceptRate(10, 2))...)
+
+	// The connections beyond the burst wait in the backlog and are accepted at the rate.
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer c.Close() //nolint:gocritic
+	}
+	var last time.Time
+	for i := 0; i < 6; i++ {
+		select {
+		case last = <-s.openCh:
+		case <-time.After(3 * time.Second):
+			require.FailNow(t, "connections are not accepted", "accepted: %d", i)
+		}
+	}
+	assert.GreaterOrEqual(t, last.Sub(start), 300*time.Millisecond)
+	assert.NotZero(t, s.eng.AdmissionStats().AcceptThrottled)
+}
+
+type testAcceptRateServer struct {
+	testBaseServer
+	openCh chan time.Time
+}
+
+func (s *testAcceptRateServer) OnOpen(_ Conn) (out []byte, action Action) {
+	s.openCh <- time.Now()
+	return
+}
@@ -19,6 +19,7 @@ package gnet
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"net"
 	"strconv"
@@ -32,15 +33,18 @@ import (
 	"github.com/panjf2000/gnet/v2/internal/netpoll"
 	"github.com/panjf2000/gnet/v2/internal/queue"
 	"github.com/panjf2000/gnet/v2/internal/socket"
+	"github.com/panjf2000/gnet/v2/internal/timingwheel"
 	"github.com/panjf2000/gnet/v2/pkg/buffer/ring"
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
 	"github.com/panjf2000/gnet/v2/pkg/logging"
+	"github.com/panjf2000/gnet/v2/pkg/proxyproto"
 )
 
 // Client of gnet.
 type Client struct {
-	opts *Options
-	el   *eventloop
+	opts       *Options
+	el         *eventloop
+	logFlusher logging.Flusher
 }
 
 // NewClient creates an instance of Client.
@@ -49,20 +53,10 @@ func NewClient(eh EventHandler, opts ...Option) (cli *Client, err error) {
 	cli = new(Client)
 	cli.opts = options
 
-	logger, logFlusher := logging.GetDefaultLogger(), logging.GetDefaultFlusher()
-	if options.Logger == nil {
-		if options.LogPath != "" {
-			logger, logFlusher, _ = logging.CreateLoggerAsLocalFile(options.LogPath, options.LogLevel)
-		}
-		options.Logger = logger
-	} else {
-		logger = options.Logger
-		logFlusher = nil
-	}
-	logging.SetDefaultLoggerAndFlusher(logger, logFlusher)
+	cli.logFlusher = initLogger(options)
 
 	var p *netpoll.Poller
-	if p, err = netpoll.OpenPoller(); err != nil {
+	if p, err = netpoll.OpenPoller(options.Logger); err != nil {
 		return
 	}
 
@@ -78,6 +72,7 @@ func NewClient(eh EventHandler, opts ...Option) (cli *Client, err error) {
 			once        sync.Once
 		}{&errgroup.Group{}, shutdownCtx, shutdown, sync.Once{}},
 	}
+	eng.tlsConfig.Store(options.TLSConfig)
 	if options.Ticker {
 		eng.ticker.ctx, eng.ticker.cancel = context.WithCancel(context.Background())
 	}
@@ -113,37 +108,51 @@ func NewClient(eh EventHandler, opts ...Option) (cli *Client, err error) {
 		options.WriteBufferCap = math.CeilToPowerOfTwo(wbc)
 	}
 
+	if options.OutboundHighWatermark > 0 &&
+		(options.OutboundLowWatermark < 0 || options.OutboundLowWatermark >= options.OutboundHighWatermark) {
+		options.OutboundLowWatermark = options.OutboundHighWatermark / 2
+	}
+
 	el.buffer = make([]byte, options.ReadBufferCap)
 	el.connections.init()
 	el.eventHandler = eh
+	el.timers = timingwheel.New(timingWheelTick, timingWheelSlots)
 	cli.el = &el
 	return
 }
 
 // Start starts the client event-loop, handing IO events.
 func (cli *Client) Start() error {
-	logging.Infof("Starting gnet client with 1 event-loop")
+	cli.opts.Logger.Infof("Starting gnet client with 1 event-loop")
 	cli.el.eventHandler.OnBoot(Engine{cli.el.engine})
 	cli.el.engine.workerPool.Go(cli.el.run)
+	cli.el.engine.startTimers(cli.el)
 	// Start the ticker.
 	if cli.opts.Ticker {
 		go cli.el.ticker(cli.el.engine.ticker.ctx)
 	}
-	logging.Debugf("default logging level is %s", logging.LogLevel())
+	cli.opts.Logger.Debugf("default logging level is %s", logging.LogLevel())
 	return nil
 }
 
 // Stop stops the client event-loop.
 func (cli *Client) Stop() (err error) {
-	logging.Error(cli.el.poller.Trigger(queue.HighPriority, func(_ any) error { return errorx.ErrEngineShutdown }, nil))
+	shutdown := func(_ any) error { return errorx.ErrEngineShutdown }
+	if err := cli.el.poller.Trigger(queue.HighPriority, shutdown, nil); err != nil {
+		cli.opts.Logger.Errorf("failed to enqueue shutdown signal of high-priority for client event-loop: %v", err)
+	}
 	// Stop the ticker.
 	if cli.opts.Ticker {
 		cli.el.engine.ticker.cancel()
 	}
 	_ = cli.el.engine.workerPool.Wait()
-	logging.Error(cli.el.poller.Close())
+	if err := cli.el.poller.Close(); err != nil {
+		cli.opts.Logger.Errorf("failed to close poller when stopping client: %v", err)
+	}
 	cli.el.eventHandler.OnShutdown(Engine{cli.el.engine})
-	logging.Cleanup()
+	if cli.logFlusher != nil {
+		_ = cli.logFlusher()
+	}
 	return
 }
 
@@ -158,7 +167,60 @@ func (cli *Client) DialContext(network, address string, ctx any) (Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	return cli.EnrollContext(c, ctx)
+	return cli.enroll(c, ctx, cli.tlsConfig(address))
+}
+
+// DialProxy is like Dial but sends hdr as the PROXY protocol header once the connection is established.
+func (cli *Client) DialProxy(network, address string, hdr *proxyproto.Header) (Conn, error) {
+	return cli.DialProxyContext(network, address, hdr, nil)
+}
+
+// DialProxyContext is like DialContext but sends hdr as the PROXY protocol header once the connection
+// is established. The Source and Destination of hdr default to the local and remote addresses of
+// the connection, and a version 2 header with them is sent if hdr is nil.
+func (cli *Client) DialProxyContext(network, address string, hdr *proxyproto.Header, ctx any) (Conn, error) {
+	c, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	h := proxyproto.Header{Version: 2, Command: proxyproto.Proxy}
+	if hdr != nil {
+		h = *hdr
+	}
+	if h.Command == proxyproto.Proxy {
+		if h.Source == nil {
+			h.Source = c.LocalAddr()
+		}
+		if h.Destination == nil {
+			h.Destination = c.RemoteAddr()
+		}
+	}
+	buf, err := h.Format()
+	if err == nil {
+		_, err = c.Write(buf)
+	}
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return cli.enroll(c, ctx, cli.tlsConfig(address))
+}
+
+// tlsConfig returns the TLS configuration for the connection dialed to address,
+// ServerName is set to the host of address if it's not set in the configuration.
+func (cli *Client) tlsConfig(address string) *tls.Config {
+	config := cli.el.engine.tlsConfig.Load()
+	if config == nil || config.ServerName != "" || config.InsecureSkipVerify {
+		return config
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return config // not a TCP address
+	}
+	config = config.Clone()
+	config.ServerName = host
+	return config
 }
 
 // Enroll converts a net.Conn to gnet.Conn and then adds it into Client.
@@ -168,6 +230,12 @@ func (cli *Client) Enroll(c net.Conn) (Conn, error) {
 
 // EnrollContext is like Enroll but also accepts an empty interface ctx that can be obtained later via Conn.Context.
 func (cli *Client) EnrollContext(c net.Conn, ctx any) (Conn, error) {
+	return cli.enroll(c, ctx, cli.el.engine.tlsConfig.Load())
+}
+
+// enroll is like EnrollContext but runs the TLS handshake with tlsConfig on
+// the stream-oriented connection if it's not nil, and waits for it to complete.
+func (cli *Client) enroll(c net.Conn, ctx any, tlsConfig *tls.Config) (Conn, error) {
 	defer c.Close()
 
 	sc, ok := c.(syscall.Conn)
@@ -240,6 +308,11 @@ func (cli *Client) EnrollContext(c net.Conn, ctx any) (Conn, error) {
 		return nil, errorx.ErrUnsupportedProtocol
 	}
 	gc.ctx = ctx
+	if tlsConfig != nil && !gc.isDatagram {
+		gc.tls = newTLSSession(gc, tlsConfig, true)
+	}
+	// Hold the TLS session which is dropped from gc once gc is closed.
+	s := gc.tls
 
 	connOpened := make(chan struct{})
 	ccb := &connWithCallback{c: gc, cb: func() {
@@ -252,5 +325,15 @@ func (cli *Client) EnrollContext(c net.Conn, ctx any) (Conn, error) {
 	}
 
 	<-connOpened
+	if s != nil {
+		select {
+		case <-s.done:
+		case <-cli.el.engine.workerPool.shutdownCtx.Done():
+			return nil, errorx.ErrEngineShutdown
+		}
+		if s.err != nil {
+			return nil, s.err
+		}
+	}
 	return gc, nil
 }
@@ -25,28 +25,20 @@ import (
 
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
 	"github.com/panjf2000/gnet/v2/pkg/logging"
+	"github.com/panjf2000/gnet/v2/pkg/proxyproto"
 )
 
 type Client struct {
-	opts *Options
-	el   *eventloop
+	opts       *Options
+	el         *eventloop
+	logFlusher logging.Flusher
 }
 
 func NewClient(eh EventHandler, opts ...Option) (cli *Client, err error) {
 	options := loadOptions(opts...)
 	cli = &Client{opts: options}
 
-	logger, logFlusher := logging.GetDefaultLogger(), logging.GetDefaultFlusher()
-	if options.Logger == nil {
-		if options.LogPath != "" {
-			logger, logFlusher, _ = logging.CreateLoggerAsLocalFile(options.LogPath, options.LogLevel)
-		}
-		options.Logger = logger
-	} else {
-		logger = options.Logger
-		logFlusher = nil
-	}
-	logging.SetDefaultLoggerAndFlusher(logger, logFlusher)
+	cli.logFlusher = initLogger(options)
 
 	shutdownCtx, shutdown := context.WithCancel(context.Background())
 	eng := &engine{
@@ -79,7 +71,7 @@ func (cli *Client) Start() error {
 			return nil
 		})
 	}
-	logging.Debugf("default logging level is %s", logging.LogLevel())
+	cli.opts.Logger.Debugf("default logging level is %s", logging.LogLevel())
 	return nil
 }
 
@@ -90,7 +82,9 @@ func (cli *Client) Stop() (err error) {
 	}
 	_ = cli.el.eng.workerPool.Wait()
 	cli.el.eventHandler.OnShutdown(Engine{cli.el.eng})
-	logging.Cleanup()
+	if cli.logFlusher != nil {
+		_ = cli.logFlusher()
+	}
 	return
 }
 
@@ -193,7 +187,7 @@ func (cli *Client) EnrollContext(nc net.Conn, ctx any) (gc Conn, err error) {
 					tmpDir := unixAddrDirs[uc.LocalAddr().String()]
 					mu.RUnlock()
 					if err := os.RemoveAll(tmpDir); err != nil {
-						logging.Errorf("failed to remove temporary directory for unix local address: %v", err)
+						el.getLogger().Errorf("failed to remove temporary directory for unix local address: %v", err)
 					}
 					return
 				}
@@ -227,3 +221,13 @@ func (cli *Client) EnrollContext(nc net.Conn, ctx any) (gc Conn, err error) {
 	<-connOpened
 	return
 }
+
+// DialProxy is not supported on Windows.
+func (cli *Client) DialProxy(_, _ string, _ *proxyproto.Header) (Conn, error) {
+	return nil, errorx.ErrUnsupportedOp
+}
+
+// DialProxyContext is not supported on Windows.
+func (cli *Client) DialProxyContext(_, _ string, _ *proxyproto.Header, _ any) (Conn, error) {
+	return nil, errorx.ErrUnsupportedOp
+}
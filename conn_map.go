@@ -66,8 +66,10 @@ func (cm *connMatrix) getConn(fd int) *conn {
 	return cm.connMap[fd]
 }
 
-/*
+// getConnByGFD returns the connection of fd, nil if the connection has been closed.
 func (cm *connMatrix) getConnByGFD(fd gfd.GFD) *conn {
-	return cm.connMap[fd.Fd()]
+	if c := cm.connMap[fd.Fd()]; c != nil && c.gfd.Sequence() == fd.Sequence() {
+		return c
+	}
+	return nil
 }
-*/
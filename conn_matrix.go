@@ -149,11 +149,13 @@ func (cm *connMatrix) getConn(fd int) *conn {
 	return cm.table[gFD.ConnMatrixRow()][gFD.ConnMatrixColumn()]
 }
 
-/*
+// getConnByGFD returns the connection of fd, nil if the connection has been closed.
+// The connection is located by the latest GFD of its socket fd because compaction
+// might have moved it since fd was obtained.
 func (cm *connMatrix) getConnByGFD(fd gfd.GFD) *conn {
-	if cm.table[fd.ConnMatrixRow()] == nil {
+	gFD, ok := cm.fd2gfd[fd.Fd()]
+	if !ok || gFD.Sequence() != fd.Sequence() {
 		return nil
 	}
-	return cm.table[fd.ConnMatrixRow()][fd.ConnMatrixColumn()]
+	return cm.getConn(fd.Fd())
 }
-*/
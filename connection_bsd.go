@@ -56,3 +56,30 @@ func (c *conn) processIO(_ int, filter netpoll.IOEvent, flags netpoll.IOFlags) (
 	}
 	return
 }
+
+// watchWrite makes the poller monitor the writable events of c.
+func (c *conn) watchWrite() error {
+	return c.loop.poller.ModReadWrite(&c.pollAttachment, false)
+}
+
+// unwatchWrite stops the poller from monitoring the writable events of c.
+func (c *conn) unwatchWrite() error {
+	return c.loop.poller.ModRead(&c.pollAttachment, false)
+}
+
+// disableRead stops the poller from monitoring the readable events of c,
+// the filters of kqueue are independent, so the writable events are left intact.
+func (c *conn) disableRead() error {
+	return c.loop.poller.DeleteRead(&c.pollAttachment)
+}
+
+// enableRead makes the poller monitor the readable events of c again.
+func (c *conn) enableRead() error {
+	return c.loop.poller.AddRead(&c.pollAttachment, c.loop.engine.opts.EdgeTriggeredIO)
+}
+
+// unwatchListener stops the poller from monitoring ln, Poller.Delete is a no-op
+// on kqueue, which removes the filters only when the fd is closed.
+func (el *eventloop) unwatchListener(ln *listener) error {
+	return el.poller.DeleteRead(ln.pollAttachment)
+}
@@ -68,3 +68,43 @@ func (c *conn) processIO(_ int, ev netpoll.IOEvent, _ netpoll.IOFlags) error {
 	}
 	return nil
 }
+
+// watchWrite makes the poller monitor the writable events of c.
+func (c *conn) watchWrite() error {
+	if c.readDisabled {
+		return c.loop.poller.ModWrite(&c.pollAttachment, false)
+	}
+	return c.loop.poller.ModReadWrite(&c.pollAttachment, false)
+}
+
+// unwatchWrite stops the poller from monitoring the writable events of c.
+func (c *conn) unwatchWrite() error {
+	if c.readDisabled {
+		return c.loop.poller.ModNone(&c.pollAttachment)
+	}
+	return c.loop.poller.ModRead(&c.pollAttachment, false)
+}
+
+// disableRead stops the poller from monitoring the readable events of c,
+// EPOLLRDHUP is left out as well to keep the unread data until reading is enabled again.
+func (c *conn) disableRead() error {
+	isET := c.loop.engine.opts.EdgeTriggeredIO
+	if isET || !c.outboundBuffer.IsEmpty() {
+		return c.loop.poller.ModWrite(&c.pollAttachment, isET)
+	}
+	return c.loop.poller.ModNone(&c.pollAttachment)
+}
+
+// enableRead makes the poller monitor the readable events of c again.
+func (c *conn) enableRead() error {
+	isET := c.loop.engine.opts.EdgeTriggeredIO
+	if isET || !c.outboundBuffer.IsEmpty() {
+		return c.loop.poller.ModReadWrite(&c.pollAttachment, isET)
+	}
+	return c.loop.poller.ModRead(&c.pollAttachment, false)
+}
+
+// unwatchListener stops the poller from monitoring ln.
+func (el *eventloop) unwatchListener(ln *listener) error {
+	return el.poller.Delete(ln.fd)
+}
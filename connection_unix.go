@@ -18,10 +18,13 @@
 package gnet
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
+	"net/netip"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sys/unix"
@@ -32,31 +35,49 @@ import (
 	"github.com/panjf2000/gnet/v2/internal/netpoll"
 	"github.com/panjf2000/gnet/v2/internal/queue"
 	"github.com/panjf2000/gnet/v2/internal/socket"
+	"github.com/panjf2000/gnet/v2/internal/timingwheel"
 	"github.com/panjf2000/gnet/v2/pkg/buffer/elastic"
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
-	"github.com/panjf2000/gnet/v2/pkg/logging"
 	bsPool "github.com/panjf2000/gnet/v2/pkg/pool/byteslice"
+	"github.com/panjf2000/gnet/v2/pkg/proxyproto"
 )
 
 type conn struct {
-	fd             int                    // file descriptor
-	gfd            gfd.GFD                // gnet file descriptor
-	ctx            any                    // user-defined context
-	remote         unix.Sockaddr          // remote socket address
-	localAddr      net.Addr               // local addr
-	remoteAddr     net.Addr               // remote addr
-	loop           *eventloop             // connected event-loop
-	outboundBuffer elastic.Buffer         // buffer for data that is eligible to be sent to the remote
-	pollAttachment netpoll.PollAttachment // connection attachment for poller
-	inboundBuffer  elastic.RingBuffer     // buffer for leftover data from the remote
-	buffer         []byte                 // buffer for the latest bytes
-	cache          []byte                 // temporary cache for the inbound data
-	isDatagram     bool                   // UDP protocol
-	opened         bool                   // connection opened event fired
-	isEOF          bool                   // whether the connection has reached EOF
-	connId         int64
-	id             uint16
-	debugString    string
+	fd               int                    // file descriptor
+	gfd              gfd.GFD                // gnet file descriptor
+	ctx              any                    // user-defined context
+	remote           unix.Sockaddr          // remote socket address
+	localAddr        net.Addr               // local addr
+	remoteAddr       net.Addr               // remote addr
+	loop             *eventloop             // connected event-loop
+	outboundBuffer   elastic.Buffer         // buffer for data that is eligible to be sent to the remote
+	pollAttachment   netpoll.PollAttachment // connection attachment for poller
+	inboundBuffer    elastic.RingBuffer     // buffer for leftover data from the remote
+	buffer           []byte                 // buffer for the latest bytes
+	cache            []byte                 // temporary cache for the inbound data
+	isDatagram       bool                   // UDP protocol
+	opened           bool                   // connection opened event fired
+	isEOF            bool                   // whether the connection has reached EOF
+	readDeadline     int64                  // read deadline in Unix nanoseconds, accessed atomically
+	writeDeadline    int64                  // write deadline in Unix nanoseconds, accessed atomically
+	deadlineTimer    timingwheel.Timer      // timer for the earliest pending deadline
+	lastActive       int64                  // the last time in Unix nanoseconds when data was read or written
+	idleTimer        timingwheel.Timer      // timer for the idle timeout
+	connId           int64                  // unique ID of the connection in the engine
+	groups           map[string]struct{}    // groups that the connection has joined
+	keys             map[string]struct{}    // keys that are bound to the connection
+	outboundFull     bool                   // whether the outbound buffer has reached the high watermark
+	readPaused       int32                  // whether reading is paused by PauseRead, accessed atomically
+	readDisabled     bool                   // whether the readable events are not monitored by the poller
+	admitted         bool                   // whether the connection is counted against the connection limits
+	source           netip.Prefix           // source of the connection for Options.MaxConnsPerSource
+	proxyPending     bool                   // whether the connection is waiting for the PROXY protocol header
+	proxyHeader      *proxyproto.Header     // PROXY protocol header received on the connection
+	handshakeTimer   timingwheel.Timer      // timer for receiving the headers or the TLS handshake
+	tls              *tlsSession            // TLS state of the connection
+	transform        StreamTransform        // transformation of the byte stream of the connection
+	transformPending bool                   // whether the connection is waiting for the header of the stream transform
+	debugString      string
 }
 
 func newTCPConn(fd int, el *eventloop, sa unix.Sockaddr, localAddr, remoteAddr net.Addr) (c *conn) {
@@ -67,11 +88,11 @@ func newTCPConn(fd int, el *eventloop, sa unix.Sockaddr, localAddr, remoteAddr n
 		localAddr:      localAddr,
 		remoteAddr:     remoteAddr,
 		pollAttachment: netpoll.PollAttachment{FD: fd},
-		id:             el.next,
-		connId:         int64(el.idx)<<48 | int64(el.next)<<32 | int64(fd),
+		connId:         el.nextConnId(),
 	}
-	el.next = el.next + 1
 	c.pollAttachment.Callback = c.processIO
+	c.deadlineTimer.Func = c.expireDeadline
+	c.idleTimer.Func = c.expireIdle
 	c.outboundBuffer.Reset(el.engine.opts.WriteBufferCap)
 	return
 }
@@ -86,10 +107,8 @@ func newUDPConn(fd int, el *eventloop, localAddr net.Addr, sa unix.Sockaddr, con
 		remoteAddr:     socket.SockaddrToUDPAddr(sa),
 		isDatagram:     true,
 		pollAttachment: netpoll.PollAttachment{FD: fd, Callback: el.readUDP},
-		id:             el.next,
-		connId:         int64(el.idx)<<48 | int64(el.next)<<32 | int64(fd),
+		connId:         el.nextConnId(),
 	}
-	el.next = el.next + 1
 	if connected {
 		c.remote = nil
 	}
@@ -97,17 +116,23 @@ func newUDPConn(fd int, el *eventloop, localAddr net.Addr, sa unix.Sockaddr, con
 }
 
 func (c *conn) release() {
+	c.loop.engine.release(c)
 	c.opened = false
 	c.isEOF = false
 	c.ctx = nil
 	c.buffer = nil
-	if addr, ok := c.localAddr.(*net.TCPAddr); ok && len(c.loop.listeners) == 0 && len(addr.Zone) > 0 {
+	if c.tls != nil {
+		c.tls.close()
+		c.tls = nil
+	}
+	c.transform = nil
+	if addr, ok := c.localAddr.(*net.TCPAddr); ok && c.loop.engine.isClient() && len(addr.Zone) > 0 {
 		bsPool.Put(bs.StringToBytes(addr.Zone))
 	}
 	if addr, ok := c.remoteAddr.(*net.TCPAddr); ok && len(addr.Zone) > 0 {
 		bsPool.Put(bs.StringToBytes(addr.Zone))
 	}
-	if addr, ok := c.localAddr.(*net.UDPAddr); ok && len(c.loop.listeners) == 0 && len(addr.Zone) > 0 {
+	if addr, ok := c.localAddr.(*net.UDPAddr); ok && c.loop.engine.isClient() && len(addr.Zone) > 0 {
 		bsPool.Put(bs.StringToBytes(addr.Zone))
 	}
 	if addr, ok := c.remoteAddr.(*net.UDPAddr); ok && len(addr.Zone) > 0 {
@@ -126,6 +151,16 @@ func (c *conn) open(buf []byte) error {
 	if c.isDatagram && c.remote == nil {
 		return unix.Send(c.fd, buf, 0)
 	}
+	if c.tls != nil {
+		_, err := c.writeTLS(buf)
+		return err
+	}
+	if c.transform != nil {
+		out := bsPool.Get(len(buf))
+		defer bsPool.Put(out)
+		c.transform.Outbound(out, buf)
+		buf = out
+	}
 
 	for {
 		n, err := unix.Write(c.fd, buf)
@@ -146,8 +181,53 @@ func (c *conn) open(buf []byte) error {
 }
 
 func (c *conn) write(data []byte) (n int, err error) {
+	if c.writeDeadlineExceeded() {
+		return 0, c.timeoutError("write")
+	}
+	if c.reachedHighWatermark() {
+		return 0, errorx.ErrOutboundBufferFull
+	}
+	if c.tls != nil {
+		n, err = c.writeTLS(data)
+	} else {
+		n, err = c.send(data)
+	}
+	// A single write might take the outbound buffer far past the high watermark,
+	// refuse the writes after it as soon as it's buffered.
+	c.reachedHighWatermark()
+	return
+}
+
+// send writes data to the remote with transmit, c is closed if the socket fails.
+func (c *conn) send(data []byte) (int, error) {
+	n, fatal, err := c.transmit(data)
+	if fatal {
+		c.closeOnWriteError(err)
+		return 0, err
+	}
+	return n, err
+}
+
+// closeOnWriteError closes c whose socket fails to be written with err.
+func (c *conn) closeOnWriteError(err error) {
+	if e := c.loop.close(c, err); e != nil {
+		c.loop.getLogger().Errorf("failed to close connection(fd=%d,remote=%+v) on conn.write: %v",
+			c.fd, c.remoteAddr, e)
+	}
+}
+
+// transmit writes data to the remote as it is, or as it's transformed by the stream transform,
+// the leftover is buffered in the outbound buffer if the socket is not writable for now.
+// fatal reports whether err is a failure of the socket, which c must be closed for.
+func (c *conn) transmit(data []byte) (n int, fatal bool, err error) {
 	isET := c.loop.engine.opts.EdgeTriggeredIO
 	n = len(data)
+	if c.transform != nil {
+		out := bsPool.Get(len(data))
+		defer bsPool.Put(out)
+		c.transform.Outbound(out, data)
+		data = out
+	}
 	// If there is pending data in outbound buffer,
 	// the current data ought to be appended to the
 	// outbound buffer for maintaining the sequence
@@ -165,16 +245,13 @@ loop:
 		if err == unix.EAGAIN {
 			_, err = c.outboundBuffer.Write(data)
 			if !isET {
-				err = c.loop.poller.ModReadWrite(&c.pollAttachment, false)
+				err = c.watchWrite()
 			}
 			return
 		}
-		if err := c.loop.close(c, os.NewSyscallError("write", err)); err != nil {
-			logging.Errorf("failed to close connection(fd=%d,remote=%+v) on conn.write: %v",
-				c.fd, c.remoteAddr, err)
-		}
-		return 0, os.NewSyscallError("write", err)
+		return 0, true, os.NewSyscallError("write", err)
 	}
+	c.touch()
 	data = data[sent:]
 	if isET && len(data) > 0 {
 		goto loop
@@ -182,18 +259,45 @@ loop:
 	// Failed to send all data back to the remote, buffer the leftover data for the next round.
 	if len(data) > 0 {
 		_, _ = c.outboundBuffer.Write(data)
-		err = c.loop.poller.ModReadWrite(&c.pollAttachment, false)
+		err = c.watchWrite()
 	}
 
 	return
 }
 
 func (c *conn) writev(bs [][]byte) (n int, err error) {
+	if c.writeDeadlineExceeded() {
+		return 0, c.timeoutError("writev")
+	}
+	if c.reachedHighWatermark() {
+		return 0, errorx.ErrOutboundBufferFull
+	}
+	defer c.reachedHighWatermark() // refuse the writes after it as soon as it's buffered, like write
+
 	isET := c.loop.engine.opts.EdgeTriggeredIO
 
 	for _, b := range bs {
 		n += len(b)
 	}
+	if c.tls != nil {
+		for _, b := range bs {
+			if _, err = c.writeTLS(b); err != nil {
+				return 0, err
+			}
+		}
+		return
+	}
+	if c.transform != nil {
+		// Transform all the data into a single buffer.
+		out := bsPool.Get(n)
+		defer bsPool.Put(out)
+		var off int
+		for _, b := range bs {
+			c.transform.Outbound(out[off:off+len(b)], b)
+			off += len(b)
+		}
+		bs = [][]byte{out}
+	}
 
 	// If there is pending data in outbound buffer,
 	// the current data ought to be appended to the
@@ -213,16 +317,17 @@ loop:
 		if err == unix.EAGAIN {
 			_, err = c.outboundBuffer.Writev(bs)
 			if !isET {
-				err = c.loop.poller.ModReadWrite(&c.pollAttachment, false)
+				err = c.watchWrite()
 			}
 			return
 		}
 		if err := c.loop.close(c, os.NewSyscallError("writev", err)); err != nil {
-			logging.Errorf("failed to close connection(fd=%d,remote=%+v) on conn.writev: %v",
+			c.loop.getLogger().Errorf("failed to close connection(fd=%d,remote=%+v) on conn.writev: %v",
 				c.fd, c.remoteAddr, err)
 		}
 		return 0, os.NewSyscallError("writev", err)
 	}
+	c.touch()
 	pos := len(bs)
 	if remaining -= sent; remaining > 0 {
 		for i := range bs {
@@ -243,7 +348,7 @@ loop:
 	// Failed to send all data back to the remote, buffer the leftover data for the next round.
 	if remaining > 0 {
 		_, _ = c.outboundBuffer.Writev(bs)
-		err = c.loop.poller.ModReadWrite(&c.pollAttachment, false)
+		err = c.watchWrite()
 	}
 
 	return
@@ -257,9 +362,7 @@ type asyncWriteHook struct {
 func (c *conn) asyncWrite(a any) (err error) {
 	hook := a.(*asyncWriteHook)
 	defer func() {
-		if hook.callback != nil {
-			_ = hook.callback(c, err)
-		}
+		c.invokeCallback(hook.callback, err)
 	}()
 
 	if !c.opened {
@@ -278,9 +381,7 @@ type asyncWritevHook struct {
 func (c *conn) asyncWritev(a any) (err error) {
 	hook := a.(*asyncWritevHook)
 	defer func() {
-		if hook.callback != nil {
-			_ = hook.callback(c, err)
-		}
+		c.invokeCallback(hook.callback, err)
 	}()
 
 	if !c.opened {
@@ -291,6 +392,22 @@ func (c *conn) asyncWritev(a any) (err error) {
 	return
 }
 
+// writeResidual sends the data in the outbound buffer back to the remote
+// as much as possible without waiting for the socket to be writable.
+func (c *conn) writeResidual() {
+	for !c.outboundBuffer.IsEmpty() {
+		iov, _ := c.outboundBuffer.Peek(0)
+		if len(iov) > iovMax {
+			iov = iov[:iovMax]
+		}
+		if n, e := gio.Writev(c.fd, iov); e != nil {
+			break
+		} else { //nolint:revive
+			_, _ = c.outboundBuffer.Discard(n)
+		}
+	}
+}
+
 func (c *conn) sendTo(buf []byte) error {
 	if c.remote == nil {
 		return unix.Send(c.fd, buf, 0)
@@ -416,6 +533,10 @@ func (c *conn) Writev(bs [][]byte) (int, error) {
 }
 
 func (c *conn) ReadFrom(r io.Reader) (int64, error) {
+	if c.tls != nil || c.transform != nil {
+		// Hide ReadFrom of c from io.Copy, so that the data is encrypted or transformed by c.Write.
+		return io.Copy(struct{ io.Writer }{c}, r)
+	}
 	return c.outboundBuffer.ReadFrom(r)
 }
 
@@ -451,8 +572,7 @@ func (c *conn) RemoteAddr() net.Addr { return c.remoteAddr }
 
 // Implementation of Socket interface
 
-// func (c *conn) Gfd() gfd.GFD             { return c.gfd }
-
+func (c *conn) Gfd() gfd.GFD                   { return c.gfd }
 func (c *conn) Fd() int                        { return c.fd }
 func (c *conn) Dup() (fd int, err error)       { return socket.Dup(c.fd) }
 func (c *conn) SetReadBuffer(bytes int) error  { return socket.SetRecvBuffer(c.fd, bytes) }
@@ -496,9 +616,7 @@ func (c *conn) AsyncWritev(bs [][]byte, callback AsyncCallback) error {
 func (c *conn) Wake(callback AsyncCallback) error {
 	return c.loop.poller.Trigger(queue.LowPriority, func(_ any) (err error) {
 		err = c.loop.wake(c)
-		if callback != nil {
-			_ = callback(c, err)
-		}
+		c.invokeCallback(callback, err)
 		return
 	}, nil)
 }
@@ -506,13 +624,30 @@ func (c *conn) Wake(callback AsyncCallback) error {
 func (c *conn) CloseWithCallback(callback AsyncCallback) error {
 	return c.loop.poller.Trigger(queue.LowPriority, func(_ any) (err error) {
 		err = c.loop.close(c, nil)
-		if callback != nil {
-			_ = callback(c, err)
-		}
+		c.invokeCallback(callback, err)
 		return
 	}, nil)
 }
 
+func (c *conn) isReadPaused() bool {
+	return atomic.LoadInt32(&c.readPaused) == 1
+}
+
+// invokeCallback invokes the callback of asynchronous operations on the event-loop.
+func (c *conn) invokeCallback(callback AsyncCallback, err error) {
+	if callback == nil {
+		return
+	}
+	defer c.loop.recoverPanic(c)
+	_ = callback(c, err)
+}
+
+// invoke invokes cb which is triggered on the event-loop by Engine.
+func (c *conn) invoke(cb func(c Conn)) {
+	defer c.loop.recoverPanic(c)
+	cb(c)
+}
+
 func (c *conn) Close() error {
 	return c.loop.poller.Trigger(queue.LowPriority, func(_ any) (err error) {
 		err = c.loop.close(c, nil)
@@ -520,22 +655,299 @@ func (c *conn) Close() error {
 	}, nil)
 }
 
-func (*conn) SetDeadline(_ time.Time) error {
-	return errorx.ErrUnsupportedOp
+func (c *conn) SetDeadline(t time.Time) error {
+	if c.isDatagram {
+		return errorx.ErrUnsupportedOp
+	}
+	d := deadlineToNano(t)
+	atomic.StoreInt64(&c.readDeadline, d)
+	atomic.StoreInt64(&c.writeDeadline, d)
+	return c.loop.poller.Trigger(queue.HighPriority, c.resetDeadline, nil)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	if c.isDatagram {
+		return errorx.ErrUnsupportedOp
+	}
+	atomic.StoreInt64(&c.readDeadline, deadlineToNano(t))
+	return c.loop.poller.Trigger(queue.HighPriority, c.resetDeadline, nil)
 }
 
-func (*conn) SetReadDeadline(_ time.Time) error {
-	return errorx.ErrUnsupportedOp
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	if c.isDatagram {
+		return errorx.ErrUnsupportedOp
+	}
+	atomic.StoreInt64(&c.writeDeadline, deadlineToNano(t))
+	return c.loop.poller.Trigger(queue.HighPriority, c.resetDeadline, nil)
 }
 
-func (*conn) SetWriteDeadline(_ time.Time) error {
-	return errorx.ErrUnsupportedOp
+func deadlineToNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	if d := t.UnixNano(); d > 0 {
+		return d
+	}
+	return 1 // a deadline in the distant past
+}
+
+func (c *conn) resetDeadline(_ any) error {
+	if !c.opened {
+		return nil
+	}
+	c.armDeadline(time.Now().UnixNano())
+	return nil
+}
+
+// armDeadline schedules the deadline timer for the earliest deadline that may
+// close the connection, a passed write deadline doesn't count unless there is
+// pending data in the outbound buffer.
+func (c *conn) armDeadline(now int64) {
+	next := atomic.LoadInt64(&c.readDeadline)
+	if wd := atomic.LoadInt64(&c.writeDeadline); wd > 0 && (next == 0 || wd < next) &&
+		(wd > now || !c.outboundBuffer.IsEmpty()) {
+		next = wd
+	}
+	if next == 0 {
+		c.loop.timers.Stop(&c.deadlineTimer)
+		return
+	}
+	c.loop.timers.Schedule(&c.deadlineTimer, time.Unix(0, next))
+}
+
+// expireDeadline closes the connection if the read deadline has passed, or the
+// write deadline has passed while the outbound buffer still holds pending data.
+func (c *conn) expireDeadline() error {
+	if !c.opened {
+		return nil
+	}
+	now := time.Now().UnixNano()
+	if rd := atomic.LoadInt64(&c.readDeadline); rd > 0 && now >= rd {
+		return c.loop.close(c, c.timeoutError("read"))
+	}
+	if wd := atomic.LoadInt64(&c.writeDeadline); wd > 0 && now >= wd && !c.outboundBuffer.IsEmpty() {
+		return c.loop.close(c, c.timeoutError("write"))
+	}
+	c.armDeadline(now)
+	return nil
+}
+
+// touch records the latest activity on the connection if the idle timeout is enabled.
+func (c *conn) touch() {
+	if c.loop.engine.opts.IdleTimeout > 0 {
+		c.lastActive = time.Now().UnixNano()
+	}
+}
+
+// armIdle starts the idle timer of the connection if the idle timeout is enabled.
+func (c *conn) armIdle() {
+	if idle := c.loop.engine.opts.IdleTimeout; idle > 0 {
+		now := time.Now()
+		c.lastActive = now.UnixNano()
+		c.loop.timers.Schedule(&c.idleTimer, now.Add(idle))
+	}
+}
+
+// expireIdle closes the connection or hands it over to IdleHandler if there
+// has been no activity on it for Options.IdleTimeout, otherwise it restarts
+// the idle timer from the latest activity.
+func (c *conn) expireIdle() error {
+	if !c.opened {
+		return nil
+	}
+	idle := c.loop.engine.opts.IdleTimeout
+	now := time.Now()
+	if deadline := time.Unix(0, c.lastActive).Add(idle); deadline.After(now) {
+		c.loop.timers.Schedule(&c.idleTimer, deadline)
+		return nil
+	}
+
+	action := Close
+	if h, ok := c.loop.eventHandler.(IdleHandler); ok {
+		action = c.onIdle(h)
+	}
+	switch action {
+	case None:
+		c.lastActive = now.UnixNano()
+		c.loop.timers.Schedule(&c.idleTimer, now.Add(idle))
+		return nil
+	case Close:
+		return c.loop.close(c, errorx.ErrIdleTimeout)
+	case Shutdown:
+		return errorx.ErrEngineShutdown
+	default:
+		return nil
+	}
+}
+
+// onIdle invokes OnIdle, the connection has been closed if a panic is recovered from OnIdle.
+func (c *conn) onIdle(h IdleHandler) (action Action) {
+	action = Close
+	defer c.loop.recoverPanic(c)
+	return h.OnIdle(c)
+}
+
+// reachedHighWatermark reports whether the outbound buffer has reached Options.OutboundHighWatermark
+// and hasn't drained to Options.OutboundLowWatermark since then.
+func (c *conn) reachedHighWatermark() bool {
+	high := c.loop.engine.opts.OutboundHighWatermark
+	if high > 0 && c.outboundBuffer.Buffered() >= high {
+		c.outboundFull = true
+	}
+	return c.outboundFull
+}
+
+// drained reports whether the outbound buffer that reached Options.OutboundHighWatermark
+// has drained to Options.OutboundLowWatermark.
+func (c *conn) drained() bool {
+	if c.outboundFull && c.outboundBuffer.Buffered() <= c.loop.engine.opts.OutboundLowWatermark {
+		c.outboundFull = false
+		return true
+	}
+	return false
+}
+
+// onWritable invokes OnWritable, the connection has been closed if a panic is recovered from OnWritable.
+func (c *conn) onWritable(h WritableHandler) (action Action) {
+	defer c.loop.recoverPanic(c)
+	return h.OnWritable(c)
+}
+
+func (c *conn) writeDeadlineExceeded() bool {
+	wd := atomic.LoadInt64(&c.writeDeadline)
+	return wd > 0 && time.Now().UnixNano() >= wd
+}
+
+// timeoutError returns an error that matches os.ErrDeadlineExceeded.
+func (c *conn) timeoutError(op string) error {
+	var network string
+	if c.localAddr != nil {
+		network = c.localAddr.Network()
+	}
+	return &net.OpError{Op: op, Net: network, Source: c.localAddr, Addr: c.remoteAddr, Err: os.ErrDeadlineExceeded}
 }
 
 func (c *conn) ConnId() int64 {
 	return c.connId
 }
 
+func (c *conn) ProxyHeader() *proxyproto.Header {
+	return c.proxyHeader
+}
+
+func (c *conn) TLSConnectionState() (tls.ConnectionState, bool) {
+	if c.tls == nil || !c.tls.established {
+		return tls.ConnectionState{}, false
+	}
+	return c.tls.conn.ConnectionState(), true
+}
+
+func (c *conn) StreamTransform() StreamTransform {
+	return c.transform
+}
+
+func (c *conn) Join(group string) error {
+	if c.isDatagram && c.remote != nil {
+		return errorx.ErrUnsupportedOp
+	}
+	if !c.opened {
+		return net.ErrClosed
+	}
+	if _, ok := c.groups[group]; ok {
+		return nil
+	}
+	if c.groups == nil {
+		c.groups = make(map[string]struct{})
+	}
+	c.groups[group] = struct{}{}
+	c.loop.join(c, group)
+	return nil
+}
+
+func (c *conn) Leave(group string) {
+	if _, ok := c.groups[group]; !ok {
+		return
+	}
+	delete(c.groups, group)
+	c.loop.leave(c, group)
+}
+
+func (c *conn) Bind(key string) error {
+	if c.isDatagram && c.remote != nil {
+		return errorx.ErrUnsupportedOp
+	}
+	if !c.opened {
+		return net.ErrClosed
+	}
+	if _, ok := c.keys[key]; ok {
+		return nil
+	}
+	if c.keys == nil {
+		c.keys = make(map[string]struct{})
+	}
+	c.keys[key] = struct{}{}
+	c.loop.engine.bind(c, key)
+	return nil
+}
+
+func (c *conn) Unbind(key string) {
+	if _, ok := c.keys[key]; !ok {
+		return
+	}
+	delete(c.keys, key)
+	c.loop.engine.unbind(c, key)
+}
+
+func (c *conn) PauseRead() error {
+	if c.isDatagram {
+		return errorx.ErrUnsupportedOp
+	}
+	if !atomic.CompareAndSwapInt32(&c.readPaused, 0, 1) {
+		return nil
+	}
+	return c.loop.poller.Trigger(queue.HighPriority, c.syncReadInterest, nil)
+}
+
+func (c *conn) ResumeRead() error {
+	if c.isDatagram {
+		return errorx.ErrUnsupportedOp
+	}
+	if !atomic.CompareAndSwapInt32(&c.readPaused, 1, 0) {
+		return nil
+	}
+	return c.loop.poller.Trigger(queue.HighPriority, c.syncReadInterest, nil)
+}
+
+// syncReadInterest makes the poller monitor the readable events of c or not according to
+// the latest call of PauseRead or ResumeRead.
+func (c *conn) syncReadInterest(_ any) error {
+	if !c.opened {
+		return nil
+	}
+	paused := atomic.LoadInt32(&c.readPaused) == 1
+	if paused == c.readDisabled {
+		return nil
+	}
+	c.readDisabled = paused
+	if paused {
+		return c.disableRead()
+	}
+	if err := c.enableRead(); err != nil {
+		return err
+	}
+	// Hand over the data that was left in the inbound buffer when reading was paused.
+	if !c.inboundBuffer.IsEmpty() {
+		if err := c.loop.wake(c); err != nil || !c.opened {
+			return err
+		}
+	}
+	// So are the records that were left undecrypted.
+	if c.tls != nil {
+		return c.loop.decrypt(c)
+	}
+	return nil
+}
+
 func (c *conn) String() string {
 	if c.debugString == "" {
 		c.debugString = fmt.Sprintf("%d@(%s->%s)", c.connId, c.remoteAddr.String(), c.localAddr.String())
@@ -15,6 +15,7 @@
 package gnet
 
 import (
+	"crypto/tls"
 	"errors"
 	"io"
 	"net"
@@ -24,11 +25,13 @@ import (
 	"github.com/panjf2000/ants/v2"
 	"golang.org/x/sys/windows"
 
+	"github.com/panjf2000/gnet/v2/internal/gfd"
 	"github.com/panjf2000/gnet/v2/pkg/buffer/elastic"
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
 	bbPool "github.com/panjf2000/gnet/v2/pkg/pool/bytebuffer"
 	bsPool "github.com/panjf2000/gnet/v2/pkg/pool/byteslice"
 	goPool "github.com/panjf2000/gnet/v2/pkg/pool/goroutine"
+	"github.com/panjf2000/gnet/v2/pkg/proxyproto"
 )
 
 type netErr struct {
@@ -418,7 +421,7 @@ var workerPool = nonBlockingPool{Pool: goPool.Default()}
 
 // Gfd return an uninitialized GFD which is not valid,
 // this method is only implemented for compatibility, don't use it on Windows.
-// func (c *conn) Gfd() gfd.GFD { return gfd.GFD{} }
+func (c *conn) Gfd() gfd.GFD { return gfd.GFD{} }
 
 func (c *conn) AsyncWrite(buf []byte, cb AsyncCallback) error {
 	_, err := c.Write(buf)
@@ -526,3 +529,35 @@ func (*conn) SetReadDeadline(_ time.Time) error {
 func (*conn) SetWriteDeadline(_ time.Time) error {
 	return errorx.ErrUnsupportedOp
 }
+
+func (*conn) Join(_ string) error {
+	return errorx.ErrUnsupportedOp
+}
+
+func (*conn) Leave(_ string) {}
+
+func (*conn) PauseRead() error {
+	return errorx.ErrUnsupportedOp
+}
+
+func (*conn) ResumeRead() error {
+	return errorx.ErrUnsupportedOp
+}
+
+func (*conn) Bind(_ string) error {
+	return errorx.ErrUnsupportedOp
+}
+
+func (*conn) Unbind(_ string) {}
+
+func (*conn) ProxyHeader() *proxyproto.Header {
+	return nil
+}
+
+func (*conn) TLSConnectionState() (tls.ConnectionState, bool) {
+	return tls.ConnectionState{}, false
+}
+
+func (*conn) StreamTransform() StreamTransform {
+	return nil
+}
@@ -0,0 +1,117 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnDeadline(t *testing.T) {
+	t.Run("read-deadline", func(t *testing.T) {
+		testConnDeadline(t, false)
+	})
+	t.Run("clear-read-deadline", func(t *testing.T) {
+		testConnDeadline(t, true)
+	})
+	t.Run("write-deadline", testConnWriteDeadline)
+}
+
+type testConnDeadlineServer struct {
+	testBaseServer
+	tester  *testing.T
+	clear   bool
+	opened  time.Time
+	closeCh chan error
+}
+
+func (s *testConnDeadlineServer) OnOpen(c Conn) (out []byte, action Action) {
+	s.opened = time.Now()
+	assert.NoError(s.tester, c.SetReadDeadline(s.opened.Add(300*time.Millisecond)))
+	return
+}
+
+func (s *testConnDeadlineServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	if s.clear {
+		assert.NoError(s.tester, c.SetReadDeadline(time.Time{}))
+	}
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testConnDeadlineServer) OnClose(_ Conn, err error) (action Action) {
+	s.closeCh <- err
+	return
+}
+
+type testConnWriteDeadlineServer struct {
+	testBaseServer
+	closeCh chan error
+}
+
+func (s *testConnWriteDeadlineServer) OnOpen(c Conn) (out []byte, action Action) {
+	_ = c.SetWriteDeadline(time.Now().Add(300 * time.Millisecond))
+	// The client never reads, so most of the data will be stuck in the outbound buffer.
+	_, _ = c.Write(make([]byte, 16*1024*1024))
+	return
+}
+
+func (s *testConnWriteDeadlineServer) OnClose(_ Conn, err error) (action Action) {
+	s.closeCh <- err
+	return
+}
+
+func testConnWriteDeadline(t *testing.T) {
+	s := &testConnWriteDeadlineServer{closeCh: make(chan error, 1)}
+	addr := runTestServer(t, s, "tcp", WithSocketSendBuffer(4*1024))
+
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+
+	select {
+	case err = <-s.closeCh:
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		var opErr *net.OpError
+		require.ErrorAs(t, err, &opErr)
+		assert.Equal(t, "write", opErr.Op)
+	case <-time.After(2 * time.Second):
+		require.Fail(t, "connection should have been closed by the write deadline")
+	}
+}
+
+func testConnDeadline(t *testing.T, clear bool) {
+	s := &testConnDeadlineServer{tester: t, clear: clear, closeCh: make(chan error, 1)}
+	addr := runTestServer(t, s, "tcp")
+
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+
+	select {
+	case err = <-s.closeCh:
+		require.False(t, clear, "connection should not be closed after clearing the read deadline")
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		var netErr net.Error
+		require.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+		assert.GreaterOrEqual(t, time.Since(s.opened), 300*time.Millisecond)
+		_, err = c.Read(buf)
+		assert.ErrorIs(t, err, io.EOF)
+	case <-time.After(time.Second):
+		require.True(t, clear, "connection should have been closed by the read deadline")
+	}
+}
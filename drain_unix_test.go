@@ -0,0 +1,132 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrain(t *testing.T) {
+	t.Run("flush", func(t *testing.T) {
+		s := &testDrainServer{closeCh: make(chan error, 1), size: 32 << 20}
+		addr := runTestServer(t, s, "tcp", WithDrainTimeout(5*time.Second))
+
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer c.Close()
+		_, err = c.Write([]byte("go"))
+		require.NoError(t, err)
+		// Wait for the data to pile up in the outbound buffer.
+		time.Sleep(200 * time.Millisecond)
+
+		stopCh := make(chan error, 1)
+		go func() { stopCh <- s.eng.Stop(context.Background()) }()
+		time.Sleep(200 * time.Millisecond)
+
+		// The listener has been closed while the existing connection is still being served.
+		_, err = net.Dial("tcp", addr)
+		assert.Error(t, err, "engine should stop accepting connections during draining")
+
+		buf := make([]byte, s.size)
+		_, err = io.ReadFull(c, buf)
+		require.NoError(t, err)
+		for i, b := range buf {
+			if b != byte(i) {
+				require.Failf(t, "data mismatch", "unexpected byte at %d", i)
+			}
+		}
+		_, err = c.Read(buf[:1])
+		assert.ErrorIs(t, err, io.EOF)
+
+		require.NoError(t, <-stopCh)
+		require.NoError(t, <-s.errCh)
+	})
+
+	t.Run("udp", func(t *testing.T) {
+		s := &testDrainServer{closeCh: make(chan error, 1), size: 32 << 20}
+		startTestServer(t, s, []string{"tcp://127.0.0.1:0", "udp://127.0.0.1:0"}, WithDrainTimeout(5*time.Second))
+
+		c, err := net.Dial("tcp", s.addr("tcp"))
+		require.NoError(t, err)
+		defer c.Close()
+		_, err = c.Write([]byte("go"))
+		require.NoError(t, err)
+		time.Sleep(200 * time.Millisecond)
+
+		udpAddr := s.addr("udp")
+		stopCh := make(chan error, 1)
+		go func() { stopCh <- s.eng.Stop(context.Background()) }()
+		time.Sleep(200 * time.Millisecond)
+
+		// The UDP socket is still served while the TCP connection is being drained.
+		uc, err := net.Dial("udp", udpAddr)
+		require.NoError(t, err)
+		defer uc.Close()
+		_, err = uc.Write([]byte("ping"))
+		require.NoError(t, err)
+		expectRead(t, uc, "ping")
+
+		_, err = io.ReadFull(c, make([]byte, s.size))
+		require.NoError(t, err)
+		require.NoError(t, <-stopCh)
+		require.NoError(t, <-s.errCh)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		s := &testDrainServer{closeCh: make(chan error, 1), size: 32 << 20}
+		addr := runTestServer(t, s, "tcp", WithDrainTimeout(time.Second))
+
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer c.Close()
+		_, err = c.Write([]byte("go"))
+		require.NoError(t, err)
+		time.Sleep(200 * time.Millisecond)
+
+		// The client never reads, so the connection is closed forcibly when the drain timeout expires.
+		start := time.Now()
+		require.NoError(t, s.eng.Stop(context.Background()))
+		assert.GreaterOrEqual(t, time.Since(start), time.Second)
+		assert.Less(t, time.Since(start), 3*time.Second)
+		select {
+		case <-s.closeCh:
+		case <-time.After(time.Second):
+			require.Fail(t, "connection should have been closed after draining")
+		}
+		require.NoError(t, <-s.errCh)
+	})
+}
+
+type testDrainServer struct {
+	testBaseServer
+	size    int
+	closeCh chan error
+}
+
+func (s *testDrainServer) OnTraffic(c Conn) (action Action) {
+	if _, ok := c.LocalAddr().(*net.UDPAddr); ok {
+		buf, _ := c.Next(-1)
+		_, _ = c.Write(buf)
+		return
+	}
+	_, _ = c.Discard(-1)
+	data := make([]byte, s.size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	_, _ = c.Write(data)
+	return
+}
+
+func (s *testDrainServer) OnClose(_ Conn, err error) (action Action) {
+	s.closeCh <- err
+	return
+}
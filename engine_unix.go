@@ -19,27 +19,38 @@ package gnet
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
 	"github.com/panjf2000/gnet/v2/internal/gfd"
 	"github.com/panjf2000/gnet/v2/internal/netpoll"
 	"github.com/panjf2000/gnet/v2/internal/queue"
+	"github.com/panjf2000/gnet/v2/internal/ratelimit"
+	"github.com/panjf2000/gnet/v2/internal/timingwheel"
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
-	"github.com/panjf2000/gnet/v2/pkg/logging"
 )
 
 type engine struct {
-	listeners  map[int]*listener // listeners for accepting incoming connections
-	opts       *Options          // options with engine
-	ingress    *eventloop        // main event-loop that monitors all listeners
-	eventLoops loadBalancer      // event-loops for handling events
-	inShutdown int32             // whether the engine is in shutdown
+	listeners  map[int]*listener             // listeners for accepting incoming connections, one for each address
+	lnMu       sync.RWMutex                  // guards listeners
+	opts       *Options                      // options with engine
+	ingress    *eventloop                    // main event-loop that monitors all listeners
+	eventLoops loadBalancer                  // event-loops for handling events
+	inShutdown int32                         // whether the engine is in shutdown
+	inDrain    int32                         // whether the engine is draining connections
+	inherited  *inheritance                  // listeners inherited from another process
+	keyMu      sync.RWMutex                  // guards keys
+	keys       map[string]map[*conn]struct{} // connections indexed by the keys bound to them
+	admission  admission                     // accepted connections counted against the connection limits
+	ipFilter   atomic.Pointer[ipFilter]      // filter of peers by IP addresses, nil if there is none
+	tlsConfig  atomic.Pointer[tls.Config]    // TLS configuration of the new connections, nil if TLS is disabled
 	ticker     struct {
 		ctx    context.Context    // context for ticker
 		cancel context.CancelFunc // function to stop the ticker
@@ -69,6 +80,52 @@ func (eng *engine) shutdown(err error) {
 	})
 }
 
+// bind adds c to the index of key.
+func (eng *engine) bind(c *conn, key string) {
+	eng.keyMu.Lock()
+	conns, ok := eng.keys[key]
+	if !ok {
+		if eng.keys == nil {
+			eng.keys = make(map[string]map[*conn]struct{})
+		}
+		conns = make(map[*conn]struct{})
+		eng.keys[key] = conns
+	}
+	conns[c] = struct{}{}
+	eng.keyMu.Unlock()
+}
+
+// unbind removes c from the index of key.
+func (eng *engine) unbind(c *conn, key string) {
+	eng.keyMu.Lock()
+	conns := eng.keys[key]
+	delete(conns, c)
+	if len(conns) == 0 {
+		delete(eng.keys, key)
+	}
+	eng.keyMu.Unlock()
+}
+
+// connsOf returns the connections bound to key, grouped by the event-loops they belong to.
+func (eng *engine) connsOf(key string) map[*eventloop][]*conn {
+	eng.keyMu.RLock()
+	defer eng.keyMu.RUnlock()
+	conns := eng.keys[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	loops := make(map[*eventloop][]*conn)
+	for c := range conns {
+		loops[c.loop] = append(loops[c.loop], c)
+	}
+	return loops
+}
+
+// isClient reports whether the engine is driven by a Client.
+func (eng *engine) isClient() bool {
+	return eng.eventLoops == nil
+}
+
 func (eng *engine) closeEventLoops() {
 	eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
 		for _, ln := range el.listeners {
@@ -77,8 +134,13 @@ func (eng *engine) closeEventLoops() {
 		_ = el.poller.Close()
 		return true
 	})
+	eng.lnMu.RLock()
+	for _, ln := range eng.listeners {
+		ln.close()
+	}
+	eng.lnMu.RUnlock()
 	if eng.ingress != nil {
-		for _, ln := range eng.listeners {
+		for _, ln := range eng.ingress.listeners {
 			ln.close()
 		}
 		err := eng.ingress.poller.Close()
@@ -90,20 +152,26 @@ func (eng *engine) closeEventLoops() {
 
 func (eng *engine) runEventLoops(numEventLoop int) error {
 	var el0 *eventloop
-	lns := eng.listeners
 	// Create loops locally and bind the listeners.
 	for i := 0; i < numEventLoop; i++ {
-		if i > 0 {
-			lns = make(map[int]*listener, len(eng.listeners))
+		lns := make(map[int]*listener, len(eng.listeners))
+		if i == 0 {
+			for fd, ln := range eng.listeners {
+				lns[fd] = ln
+			}
+		} else {
 			for _, l := range eng.listeners {
-				ln, err := initListener(l.network, l.address, eng.opts)
-				if err != nil {
-					return err
+				ln := eng.inherited.take(l.network, l.address)
+				if ln == nil {
+					var err error
+					if ln, err = initListener(l.network, l.address, eng.opts); err != nil {
+						return err
+					}
 				}
 				lns[ln.fd] = ln
 			}
 		}
-		p, err := netpoll.OpenPoller()
+		p, err := netpoll.OpenPoller(eng.opts.Logger)
 		if err != nil {
 			return err
 		}
@@ -114,6 +182,7 @@ func (eng *engine) runEventLoops(numEventLoop int) error {
 		el.buffer = make([]byte, eng.opts.ReadBufferCap)
 		el.connections.init()
 		el.eventHandler = eng.eventHandler
+		el.timers = timingwheel.New(timingWheelTick, timingWheelSlots)
 		for _, ln := range lns {
 			if err = el.poller.AddRead(ln.packPollAttachment(el.accept), false); err != nil {
 				return err
@@ -127,9 +196,20 @@ func (eng *engine) runEventLoops(numEventLoop int) error {
 		}
 	}
 
+	// Spread the rest of inherited listeners over event-loops if the previous owner
+	// had more event-loops than this engine.
+	for i, ln := range eng.inheritedRest() {
+		el := eng.eventLoops.index(i % numEventLoop)
+		el.listeners[ln.fd] = ln
+		if err := el.poller.AddRead(ln.packPollAttachment(el.accept), false); err != nil {
+			return err
+		}
+	}
+
 	// Start event-loops in background.
 	eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
 		eng.workerPool.Go(el.run)
+		eng.startTimers(el)
 		return true
 	})
 
@@ -145,37 +225,44 @@ func (eng *engine) runEventLoops(numEventLoop int) error {
 
 func (eng *engine) activateReactors(numEventLoop int) error {
 	for i := 0; i < numEventLoop; i++ {
-		p, err := netpoll.OpenPoller()
+		p, err := netpoll.OpenPoller(eng.opts.Logger)
 		if err != nil {
 			return err
 		}
 		el := new(eventloop)
-		el.listeners = eng.listeners
 		el.engine = eng
 		el.poller = p
 		el.buffer = make([]byte, eng.opts.ReadBufferCap)
 		el.connections.init()
 		el.eventHandler = eng.eventHandler
+		el.timers = timingwheel.New(timingWheelTick, timingWheelSlots)
 		eng.eventLoops.register(el)
 	}
 
 	// Start sub reactors in background.
 	eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
 		eng.workerPool.Go(el.orbit)
+		eng.startTimers(el)
 		return true
 	})
 
-	p, err := netpoll.OpenPoller()
+	p, err := netpoll.OpenPoller(eng.opts.Logger)
 	if err != nil {
 		return err
 	}
 	el := new(eventloop)
-	el.listeners = eng.listeners
+	el.listeners = make(map[int]*listener, len(eng.listeners))
 	el.idx = -1
 	el.engine = eng
 	el.poller = p
 	el.eventHandler = eng.eventHandler
-	for _, ln := range eng.listeners {
+	for fd, ln := range eng.listeners {
+		el.listeners[fd] = ln
+	}
+	for _, ln := range eng.inheritedRest() {
+		el.listeners[ln.fd] = ln
+	}
+	for _, ln := range el.listeners {
 		if err = el.poller.AddRead(ln.packPollAttachment(el.accept0), true); err != nil {
 			return err
 		}
@@ -196,6 +283,264 @@ func (eng *engine) activateReactors(numEventLoop int) error {
 	return nil
 }
 
+// inheritedRest takes the inherited listeners that haven't been taken yet
+// and have the same addresses as the listeners of this engine.
+func (eng *engine) inheritedRest() (lns []*listener) {
+	if eng.inherited == nil {
+		return
+	}
+	for _, l := range eng.listeners {
+		lns = append(lns, eng.inherited.takeAll(l.network, l.address)...)
+	}
+	return
+}
+
+// addListener creates the listeners on the given address and puts them into
+// the event-loops that are responsible for accepting connections.
+func (eng *engine) addListener(network, address string) error {
+	eng.lnMu.Lock()
+	defer eng.lnMu.Unlock()
+
+	key := listenerKey(network, address)
+	for _, ln := range eng.listeners {
+		if ln.key() == key {
+			return errorx.ErrListenerExists
+		}
+	}
+	isUDP := strings.HasPrefix(network, "udp")
+	if isUDP && !eng.opts.ReusePort {
+		return errorx.ErrUnsupportedOp
+	}
+
+	var (
+		owners []*eventloop
+		lns    []*listener
+	)
+	if eng.ingress != nil {
+		owners = append(owners, eng.ingress)
+	} else {
+		eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+			owners = append(owners, el)
+			// SO_REUSEPORT is not supported for Unix domain sockets.
+			return network != "unix"
+		})
+	}
+	closeAll := func() {
+		for _, ln := range lns {
+			ln.close()
+		}
+	}
+	for range owners {
+		ln, err := initListener(network, address, eng.opts)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		lns = append(lns, ln)
+	}
+
+	for i, el := range owners {
+		el, ln := el, lns[i]
+		accept := el.accept
+		if el == eng.ingress {
+			accept = el.accept0
+		}
+		err := el.execSync(func() error {
+			if err := el.poller.AddRead(ln.packPollAttachment(accept), el == eng.ingress); err != nil {
+				return err
+			}
+			el.listeners[ln.fd] = ln
+			return nil
+		})
+		if err != nil {
+			// Roll back the listeners that have been put into event-loops.
+			for j := 0; j < i; j++ {
+				_ = owners[j].execSync(func() error {
+					return owners[j].deleteListener(lns[j])
+				})
+			}
+			closeAll()
+			return err
+		}
+	}
+	eng.listeners[lns[0].fd] = lns[0]
+	eng.opts.Logger.Infof("gnet engine started listening on %s", key)
+	return nil
+}
+
+// removeListener closes the listeners on the given address and removes them
+// from the event-loops that are responsible for accepting connections.
+func (eng *engine) removeListener(network, address string) error {
+	eng.lnMu.Lock()
+	defer eng.lnMu.Unlock()
+
+	key := listenerKey(network, address)
+	var found *listener
+	for _, ln := range eng.listeners {
+		if ln.key() == key {
+			found = ln
+			break
+		}
+	}
+	if found == nil {
+		return errorx.ErrListenerNotFound
+	}
+	if len(eng.listeners) == 1 {
+		return errorx.ErrUnsupportedOp
+	}
+
+	remove := func(el *eventloop) {
+		err := el.execSync(func() error {
+			for _, ln := range el.listeners {
+				if ln.key() == key {
+					if err := el.deleteListener(ln); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			eng.opts.Logger.Errorf("failed to remove listener(%s) from event-loop(%d): %v", key, el.idx, err)
+		}
+	}
+	if eng.ingress != nil {
+		remove(eng.ingress)
+	} else {
+		eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+			remove(el)
+			return true
+		})
+	}
+	delete(eng.listeners, found.fd)
+	found.close()
+	eng.opts.Logger.Infof("gnet engine stopped listening on %s", key)
+	return nil
+}
+
+// startTimers starts driving the timers of the given event-loop in background,
+// it stops along with the engine.
+func (eng *engine) startTimers(el *eventloop) {
+	eng.workerPool.Go(func() error {
+		el.runTimers(eng.workerPool.shutdownCtx)
+		return nil
+	})
+}
+
+// drain stops accepting new stream-oriented connections and waits for the existing connections to
+// flush their pending outbound data, until the drain timeout (if any) or ctx is done.
+func (eng *engine) drain(ctx context.Context) {
+	if !atomic.CompareAndSwapInt32(&eng.inDrain, 0, 1) {
+		return
+	}
+
+	if eng.opts.DrainTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, eng.opts.DrainTimeout)
+		defer cancel()
+	}
+
+	eng.stopAccepting()
+	eng.opts.Logger.Infof("gnet engine stopped accepting new connections, draining connections")
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		conns, pending, err := eng.pendingOutbound(ctx)
+		if err != nil {
+			eng.opts.Logger.Warnf("gnet engine failed to drain connections: %v", err)
+			return
+		}
+		if pending == 0 {
+			eng.opts.Logger.Infof("gnet engine has drained all connections")
+			return
+		}
+		eng.opts.Logger.Debugf("gnet engine is draining, %d connections have %d bytes pending", conns, pending)
+
+		select {
+		case <-ctx.Done():
+			eng.opts.Logger.Warnf("gnet engine failed to drain %d connections with %d bytes pending: %v",
+				conns, pending, ctx.Err())
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stopAccepting removes the stream-oriented listeners from the event-loops monitoring them and closes them,
+// the UDP sockets keep serving the datagrams until the engine shuts down since they accept no connections.
+func (eng *engine) stopAccepting() {
+	stop := func(el *eventloop) {
+		err := el.poller.Trigger(queue.HighPriority, func(_ any) error {
+			for _, ln := range el.listeners {
+				if ln.network == "udp" {
+					continue
+				}
+				if err := el.deleteListener(ln); err != nil {
+					eng.opts.Logger.Errorf("failed to remove listener(%s) from poller: %v", ln.key(), err)
+				}
+			}
+			return nil
+		}, nil)
+		if err != nil {
+			eng.opts.Logger.Errorf("failed to enqueue the task of closing listeners for event-loop(%d): %v", el.idx, err)
+		}
+	}
+
+	if eng.ingress != nil {
+		stop(eng.ingress)
+		return
+	}
+	eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+		stop(el)
+		return true
+	})
+}
+
+// pendingOutbound returns the number of connections that have pending outbound data
+// and the total bytes of it. The check is done by low-priority tasks so that the tasks
+// enqueued before it, such as asynchronous writes, have been processed by then.
+func (eng *engine) pendingOutbound(ctx context.Context) (conns, pending int, err error) {
+	type result struct{ conns, pending int }
+	var n int
+	results := make(chan result, eng.eventLoops.len())
+	eng.eventLoops.iterate(func(i int, el *eventloop) bool {
+		err = el.poller.Trigger(queue.LowPriority, func(_ any) error {
+			var r result
+			el.connections.iterate(func(c *conn) bool {
+				if !c.isDatagram && !c.outboundBuffer.IsEmpty() {
+					r.conns++
+					r.pending += c.outboundBuffer.Buffered()
+				}
+				return true
+			})
+			results <- r
+			return nil
+		}, nil)
+		if err != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if err != nil {
+		return
+	}
+
+	for ; n > 0; n-- {
+		select {
+		case r := <-results:
+			conns += r.conns
+			pending += r.pending
+		case <-ctx.Done():
+			return 0, 0, ctx.Err()
+		case <-eng.workerPool.shutdownCtx.Done():
+			return 0, 0, errorx.ErrEngineShutdown
+		}
+	}
+	return
+}
+
 func (eng *engine) start(numEventLoop int) error {
 	if eng.opts.ReusePort {
 		return eng.runEventLoops(numEventLoop)
@@ -241,7 +586,7 @@ func (eng *engine) stop(s Engine) {
 	atomic.StoreInt32(&eng.inShutdown, 1)
 }
 
-func run(eventHandler EventHandler, listeners []*listener, options *Options, addrs []string) error {
+func run(eventHandler EventHandler, listeners []*listener, options *Options, addrs []string, ih *inheritance) error {
 	// Figure out the proper number of event-loop to run.
 	numEventLoop := 1
 	if options.Multicore {
@@ -254,9 +599,14 @@ func run(eventHandler EventHandler, listeners []*listener, options *Options, add
 		numEventLoop = gfd.EventLoopIndexMax
 	}
 
-	logging.Infof("Launching gnet with %d event-loops, listening on: %s",
+	options.Logger.Infof("Launching gnet with %d event-loops, listening on: %s",
 		numEventLoop, strings.Join(addrs, " | "))
 
+	f, err := newIPFilter(options.AllowList, options.DenyList)
+	if err != nil {
+		return err
+	}
+
 	lns := make(map[int]*listener, len(listeners))
 	for _, ln := range listeners {
 		lns[ln.fd] = ln
@@ -272,6 +622,12 @@ func run(eventHandler EventHandler, listeners []*listener, options *Options, add
 			once        sync.Once
 		}{&errgroup.Group{}, shutdownCtx, shutdown, sync.Once{}},
 		eventHandler: eventHandler,
+		inherited:    ih,
+	}
+	eng.ipFilter.Store(f)
+	eng.tlsConfig.Store(options.TLSConfig)
+	if options.AcceptRate > 0 {
+		eng.admission.limiter = ratelimit.NewLimiter(options.AcceptRate, options.AcceptBurst, time.Now())
 	}
 	switch options.LB {
 	case RoundRobin:
@@ -300,6 +656,10 @@ func run(eventHandler EventHandler, listeners []*listener, options *Options, add
 	}
 	defer eng.stop(e)
 
+	// Tell the previous owner of listeners to step down.
+	eng.inherited.ack()
+	eng.inherited.close()
+
 	for _, addr := range addrs {
 		allEngines.Store(addr, &eng)
 	}
@@ -307,18 +667,17 @@ func run(eventHandler EventHandler, listeners []*listener, options *Options, add
 	return nil
 }
 
-/*
-func (eng *engine) sendCmd(cmd *asyncCmd, urgent bool) error {
-	if !gfd.Validate(cmd.fd) {
-		return errors.ErrInvalidConn
+// sendCmd dispatches cmd to the event-loop that the connection of cmd.fd belongs to.
+func (eng *engine) sendCmd(cmd *asyncCmd) error {
+	if !cmd.fd.Validate() {
+		return errorx.ErrInvalidConn
 	}
 	el := eng.eventLoops.index(cmd.fd.EventLoopIndex())
 	if el == nil {
-		return errors.ErrInvalidConn
-	}
-	if urgent {
-		return el.poller.Trigger(queue.LowPriority, el.execCmd, cmd)
+		return errorx.ErrInvalidConn
 	}
-	return el.poller.Trigger(el.execCmd, cmd)
+	// All commands are queued with the same priority as Conn.AsyncWrite, so that the commands
+	// to a connection are executed in the order of being sent, e.g. the data written before
+	// Close is flushed and a write sent after Close fails.
+	return el.poller.Trigger(queue.HighPriority, el.execCmd, cmd)
 }
-*/
@@ -16,7 +16,9 @@ package gnet
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"net/netip"
 	"runtime"
 	"strings"
 	"sync"
@@ -25,11 +27,11 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
-	"github.com/panjf2000/gnet/v2/pkg/logging"
 )
 
 type engine struct {
 	listeners  []*listener
+	lnMu       sync.RWMutex // guards listeners
 	opts       *Options     // options with engine
 	eventLoops loadBalancer // event-loops for handling events
 	ticker     struct {
@@ -61,6 +63,21 @@ func (eng *engine) shutdown(err error) {
 	atomic.StoreInt32(&eng.beingShutdown, 1)
 }
 
+// addListener is not supported on Windows.
+func (eng *engine) addListener(_, _ string) error {
+	return errorx.ErrUnsupportedOp
+}
+
+// removeListener is not supported on Windows.
+func (eng *engine) removeListener(_, _ string) error {
+	return errorx.ErrUnsupportedOp
+}
+
+// drain is not supported on Windows, connections are closed right away.
+func (eng *engine) drain(_ context.Context) {
+	eng.opts.Logger.Warnf("draining connections is not supported on Windows")
+}
+
 func (eng *engine) closeEventLoops() {
 	eng.eventLoops.iterate(func(i int, el *eventloop) bool {
 		el.ch <- errorx.ErrEngineShutdown
@@ -126,7 +143,7 @@ func (eng *engine) stop(engine Engine) error {
 	return nil
 }
 
-func run(eventHandler EventHandler, listeners []*listener, options *Options, addrs []string) error {
+func run(eventHandler EventHandler, listeners []*listener, options *Options, addrs []string, _ *inheritance) error {
 	// Figure out the proper number of event-loops/goroutines to run.
 	numEventLoop := 1
 	if options.Multicore {
@@ -136,7 +153,7 @@ func run(eventHandler EventHandler, listeners []*listener, options *Options, add
 		numEventLoop = options.NumEventLoop
 	}
 
-	logging.Infof("Launching gnet with %d event-loops, listening on: %s",
+	options.Logger.Infof("Launching gnet with %d event-loops, listening on: %s",
 		numEventLoop, strings.Join(addrs, " | "))
 
 	shutdownCtx, shutdown := context.WithCancel(context.Background())
@@ -190,8 +207,21 @@ func run(eventHandler EventHandler, listeners []*listener, options *Options, add
 	return nil
 }
 
-/*
-func (eng *engine) sendCmd(_ *asyncCmd, _ bool) error {
+func (eng *engine) sendCmd(_ *asyncCmd) error {
+	return errorx.ErrUnsupportedOp
+}
+
+// AdmissionStats is not supported on Windows, the connection limits are not applied.
+func (e Engine) AdmissionStats() (stats AdmissionStats) {
+	return
+}
+
+// SetTLSConfig is not supported on Windows.
+func (e Engine) SetTLSConfig(_ *tls.Config) error {
+	return errorx.ErrUnsupportedOp
+}
+
+// SetIPFilter is not supported on Windows.
+func (e Engine) SetIPFilter(_, _ []netip.Prefix) error {
 	return errorx.ErrUnsupportedOp
 }
-*/
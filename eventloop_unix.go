@@ -23,7 +23,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sys/unix"
@@ -31,19 +34,99 @@ import (
 	gio "github.com/panjf2000/gnet/v2/internal/io"
 	"github.com/panjf2000/gnet/v2/internal/netpoll"
 	"github.com/panjf2000/gnet/v2/internal/queue"
+	"github.com/panjf2000/gnet/v2/internal/timingwheel"
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
 	"github.com/panjf2000/gnet/v2/pkg/logging"
 )
 
 type eventloop struct {
-	listeners    map[int]*listener // listeners
-	idx          int               // loop index in the engine loops list
-	engine       *engine           // engine in loop
-	poller       *netpoll.Poller   // epoll or kqueue
-	buffer       []byte            // read packet buffer whose capacity is set by user, default value is 64KB
-	connections  connMatrix        // loop connections storage
-	eventHandler EventHandler      // user eventHandler
-	next         uint16
+	listeners     map[int]*listener             // listeners
+	idx           int                           // loop index in the engine loops list
+	engine        *engine                       // engine in loop
+	poller        *netpoll.Poller               // epoll or kqueue
+	buffer        []byte                        // read packet buffer whose capacity is set by user, default value is 64KB
+	connections   connMatrix                    // loop connections storage
+	eventHandler  EventHandler                  // user eventHandler
+	timers        *timingwheel.Wheel            // timers of connections, e.g. deadlines
+	timersPending int32                         // whether a task of advancing timers is pending in the poller
+	handshakes    int32                         // number of TLS handshakes in progress, accessed atomically
+	lastSeq       uint64                        // sequence number of the latest connection, accessed atomically
+	idMu          sync.RWMutex                  // protects ids
+	ids           map[int64]*conn               // alive connections indexed by their IDs
+	groups        map[string]map[*conn]struct{} // members of connection groups in the event-loop
+}
+
+const (
+	// timingWheelTick is the resolution of the timers in each event-loop.
+	timingWheelTick = 100 * time.Millisecond
+
+	// timingWheelSlots is the number of slots in the timing wheel of each event-loop,
+	// which makes one revolution of the wheel last for about 51 seconds.
+	timingWheelSlots = 512
+)
+
+// connIdSeqBits is the number of the low bits of a connection ID that hold the sequence number
+// of the connection in its event-loop, the high bits hold the index of the event-loop.
+// The sequence number doesn't wrap until 2^48 connections have been created in an event-loop,
+// which takes about 9 years at the rate of a million connections per second.
+const connIdSeqBits = 48
+
+// nextConnId generates the ID for a new connection of the event-loop.
+func (el *eventloop) nextConnId() int64 {
+	seq := atomic.AddUint64(&el.lastSeq, 1) & (1<<connIdSeqBits - 1)
+	return int64(el.idx)<<connIdSeqBits | int64(seq)
+}
+
+// lookupConn returns the alive connection of connId, it's concurrency-safe.
+func (el *eventloop) lookupConn(connId int64) *conn {
+	el.idMu.RLock()
+	c := el.ids[connId]
+	el.idMu.RUnlock()
+	return c
+}
+
+func (el *eventloop) addConnId(c *conn) {
+	el.idMu.Lock()
+	if el.ids == nil {
+		el.ids = make(map[int64]*conn)
+	}
+	el.ids[c.connId] = c
+	el.idMu.Unlock()
+}
+
+func (el *eventloop) delConnId(c *conn) {
+	el.idMu.Lock()
+	delete(el.ids, c.connId)
+	el.idMu.Unlock()
+}
+
+func (el *eventloop) join(c *conn, group string) {
+	members, ok := el.groups[group]
+	if !ok {
+		if el.groups == nil {
+			el.groups = make(map[string]map[*conn]struct{})
+		}
+		members = make(map[*conn]struct{})
+		el.groups[group] = members
+	}
+	members[c] = struct{}{}
+}
+
+func (el *eventloop) leave(c *conn, group string) {
+	members := el.groups[group]
+	delete(members, c)
+	if len(members) == 0 {
+		delete(el.groups, group)
+	}
+}
+
+// broadcast writes data to all members of the group in the event-loop.
+func (el *eventloop) broadcast(group string, data []byte) {
+	for c := range el.groups[group] {
+		if c.opened {
+			_ = c.push(data)
+		}
+	}
 }
 
 func (el *eventloop) getLogger() logging.Logger {
@@ -67,6 +150,39 @@ type connWithCallback struct {
 	cb func()
 }
 
+// execSync runs fn on the event-loop and waits for it to return.
+func (el *eventloop) execSync(fn func() error) error {
+	errCh := make(chan error, 1)
+	err := el.poller.Trigger(queue.HighPriority, func(_ any) error {
+		errCh <- fn()
+		return nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+	select {
+	case err = <-errCh:
+		return err
+	case <-el.engine.workerPool.shutdownCtx.Done():
+		return errorx.ErrEngineShutdown
+	}
+}
+
+// deleteListener stops the event-loop from monitoring the listener and closes it.
+func (el *eventloop) deleteListener(ln *listener) error {
+	delete(el.listeners, ln.fd)
+	var err error
+	if ln.throttle != nil {
+		// The throttled listener is not being watched.
+		ln.throttle.Stop()
+		ln.throttle = nil
+	} else {
+		err = el.poller.Delete(ln.fd)
+	}
+	ln.close()
+	return err
+}
+
 func (el *eventloop) register(a any) error {
 	c, ok := a.(*conn)
 	if !ok {
@@ -88,14 +204,68 @@ func (el *eventloop) register0(c *conn) error {
 		return err
 	}
 	el.connections.addConn(c, el.idx)
+	el.addConnId(c)
 	if c.isDatagram && c.remote != nil {
 		return nil
 	}
+	if c.proxyPending {
+		el.awaitProxyHeader(c)
+		return nil
+	}
+	if c.transformPending {
+		el.awaitTransform(c)
+		return nil
+	}
+	if c.tls != nil {
+		return el.startHandshake(c)
+	}
 	return el.open(c)
 }
 
+// recoverPanic recovers the panic of the callbacks invoked by the event-loop and closes c
+// if Options.PanicRecovery is enabled, otherwise it leaves the panic propagating.
+// It must be called directly by a deferred function.
+func (el *eventloop) recoverPanic(c *conn) {
+	if !el.engine.opts.PanicRecovery {
+		return
+	}
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	if c != nil {
+		el.getLogger().Errorf("recovered from a panic on connection(fd=%d, remote=%v) in event-loop(%d): %v\n%s",
+			c.fd, c.remoteAddr, el.idx, v, debug.Stack())
+	} else {
+		el.getLogger().Errorf("recovered from a panic in event-loop(%d): %v\n%s", el.idx, v, debug.Stack())
+	}
+	if h, ok := el.eventHandler.(PanicHandler); ok {
+		func() {
+			defer func() {
+				if v := recover(); v != nil {
+					el.getLogger().Errorf("recovered from a panic in OnPanic of event-loop(%d): %v", el.idx, v)
+				}
+			}()
+			if c != nil {
+				h.OnPanic(c, v)
+			} else {
+				h.OnPanic(nil, v)
+			}
+		}()
+	}
+	if c != nil {
+		if err := el.close(c, fmt.Errorf("%w: %v", errorx.ErrPanicRecovered, v)); err != nil {
+			el.getLogger().Errorf("failed to close connection(fd=%d) after panic in event-loop(%d): %v", c.fd, el.idx, err)
+		}
+	}
+}
+
 func (el *eventloop) open(c *conn) error {
+	defer el.recoverPanic(c)
+
 	c.opened = true
+	c.armIdle()
 
 	out, action := el.eventHandler.OnOpen(c)
 	if out != nil {
@@ -105,7 +275,7 @@ func (el *eventloop) open(c *conn) error {
 	}
 
 	if !c.outboundBuffer.IsEmpty() && !el.engine.opts.EdgeTriggeredIO {
-		if err := el.poller.ModReadWrite(&c.pollAttachment, false); err != nil {
+		if err := c.watchWrite(); err != nil {
 			return err
 		}
 	}
@@ -118,10 +288,21 @@ func (el *eventloop) read0(a any) error {
 }
 
 func (el *eventloop) read(c *conn) error {
-	if !c.opened {
+	if c.proxyPending {
+		return el.readProxyHeader(c)
+	}
+	if c.transformPending {
+		return el.readTransformHeader(c)
+	}
+	if c.handshaking() {
+		return el.readHandshake(c)
+	}
+	if !c.opened || c.isReadPaused() {
 		return nil
 	}
 
+	defer el.recoverPanic(c)
+
 	var recv int
 	isET := el.engine.opts.EdgeTriggeredIO
 	chunk := el.engine.opts.EdgeTriggeredIOChunk
@@ -137,20 +318,31 @@ loop:
 		return el.close(c, os.NewSyscallError("read", err))
 	}
 	recv += n
+	c.touch()
+	if c.transform != nil {
+		c.transform.Inbound(el.buffer[:n])
+	}
 
-	c.buffer = el.buffer[:n]
-	action := el.eventHandler.OnTraffic(c)
-	switch action {
-	case None:
-	case Close:
-		return el.close(c, nil)
-	case Shutdown:
-		return errorx.ErrEngineShutdown
+	if c.tls != nil {
+		c.tls.transport.feed(el.buffer[:n])
+		if err = el.decrypt(c); err != nil || !c.opened {
+			return err
+		}
+	} else {
+		c.buffer = el.buffer[:n]
+		action := el.eventHandler.OnTraffic(c)
+		switch action {
+		case None:
+		case Close:
+			return el.close(c, nil)
+		case Shutdown:
+			return errorx.ErrEngineShutdown
+		}
+		_, _ = c.inboundBuffer.Write(c.buffer)
+		c.buffer = c.buffer[:0]
 	}
-	_, _ = c.inboundBuffer.Write(c.buffer)
-	c.buffer = c.buffer[:0]
 
-	if c.isEOF || (isET && recv < chunk) {
+	if (c.isEOF || (isET && recv < chunk)) && !c.isReadPaused() {
 		goto loop
 	}
 
@@ -203,6 +395,15 @@ loop:
 		return el.close(c, os.NewSyscallError("write", err))
 	}
 	sent += n
+	c.touch()
+
+	if c.drained() {
+		if h, ok := el.eventHandler.(WritableHandler); ok {
+			if action := c.onWritable(h); action != None || !c.opened {
+				return el.handleAction(c, action)
+			}
+		}
+	}
 
 	if isET && !c.outboundBuffer.IsEmpty() && sent < chunk {
 		goto loop
@@ -211,7 +412,7 @@ loop:
 	// All data have been sent, it's no need to monitor the writable events for LT mode,
 	// remove the writable event from poller to help the future event-loops if necessary.
 	if !isET && c.outboundBuffer.IsEmpty() {
-		return el.poller.ModRead(&c.pollAttachment, false)
+		return c.unwatchWrite()
 	}
 
 	// To prevent infinite writing in ET mode and starving other events,
@@ -226,25 +427,33 @@ loop:
 }
 
 func (el *eventloop) close(c *conn, err error) error {
+	if c.proxyPending || c.transformPending || c.handshaking() {
+		return el.abort(c)
+	}
 	if !c.opened || el.connections.getConn(c.fd) == nil {
 		return nil // ignore stale connections
 	}
 
 	el.connections.delConn(c)
-	action := el.eventHandler.OnClose(c, err)
-
-	// Send residual data in buffer back to the remote before actually closing the connection.
-	for !c.outboundBuffer.IsEmpty() {
-		iov, _ := c.outboundBuffer.Peek(0)
-		if len(iov) > iovMax {
-			iov = iov[:iovMax]
-		}
-		if n, e := gio.Writev(c.fd, iov); e != nil {
-			break
-		} else { //nolint:revive
-			_, _ = c.outboundBuffer.Discard(n)
-		}
+	el.delConnId(c)
+	for group := range c.groups {
+		el.leave(c, group)
+	}
+	c.groups = nil
+	for key := range c.keys {
+		el.engine.unbind(c, key)
 	}
+	c.keys = nil
+	el.timers.Stop(&c.deadlineTimer)
+	el.timers.Stop(&c.idleTimer)
+	action := el.onClose(c, err)
+
+	// Notify the remote of the closure of the TLS session, unless the socket has failed.
+	if c.tls != nil && c.tls.transport.err == nil {
+		_ = c.tls.conn.CloseWrite()
+	}
+	// Send residual data in buffer back to the remote before actually closing the connection.
+	c.writeResidual()
 
 	c.release()
 
@@ -268,10 +477,18 @@ func (el *eventloop) close(c *conn, err error) error {
 	return el.handleAction(c, action)
 }
 
+// onClose invokes OnClose, the connection has been removed from the event-loop at that point,
+// so a recovered panic leaves the rest of closing to the caller.
+func (el *eventloop) onClose(c *conn, err error) Action {
+	defer el.recoverPanic(c)
+	return el.eventHandler.OnClose(c, err)
+}
+
 func (el *eventloop) wake(c *conn) error {
 	if !c.opened || el.connections.getConn(c.fd) == nil {
 		return nil // ignore stale connections
 	}
+	defer el.recoverPanic(c)
 
 	action := el.eventHandler.OnTraffic(c)
 
@@ -290,7 +507,7 @@ func (el *eventloop) ticker(ctx context.Context) {
 		}
 	}()
 	for {
-		delay, action = el.eventHandler.OnTick()
+		delay, action = el.onTick()
 		switch action {
 		case None, Close:
 		case Shutdown:
@@ -313,6 +530,39 @@ func (el *eventloop) ticker(ctx context.Context) {
 	}
 }
 
+// onTick invokes OnTick, it's retried in a second if a panic is recovered from OnTick.
+func (el *eventloop) onTick() (delay time.Duration, action Action) {
+	delay = time.Second
+	defer el.recoverPanic(nil)
+	return el.eventHandler.OnTick()
+}
+
+// runTimers drives the timing wheel of the event-loop by enqueueing a task
+// on every tick as long as there are pending timers.
+func (el *eventloop) runTimers(ctx context.Context) {
+	ticker := time.NewTicker(timingWheelTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if el.timers.Len() == 0 || !atomic.CompareAndSwapInt32(&el.timersPending, 0, 1) {
+			continue
+		}
+		if err := el.poller.Trigger(queue.LowPriority, el.advanceTimers, nil); err != nil {
+			el.getLogger().Errorf("failed to enqueue the task of timers for event-loop(%d): %v", el.idx, err)
+			atomic.StoreInt32(&el.timersPending, 0)
+		}
+	}
+}
+
+func (el *eventloop) advanceTimers(_ any) error {
+	atomic.StoreInt32(&el.timersPending, 0)
+	return el.timers.Advance(time.Now())
+}
+
 func (el *eventloop) readUDP(fd int, _ netpoll.IOEvent, _ netpoll.IOFlags) error {
 	n, sa, err := unix.Recvfrom(fd, el.buffer, 0)
 	if err != nil {
@@ -324,12 +574,16 @@ func (el *eventloop) readUDP(fd int, _ netpoll.IOEvent, _ netpoll.IOFlags) error
 	}
 	var c *conn
 	if ln, ok := el.listeners[fd]; ok {
+		if !el.engine.permits(sa) {
+			el.engine.dropPacket()
+			return nil
+		}
 		c = newUDPConn(fd, el, ln.addr, sa, false)
 	} else {
 		c = el.connections.getConn(fd)
 	}
 	c.buffer = el.buffer[:n]
-	action := el.eventHandler.OnTraffic(c)
+	action := el.onTrafficUDP(c)
 	if c.remote != nil {
 		c.release()
 	}
@@ -339,6 +593,11 @@ func (el *eventloop) readUDP(fd int, _ netpoll.IOEvent, _ netpoll.IOFlags) error
 	return nil
 }
 
+func (el *eventloop) onTrafficUDP(c *conn) Action {
+	defer el.recoverPanic(c)
+	return el.eventHandler.OnTraffic(c)
+}
+
 func (el *eventloop) handleAction(c *conn, action Action) error {
 	switch action {
 	case None:
@@ -352,18 +611,19 @@ func (el *eventloop) handleAction(c *conn, action Action) error {
 	}
 }
 
-/*
 func (el *eventloop) execCmd(a any) (err error) {
 	cmd := a.(*asyncCmd)
 	c := el.connections.getConnByGFD(cmd.fd)
-	if c == nil || c.gfd != cmd.fd {
-		return errorx.ErrInvalidConn
+	if c == nil {
+		if cmd.cb != nil {
+			defer el.recoverPanic(nil)
+			_ = cmd.cb(nil, errorx.ErrInvalidConn)
+		}
+		return nil
 	}
 
 	defer func() {
-		if cmd.cb != nil {
-			_ = cmd.cb(c, err)
-		}
+		c.invokeCallback(cmd.cb, err)
 	}()
 
 	switch cmd.typ {
@@ -372,12 +632,11 @@ func (el *eventloop) execCmd(a any) (err error) {
 	case asyncCmdWake:
 		return el.wake(c)
 	case asyncCmdWrite:
-		_, err = c.Write(cmd.param.([]byte))
+		_, err = c.write(cmd.param.([]byte))
 	case asyncCmdWritev:
-		_, err = c.Writev(cmd.param.([][]byte))
+		_, err = c.writev(cmd.param.([][]byte))
 	default:
 		return errorx.ErrUnsupportedOp
 	}
 	return
 }
-*/
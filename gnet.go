@@ -16,6 +16,7 @@ package gnet
 
 import (
 	"context"
+	"crypto/tls"
 	"io"
 	"net"
 	"runtime"
@@ -23,10 +24,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/panjf2000/gnet/v2/internal/gfd"
 	"github.com/panjf2000/gnet/v2/internal/math"
 	"github.com/panjf2000/gnet/v2/pkg/buffer/ring"
 	"github.com/panjf2000/gnet/v2/pkg/errors"
 	"github.com/panjf2000/gnet/v2/pkg/logging"
+	"github.com/panjf2000/gnet/v2/pkg/proxyproto"
 )
 
 // Action is an action that occurs after the completion of an event.
@@ -51,7 +54,13 @@ type Engine struct {
 
 // Validate checks whether the engine is available.
 func (e Engine) Validate() error {
-	if e.eng == nil || len(e.eng.listeners) == 0 {
+	if e.eng == nil {
+		return errors.ErrEmptyEngine
+	}
+	e.eng.lnMu.RLock()
+	n := len(e.eng.listeners)
+	e.eng.lnMu.RUnlock()
+	if n == 0 {
 		return errors.ErrEmptyEngine
 	}
 	if e.eng.isInShutdown() {
@@ -73,6 +82,38 @@ func (e Engine) CountConnections() (count int) {
 	return
 }
 
+// AdmissionStats is the statistics of the connection limits, accept rates and IP filter, see Engine.AdmissionStats.
+type AdmissionStats struct {
+	// Conns is the number of connections that are counted against the connection limits at present.
+	Conns int
+	// RejectedByMaxConns is the number of connections rejected by Options.MaxConns.
+	RejectedByMaxConns uint64
+	// RejectedByMaxConnsPerLoop is the number of connections rejected because all event-loops
+	// have reached Options.MaxConnsPerLoop.
+	RejectedByMaxConnsPerLoop uint64
+	// RejectedByMaxConnsPerSource is the number of connections rejected by Options.MaxConnsPerSource.
+	RejectedByMaxConnsPerSource uint64
+	// RejectedByAcceptRatePerSource is the number of connections rejected by Options.AcceptRatePerSource.
+	RejectedByAcceptRatePerSource uint64
+	// AcceptThrottled is the number of times that the listeners stop being watched because of Options.AcceptRate.
+	AcceptThrottled uint64
+	// RejectedByIPFilter is the number of connections rejected by Options.AllowList and Options.DenyList.
+	RejectedByIPFilter uint64
+	// DroppedByIPFilter is the number of UDP packets dropped by Options.AllowList and Options.DenyList.
+	DroppedByIPFilter uint64
+	// RejectedByProxyProtocol is the number of connections closed for a malformed or missing PROXY protocol header.
+	RejectedByProxyProtocol uint64
+	// RejectedByTLSHandshake is the number of connections closed for a failed or timed-out TLS handshake.
+	RejectedByTLSHandshake uint64
+	// RejectedByTLSHandshakeLimit is the number of connections closed for Options.MaxTLSHandshakesPerLoop.
+	RejectedByTLSHandshakeLimit uint64
+	// TLSHandshakes is the number of TLS handshakes in progress at present.
+	TLSHandshakes int
+	// RejectedByStreamTransform is the number of connections closed for an invalid or missing header
+	// of Options.StreamTransform.
+	RejectedByStreamTransform uint64
+}
+
 // Dup returns a copy of the underlying file descriptor of listener.
 // It is the caller's responsibility to close dupFD when finished.
 // Closing listener does not affect dupFD, and closing dupFD does not affect listener.
@@ -80,6 +121,8 @@ func (e Engine) Dup() (fd int, err error) {
 	if err := e.Validate(); err != nil {
 		return -1, err
 	}
+	e.eng.lnMu.RLock()
+	defer e.eng.lnMu.RUnlock()
 	if len(e.eng.listeners) > 1 {
 		return -1, errors.ErrUnsupportedOp
 	}
@@ -89,13 +132,55 @@ func (e Engine) Dup() (fd int, err error) {
 	return
 }
 
+// AddListener starts listening on the given protocol address on the running Engine,
+// the address is formatted like the ones passed to Run. When SO_REUSEPORT is enabled,
+// each event-loop gets a listener of its own for a TCP or UDP address, just like
+// the ones that the Engine was started with.
+//
+// UDP addresses can only be added when SO_REUSEPORT is enabled, which is always
+// the case for an Engine that was started with UDP addresses.
+func (e Engine) AddListener(protoAddr string) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	network, address, err := parseProtoAddr(protoAddr)
+	if err != nil {
+		return err
+	}
+	return e.eng.addListener(network, address)
+}
+
+// RemoveListener stops listening on the given protocol address, which must be the same
+// as the one passed to Run, Rotate or AddListener. The connections that have been
+// accepted from the listener are not affected.
+//
+// The last listener of the Engine can't be removed, use Stop instead.
+func (e Engine) RemoveListener(protoAddr string) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	network, address, err := parseProtoAddr(protoAddr)
+	if err != nil {
+		return err
+	}
+	return e.eng.removeListener(network, address)
+}
+
 // Stop gracefully shuts down this Engine without interrupting any active event-loops,
 // it waits indefinitely for connections and event-loops to be closed and then shuts down.
+//
+// If Options.DrainTimeout is set, the engine stops accepting new connections first and
+// waits for the pending outbound data of existing connections to be flushed, within the
+// drain timeout and the deadline of ctx, before connections are closed forcibly. Note that
+// ctx.Err() is returned if ctx is done before the engine is completely shut down.
 func (e Engine) Stop(ctx context.Context) error {
 	if err := e.Validate(); err != nil {
 		return err
 	}
 
+	if e.eng.opts.DrainTimeout > 0 {
+		e.eng.drain(ctx)
+	}
 	e.eng.shutdown(nil)
 
 	ticker := time.NewTicker(shutdownPollInterval)
@@ -112,7 +197,10 @@ func (e Engine) Stop(ctx context.Context) error {
 	}
 }
 
-/*
+// GFD is the gnet file descriptor of a connection, which is obtained via Conn.Gfd and
+// addresses the connection in the asynchronous operations of Engine.
+type GFD = gfd.GFD
+
 type asyncCmdType uint8
 
 const (
@@ -123,48 +211,53 @@ const (
 )
 
 type asyncCmd struct {
-	fd  gfd.GFD
-	typ asyncCmdType
-	cb  AsyncCallback
+	fd    gfd.GFD
+	typ   asyncCmdType
+	cb    AsyncCallback
 	param any
 }
 
-// AsyncWrite writes data to the given connection asynchronously.
-func (e Engine) AsyncWrite(fd gfd.GFD, p []byte, cb AsyncCallback) error {
+// AsyncWriteGFD writes data to the connection of fd asynchronously. The methods that address
+// the connection by GFD are suffixed with GFD, to tell apart from the ones addressing it by
+// Conn.ConnId, e.g. AsyncWrite, and from the ones of the engine itself, e.g. Stop.
+//
+// It returns errors.ErrInvalidConn if fd is malformed, if the connection of fd has been
+// closed by the time the command is executed, cb is invoked with a nil Conn and
+// errors.ErrInvalidConn instead.
+func (e Engine) AsyncWriteGFD(fd GFD, p []byte, cb AsyncCallback) error {
 	if err := e.Validate(); err != nil {
 		return err
 	}
 
-	return e.eng.sendCmd(&asyncCmd{fd: fd, typ: asyncCmdWrite, cb: cb, param: p}, false)
+	return e.eng.sendCmd(&asyncCmd{fd: fd, typ: asyncCmdWrite, cb: cb, param: p})
 }
 
-// AsyncWritev is like AsyncWrite, but it accepts a slice of byte slices.
-func (e Engine) AsyncWritev(fd gfd.GFD, batch [][]byte, cb AsyncCallback) error {
+// AsyncWritevGFD is like AsyncWriteGFD, but it accepts a slice of byte slices.
+func (e Engine) AsyncWritevGFD(fd GFD, batch [][]byte, cb AsyncCallback) error {
 	if err := e.Validate(); err != nil {
 		return err
 	}
 
-	return e.eng.sendCmd(&asyncCmd{fd: fd, typ: asyncCmdWritev, cb: cb, param: batch}, false)
+	return e.eng.sendCmd(&asyncCmd{fd: fd, typ: asyncCmdWritev, cb: cb, param: batch})
 }
 
-// Close closes the given connection.
-func (e Engine) Close(fd gfd.GFD, cb AsyncCallback) error {
+// CloseGFD closes the connection of fd, the errors are reported like AsyncWriteGFD.
+func (e Engine) CloseGFD(fd GFD, cb AsyncCallback) error {
 	if err := e.Validate(); err != nil {
 		return err
 	}
 
-	return e.eng.sendCmd(&asyncCmd{fd: fd, typ: asyncCmdClose, cb: cb}, false)
+	return e.eng.sendCmd(&asyncCmd{fd: fd, typ: asyncCmdClose, cb: cb})
 }
 
-// Wake wakes up the given connection.
-func (e Engine) Wake(fd gfd.GFD, cb AsyncCallback) error {
+// WakeGFD wakes up the connection of fd, the errors are reported like AsyncWriteGFD.
+func (e Engine) WakeGFD(fd GFD, cb AsyncCallback) error {
 	if err := e.Validate(); err != nil {
 		return err
 	}
 
-	return e.eng.sendCmd(&asyncCmd{fd: fd, typ: asyncCmdWake, cb: cb}, true)
+	return e.eng.sendCmd(&asyncCmd{fd: fd, typ: asyncCmdWake, cb: cb})
 }
-*/
 
 // Reader is an interface that consists of a number of methods for reading that Conn must implement.
 //
@@ -251,7 +344,7 @@ type AsyncCallback func(c Conn, err error) error
 // you don't have to invoke them within any method in EventHandler.
 type Socket interface {
 	// Gfd returns the gfd of socket.
-	// Gfd() gfd.GFD
+	Gfd() GFD
 
 	// Fd returns the underlying file descriptor.
 	Fd() int
@@ -331,18 +424,78 @@ type Conn interface {
 	// Close closes the current connection, implements net.Conn, it's concurrency-safe.
 	Close() (err error)
 
-	// SetDeadline implements net.Conn.
+	// SetDeadline sets both the read and write deadlines associated with the connection,
+	// it's equivalent to calling both SetReadDeadline and SetWriteDeadline, it's concurrency-safe.
 	SetDeadline(t time.Time) (err error)
 
-	// SetReadDeadline implements net.Conn.
+	// SetReadDeadline sets the read deadline of the connection, it's concurrency-safe.
+	// The connection will be closed when the deadline passes and OnClose will be fired
+	// with an error that matches os.ErrDeadlineExceeded. A zero value for t means no deadline,
+	// so an application usually sets a read deadline in OnOpen and clears it after the
+	// expected data arrives, e.g. the handshake of a protocol is done.
+	//
+	// Note that deadlines are checked by the timer of event-loop with a resolution of 100ms.
 	SetReadDeadline(t time.Time) (err error)
 
-	// SetWriteDeadline implements net.Conn.
+	// SetWriteDeadline sets the write deadline of the connection, it's concurrency-safe.
+	// The connection will be closed with an error that matches os.ErrDeadlineExceeded
+	// if there is still pending data in the outbound buffer when the deadline passes,
+	// writes after the deadline fail with the same error instead of buffering data.
+	// A zero value for t means no deadline.
 	SetWriteDeadline(t time.Time) (err error)
 
-	// ConnId returns the connection Id, t's concurrency-safe.
+	// ConnId returns the ID of the connection which is unique in the engine and
+	// can be decoded by DecodeConnId, it's concurrency-safe.
 	ConnId() int64
 
+	// Join adds the connection to the group that Engine.Broadcast writes to, the connection
+	// leaves all groups automatically when it's closed. It returns errors.ErrUnsupportedOp
+	// for the UDP connections that are not connected.
+	//
+	// Note that this method is not concurrency-safe, you must invoke it within any method in EventHandler.
+	Join(group string) error
+
+	// Leave removes the connection from the group.
+	//
+	// Note that this method is not concurrency-safe, you must invoke it within any method in EventHandler.
+	Leave(group string)
+
+	// PauseRead stops reading from the connection until ResumeRead is called, OnTraffic doesn't
+	// fire in the meantime while writing to the connection works as usual, it's concurrency-safe.
+	// It returns errors.ErrUnsupportedOp for UDP connections.
+	PauseRead() error
+
+	// ResumeRead resumes reading from the connection paused by PauseRead, OnTraffic fires right away
+	// if there is data left in the inbound buffer, it's concurrency-safe.
+	ResumeRead() error
+
+	// Bind binds key to the connection so that the connection can be found by Engine.LookupKey
+	// and addressed by Engine.AsyncWriteKey and Engine.TriggerKey, a key may be bound to
+	// multiple connections. The connection is unbound from all keys automatically when it's closed.
+	//
+	// Note that this method is not concurrency-safe, you must invoke it within any method in EventHandler.
+	Bind(key string) error
+
+	// Unbind unbinds key from the connection.
+	//
+	// Note that this method is not concurrency-safe, you must invoke it within any method in EventHandler.
+	Unbind(key string)
+
+	// ProxyHeader returns the PROXY protocol header received on the connection, which is nil
+	// unless the connection is accepted from a listener in Options.ProxyProtocol.
+	ProxyHeader() *proxyproto.Header
+
+	// TLSConnectionState returns the state of the TLS session of the connection, including
+	// the certificates presented by the peer under mutual TLS, ok is false unless the TLS
+	// handshake of the connection has completed.
+	//
+	// Note that this method is not concurrency-safe, you must invoke it within any method in EventHandler.
+	TLSConnectionState() (state tls.ConnectionState, ok bool)
+
+	// StreamTransform returns the StreamTransform of the connection, which is nil unless
+	// the connection is accepted by an engine with Options.StreamTransform.
+	StreamTransform() StreamTransform
+
 	String() string
 }
 
@@ -383,6 +536,57 @@ type (
 		OnTick() (delay time.Duration, action Action)
 	}
 
+	// IdleHandler is an optional interface that EventHandler can implement to take over
+	// the idle connections when Options.IdleTimeout is set.
+	IdleHandler interface {
+		// OnIdle fires when a connection has been idle for Options.IdleTimeout,
+		// returning None keeps the connection and restarts its idle timer,
+		// returning Close closes the connection with errors.ErrIdleTimeout.
+		OnIdle(c Conn) (action Action)
+	}
+
+	// WritableHandler is an optional interface that EventHandler can implement to resume writing
+	// to the connections when Options.OutboundHighWatermark is set.
+	WritableHandler interface {
+		// OnWritable fires when the outbound buffer of a connection that has reached
+		// Options.OutboundHighWatermark drains to Options.OutboundLowWatermark.
+		OnWritable(c Conn) (action Action)
+	}
+
+	// PanicHandler is an optional interface that EventHandler can implement to get notified
+	// of the panics recovered from callbacks when Options.PanicRecovery is enabled.
+	PanicHandler interface {
+		// OnPanic fires with the recovered value v after a panic in the callback of c,
+		// which is closed right after OnPanic returns, c is nil if the panic is not
+		// tied to any connection, e.g. a panic in OnTick.
+		OnPanic(c Conn, v any)
+	}
+
+	// RejectHandler is an optional interface that EventHandler can implement to get notified
+	// of the connections rejected by the connection limits in Options.
+	RejectHandler interface {
+		// OnReject fires after the connection from remoteAddr is rejected with err and closed,
+		// it's called by the goroutine that accepts connections, so it must not block.
+		OnReject(remoteAddr net.Addr, err error)
+	}
+
+	// StreamTransform is a reversible transformation of the byte stream of a connection, e.g. a stream cipher,
+	// which is set up by the header that the remote sends at the start of the connection. It's created for each
+	// connection by Options.StreamTransform and all its methods are called on the event-loop of the connection.
+	StreamTransform interface {
+		// Init sets up the transformation with the header at the start of data, which is all data received
+		// so far, and returns the size of the header, which must not be empty. It returns 0 if the header is
+		// incomplete, then it's called again when more data arrives. The connection is closed if it fails.
+		Init(data []byte) (n int, err error)
+
+		// Inbound transforms the data received from the remote in place.
+		Inbound(b []byte)
+
+		// Outbound writes the transformation of the data to be sent to the remote from src to dst,
+		// which is of the same length as src.
+		Outbound(dst, src []byte)
+	}
+
 	// BuiltinEventEngine is a built-in implementation of EventHandler which sets up each method with a default implementation,
 	// you can compose it with your own implementation of EventHandler when you don't want to implement all methods
 	// in EventHandler.
@@ -426,27 +630,32 @@ func (*BuiltinEventEngine) OnTick() (delay time.Duration, action Action) {
 // MaxStreamBufferCap is the default buffer size for each stream-oriented connection(TCP/Unix).
 var MaxStreamBufferCap = 64 * 1024 // 64KB
 
-func createListeners(addrs []string, opts ...Option) ([]*listener, *Options, error) {
-	options := loadOptions(opts...)
-
-	logger, logFlusher := logging.GetDefaultLogger(), logging.GetDefaultFlusher()
-	if options.Logger == nil {
-		if options.LogPath != "" {
-			logger, logFlusher, _ = logging.CreateLoggerAsLocalFile(options.LogPath, options.LogLevel)
+// initLogger sets up the logger of options if it's not provided by users and returns the flusher
+// of the logger, the flusher is nil if the logger is provided by users who are responsible for it.
+func initLogger(options *Options) (flusher logging.Flusher) {
+	if options.Logger != nil {
+		return nil
+	}
+	if options.LogPath != "" {
+		logger, flusher, err := logging.CreateLoggerAsLocalFile(options.LogPath, options.LogLevel)
+		if err == nil {
+			options.Logger = logger
+			return flusher
 		}
-		options.Logger = logger
-	} else {
-		logger = options.Logger
-		logFlusher = nil
+		logging.GetDefaultLogger().Errorf("failed to create logger as local file %s, "+
+			"fall back to the default logger: %v", options.LogPath, err)
 	}
-	logging.SetDefaultLoggerAndFlusher(logger, logFlusher)
+	options.Logger = logging.GetDefaultLogger()
+	return logging.GetDefaultFlusher()
+}
 
-	logging.Debugf("default logging level is %s", logging.LogLevel())
+func createListeners(addrs []string, options *Options) ([]*listener, *inheritance, error) {
+	options.Logger.Debugf("default logging level is %s", logging.LogLevel())
 
 	// The maximum number of operating system threads that the Go program can use is initially set to 10000,
 	// which should also be the maximum amount of I/O event-loops locked to OS threads that users can start up.
 	if options.LockOSThread && options.NumEventLoop > 10000 {
-		logging.Errorf("too many event-loops under LockOSThread mode, should be less than 10,000 "+
+		options.Logger.Errorf("too many event-loops under LockOSThread mode, should be less than 10,000 "+
 			"while you are trying to set up %d\n", options.NumEventLoop)
 		return nil, nil, errors.ErrTooManyEventLoopThreads
 	}
@@ -477,6 +686,11 @@ func createListeners(addrs []string, opts ...Option) ([]*listener, *Options, err
 		options.WriteBufferCap = math.CeilToPowerOfTwo(wbc)
 	}
 
+	if options.OutboundHighWatermark > 0 &&
+		(options.OutboundLowWatermark < 0 || options.OutboundLowWatermark >= options.OutboundHighWatermark) {
+		options.OutboundLowWatermark = options.OutboundHighWatermark / 2
+	}
+
 	var hasUDP, hasUnix bool
 	for _, addr := range addrs {
 		proto, _, err := parseProtoAddr(addr)
@@ -519,20 +733,32 @@ func createListeners(addrs []string, opts ...Option) ([]*listener, *Options, err
 		options.EdgeTriggeredIO = false
 	}
 
+	var ih *inheritance
+	if options.HandoffSocket != "" {
+		var err error
+		if ih, err = inheritListeners(options.HandoffSocket, options); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	listeners := make([]*listener, len(addrs))
 	for i, a := range addrs {
 		proto, addr, err := parseProtoAddr(a)
 		if err != nil {
+			ih.close()
 			return nil, nil, err
 		}
-		ln, err := initListener(proto, addr, options)
-		if err != nil {
-			return nil, nil, err
+		ln := ih.take(proto, addr)
+		if ln == nil {
+			if ln, err = initListener(proto, addr, options); err != nil {
+				ih.close()
+				return nil, nil, err
+			}
 		}
 		listeners[i] = ln
 	}
 
-	return listeners, options, nil
+	return listeners, ih, nil
 }
 
 // Run starts handling events on the specified address.
@@ -551,32 +777,40 @@ func createListeners(addrs []string, opts ...Option) ([]*listener, *Options, err
 //
 // The "tcp" network scheme is assumed when one is not specified.
 func Run(eventHandler EventHandler, protoAddr string, opts ...Option) error {
-	listeners, options, err := createListeners([]string{protoAddr}, opts...)
+	options := loadOptions(opts...)
+	if logFlusher := initLogger(options); logFlusher != nil {
+		defer logFlusher() //nolint:errcheck
+	}
+	listeners, ih, err := createListeners([]string{protoAddr}, options)
 	if err != nil {
 		return err
 	}
 	defer func() {
+		ih.close()
 		for _, ln := range listeners {
 			ln.close()
 		}
-		logging.Cleanup()
 	}()
-	return run(eventHandler, listeners, options, []string{protoAddr})
+	return run(eventHandler, listeners, options, []string{protoAddr}, ih)
 }
 
 // Rotate is like Run but accepts multiple network addresses.
 func Rotate(eventHandler EventHandler, addrs []string, opts ...Option) error {
-	listeners, options, err := createListeners(addrs, opts...)
+	options := loadOptions(opts...)
+	if logFlusher := initLogger(options); logFlusher != nil {
+		defer logFlusher() //nolint:errcheck
+	}
+	listeners, ih, err := createListeners(addrs, options)
 	if err != nil {
 		return err
 	}
 	defer func() {
+		ih.close()
 		for _, ln := range listeners {
 			ln.close()
 		}
-		logging.Cleanup()
 	}()
-	return run(eventHandler, listeners, options, addrs)
+	return run(eventHandler, listeners, options, addrs, ih)
 }
 
 var (
@@ -584,6 +818,9 @@ var (
 
 	// shutdownPollInterval is how often we poll to check whether engine has been shut down during gnet.Stop().
 	shutdownPollInterval = 500 * time.Millisecond
+
+	// drainPollInterval is how often we check the pending outbound data of connections during Engine.Stop().
+	drainPollInterval = 100 * time.Millisecond
 )
 
 // Stop gracefully shuts down the engine without interrupting any active event-loops,
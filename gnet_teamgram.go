@@ -7,39 +7,189 @@
 package gnet
 
 import (
+	"context"
+	"io"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+
 	"github.com/panjf2000/gnet/v2/internal/queue"
 	"github.com/panjf2000/gnet/v2/pkg/errors"
 )
 
-// AsyncWrite - AsyncWrite
-func (e Engine) AsyncWrite(connId int64, data []byte) error {
+// MessageEncoder is an optional interface of the contexts of connections. With Options.MessageEncoding,
+// the data pushed to a connection by Engine.AsyncWrite, Engine.AsyncWriteKey and Engine.Broadcast is taken
+// as a message and written as the frame encoded by the context on the event-loop if it's a MessageEncoder,
+// e.g. the codec of the transport that is detected for each connection.
+type MessageEncoder interface {
+	// Encode writes the frame of msg to w, which is the connection. msg must not be modified.
+	Encode(w io.Writer, msg []byte) error
+}
+
+// push writes the data pushed by the engine to the connection, the message is dropped
+// with an error log if it fails to be encoded.
+func (c *conn) push(data []byte) (err error) {
+	if c.loop.engine.opts.MessageEncoding {
+		if enc, ok := c.ctx.(MessageEncoder); ok {
+			if err = enc.Encode(c, data); err != nil {
+				c.loop.getLogger().Errorf("failed to encode the message of %d bytes pushed to connection(fd=%d,remote=%+v): %v",
+					len(data), c.fd, c.remoteAddr, err)
+			}
+			return
+		}
+	}
+	_, err = c.write(data)
+	return
+}
+
+// DecodeConnId decodes the ID of a connection into the index of the event-loop
+// that the connection belongs to and the sequence number of the connection in it.
+func DecodeConnId(connId int64) (loopIdx int, seq int64) {
+	return int(connId >> connIdSeqBits), connId & (1<<connIdSeqBits - 1)
+}
+
+// eventLoopOf returns the event-loop that the connection of connId belongs to.
+func (eng *engine) eventLoopOf(connId int64) *eventloop {
+	if eng.isClient() {
+		return nil
+	}
+	idx, _ := DecodeConnId(connId)
+	if idx < 0 {
+		return nil
+	}
+	return eng.eventLoops.index(idx)
+}
+
+// Lookup returns the connection of connId and reports whether it's still alive,
+// it's concurrency-safe. Note that only the concurrency-safe methods of the
+// returned Conn are allowed to be called outside the event-loop.
+func (e Engine) Lookup(connId int64) (Conn, bool) {
+	if e.Validate() != nil {
+		return nil, false
+	}
+	el := e.eng.eventLoopOf(connId)
+	if el == nil {
+		return nil, false
+	}
+	if c := el.lookupConn(connId); c != nil {
+		return c, true
+	}
+	return nil, false
+}
+
+// AsyncWrite writes data to the connection of connId asynchronously, data is encoded
+// by the context of the connection with Options.MessageEncoding if it's a MessageEncoder.
+//
+// It returns errors.ErrInvalidConn if the connection is not alive, if the connection
+// has been closed by the time the write is executed, cb is invoked with a nil Conn and
+// errors.ErrInvalidConn instead, just like AsyncWriteGFD. cb can be nil.
+func (e Engine) AsyncWrite(connId int64, data []byte, cb AsyncCallback) error {
 	if e.eng == nil {
 		return errors.ErrEmptyEngine
 	}
 
-	elidx := int(connId >> 48 & 0xffff)
-	id := uint16(connId >> 32 & 0xffff)
-	fd := int(connId & 0xffffffff)
+	el := e.eng.eventLoopOf(connId)
+	if el == nil || el.lookupConn(connId) == nil {
+		return errors.ErrInvalidConn
+	}
+	return el.poller.Trigger(queue.HighPriority, func(_ interface{}) error {
+		c := el.lookupConn(connId)
+		if c == nil || !c.opened {
+			if cb != nil {
+				defer el.recoverPanic(nil)
+				_ = cb(nil, errors.ErrInvalidConn)
+			}
+			return nil
+		}
+		c.invokeCallback(cb, c.push(data))
+		return nil
+	}, nil)
+}
 
-	e.eng.eventLoops.iterate(func(i int, el *eventloop) bool {
-		if i == elidx {
-			_ = el.poller.Trigger(queue.HighPriority, func(_ interface{}) error {
-				if c := el.connections.getConn(fd); c != nil && c.id == id {
-					if !c.opened {
-						return nil
-					}
-					c.write(data)
-				}
-				return nil
-			}, nil)
-			return false
+// LookupKey returns the alive connections that key is bound to via Conn.Bind, it's concurrency-safe.
+// Note that only the concurrency-safe methods of the returned Conns are allowed to be called
+// outside the event-loop.
+func (e Engine) LookupKey(key string) []Conn {
+	if e.Validate() != nil {
+		return nil
+	}
+	var conns []Conn
+	for _, cs := range e.eng.connsOf(key) {
+		for _, c := range cs {
+			conns = append(conns, c)
 		}
-		return true
+	}
+	return conns
+}
+
+// AsyncWriteKey writes data to all connections that key is bound to asynchronously,
+// with a single task for each event-loop of the connections. It returns errors.ErrInvalidConn
+// if key is not bound to any connection. data is shared by all connections, so it must not
+// be modified after calling AsyncWriteKey. data is encoded by the contexts of the connections
+// that are MessageEncoders with Options.MessageEncoding.
+func (e Engine) AsyncWriteKey(key string, data []byte) error {
+	return e.triggerKey(key, func(c *conn) {
+		_ = c.push(data)
 	})
+}
 
+// TriggerKey invokes cb on the event-loop for each connection that key is bound to,
+// it returns errors.ErrInvalidConn if key is not bound to any connection.
+func (e Engine) TriggerKey(key string, cb func(c Conn)) error {
+	if cb == nil {
+		return nil
+	}
+	return e.triggerKey(key, func(c *conn) {
+		c.invoke(cb)
+	})
+}
+
+func (e Engine) triggerKey(key string, fn func(c *conn)) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	loops := e.eng.connsOf(key)
+	if len(loops) == 0 {
+		return errors.ErrInvalidConn
+	}
+	for el, conns := range loops {
+		conns := conns
+		err := el.poller.Trigger(queue.HighPriority, func(_ interface{}) error {
+			for _, c := range conns {
+				// Skip the connections that are closed or unbound from key in the meantime.
+				if _, ok := c.keys[key]; ok && c.opened {
+					fn(c)
+				}
+			}
+			return nil
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Broadcast writes data to all connections that have joined the group asynchronously,
+// with a single task for each event-loop instead of one for each connection.
+// data is shared by all connections, so it must not be modified after calling Broadcast.
+// data is encoded by the contexts of the connections that are MessageEncoders with Options.MessageEncoding.
+func (e Engine) Broadcast(group string, data []byte) (err error) {
+	if err = e.Validate(); err != nil {
+		return
+	}
+
+	e.eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+		err = el.poller.Trigger(queue.HighPriority, func(_ interface{}) error {
+			el.broadcast(group, data)
+			return nil
+		}, nil)
+		return err == nil
+	})
+	return
+}
+
 // Trigger - Trigger
 func (e Engine) Trigger(connId int64, cb func(c Conn)) {
 	if e.eng == nil {
@@ -50,25 +200,16 @@ func (e Engine) Trigger(connId int64, cb func(c Conn)) {
 		return
 	}
 
-	elidx := int(connId >> 48 & 0xffff)
-	id := uint16(connId >> 32 & 0xffff)
-	fd := int(connId & 0xffffffff)
-
-	// (queue.LowPriority, func(_ interface{}
-	e.eng.eventLoops.iterate(func(i int, el *eventloop) bool {
-		if i == elidx {
-			_ = el.poller.Trigger(queue.HighPriority, func(_ interface{}) error {
-				if c := el.connections.getConn(fd); c != nil && c.id == id {
-					if c.opened {
-						cb(c)
-					}
-				}
-				return nil
-			}, nil)
-			return false
+	el := e.eng.eventLoopOf(connId)
+	if el == nil {
+		return
+	}
+	_ = el.poller.Trigger(queue.HighPriority, func(_ interface{}) error {
+		if c := el.lookupConn(connId); c != nil && c.opened {
+			c.invoke(cb)
 		}
-		return true
-	})
+		return nil
+	}, nil)
 }
 
 // Iterate - iterate all conns
@@ -80,7 +221,7 @@ func (e Engine) Iterate(cb func(c Conn)) {
 	e.eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
 		_ = el.poller.Trigger(queue.LowPriority, func(_ interface{}) error {
 			el.connections.iterate(func(c *conn) bool {
-				cb(c)
+				c.invoke(cb)
 				return true
 			})
 			return nil
@@ -88,3 +229,94 @@ func (e Engine) Iterate(cb func(c Conn)) {
 		return true
 	})
 }
+
+// IterateSync invokes fn for every connection on the event-loops one after another and
+// waits until all event-loops are done with it, the iteration stops once fn returns false.
+// fn is never invoked concurrently, so it's free to collect the states of connections
+// without any synchronization.
+//
+// If ctx is done before the iteration completes, IterateSync stops the iteration and
+// returns ctx.Err(), note that fn might still be running with the current connection then.
+//
+// IterateSync must not be called on an event-loop, e.g. in EventHandler.OnTraffic or the callbacks
+// of Engine.Trigger, which would wait for the event-loop itself, it returns errors.ErrOnEventLoop then.
+func (e Engine) IterateSync(ctx context.Context, fn func(c Conn) bool) (err error) {
+	if err = e.Validate(); err != nil {
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if onEventLoop() {
+		return errors.ErrOnEventLoop
+	}
+
+	var stopped int32
+	e.eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+		done := make(chan struct{})
+		err = el.poller.Trigger(queue.LowPriority, func(_ interface{}) error {
+			defer close(done)
+			el.connections.iterate(func(c *conn) bool {
+				if atomic.LoadInt32(&stopped) == 1 {
+					return false
+				}
+				next := true
+				c.invoke(func(c Conn) { next = fn(c) })
+				if !next {
+					atomic.StoreInt32(&stopped, 1)
+				}
+				return next
+			})
+			return nil
+		}, nil)
+		if err != nil {
+			return false
+		}
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-e.eng.workerPool.shutdownCtx.Done():
+			err = errors.ErrEngineShutdown
+		}
+		if err != nil {
+			atomic.StoreInt32(&stopped, 1)
+		}
+		return atomic.LoadInt32(&stopped) == 0
+	})
+	return
+}
+
+// loopEntries are the entries of the functions that run event-loops, one of which is at
+// the bottom of the calls made on an event-loop.
+var loopEntries = [...]uintptr{
+	reflect.ValueOf((*eventloop).rotate).Pointer(),
+	reflect.ValueOf((*eventloop).orbit).Pointer(),
+	reflect.ValueOf((*eventloop).run).Pointer(),
+}
+
+// onEventLoop reports whether the caller runs on an event-loop, by looking for the function
+// running the event-loop among the callers, the program counters are compared without
+// formatting or allocating anything.
+func onEventLoop() bool {
+	var pcs [32]uintptr
+	for skip := 2; ; skip += len(pcs) {
+		n := runtime.Callers(skip, pcs[:])
+		frames := runtime.CallersFrames(pcs[:n])
+		for {
+			frame, more := frames.Next()
+			for _, entry := range loopEntries {
+				if frame.Entry == entry {
+					return true
+				}
+			}
+			if !more {
+				break
+			}
+		}
+		if n < len(pcs) {
+			return false
+		}
+	}
+}
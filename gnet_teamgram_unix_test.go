@@ -0,0 +1,387 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+func TestConnIdLookup(t *testing.T) {
+	s := &testConnIdServer{openCh: make(chan Conn, 8), closeCh: make(chan int64, 8)}
+	addr := runTestServer(t, s, "tcp", WithNumEventLoop(2))
+
+	seen := make(map[int64]struct{})
+	seqs := make(map[int]int64)
+	for i := 0; i < 6; i++ {
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		gc := <-s.openCh
+		id := gc.ConnId()
+		require.NotContains(t, seen, id)
+		seen[id] = struct{}{}
+
+		loopIdx, seq := DecodeConnId(id)
+		require.True(t, loopIdx >= 0 && loopIdx < 2, "invalid event-loop index: %d", loopIdx)
+		require.Greater(t, seq, seqs[loopIdx])
+		seqs[loopIdx] = seq
+
+		lc, ok := s.eng.Lookup(id)
+		require.True(t, ok)
+		assert.Same(t, gc, lc)
+
+		require.NoError(t, s.eng.AsyncWrite(id, []byte("ping"), nil))
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(c, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(buf))
+
+		require.NoError(t, c.Close())
+		assert.Equal(t, id, <-s.closeCh)
+		_, ok = s.eng.Lookup(id)
+		assert.False(t, ok)
+	}
+
+	_, ok := s.eng.Lookup(1<<connIdSeqBits*100 | 1)
+	assert.False(t, ok)
+}
+
+type testConnIdServer struct {
+	testBaseServer
+	openCh  chan Conn
+	closeCh chan int64
+}
+
+func (s *testConnIdServer) OnOpen(c Conn) (out []byte, action Action) {
+	s.openCh <- c
+	return
+}
+
+func (s *testConnIdServer) OnClose(c Conn, _ error) (action Action) {
+	s.closeCh <- c.ConnId()
+	return
+}
+
+func TestEngineAsyncCmdStaleConn(t *testing.T) {
+	s := &testConnIdServer{openCh: make(chan Conn, 1), closeCh: make(chan int64, 1)}
+	addr := runTestServer(t, s, "tcp")
+
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	gc := <-s.openCh
+	fd, id := gc.Gfd(), gc.ConnId()
+
+	done := make(chan error, 1)
+	require.NoError(t, s.eng.AsyncWriteGFD(fd, []byte("ping"), func(c Conn, err error) error {
+		assert.NotNil(t, c)
+		done <- err
+		return nil
+	}))
+	require.NoError(t, <-done)
+	buf := make([]byte, 4)
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+
+	// The commands to a connection run in order, so the write sent before Close
+	// is delivered and the one sent after Close fails, even if the event-loop is
+	// so busy that the tasks of low priority are put off.
+	release := make(chan struct{})
+	s.eng.Trigger(id, func(Conn) { <-release })
+	require.NoError(t, s.eng.AsyncWriteGFD(fd, []byte("pong"), nil))
+	for i := 0; i < 2048; i++ {
+		s.eng.Trigger(id, func(Conn) {})
+	}
+	require.NoError(t, s.eng.CloseGFD(fd, nil))
+	require.NoError(t, s.eng.AsyncWriteGFD(fd, []byte("late"), func(c Conn, err error) error {
+		done <- err
+		return nil
+	}))
+	// So does the write addressed by the connection ID.
+	idDone := make(chan error, 1)
+	require.NoError(t, s.eng.AsyncWrite(id, []byte("late"), func(c Conn, err error) error {
+		assert.Nil(t, c)
+		idDone <- err
+		return nil
+	}))
+	close(release)
+	assert.ErrorIs(t, <-done, errorx.ErrInvalidConn)
+	assert.ErrorIs(t, <-idDone, errorx.ErrInvalidConn)
+	data, err := io.ReadAll(c)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(data))
+	require.NoError(t, c.Close())
+	<-s.closeCh
+
+	// A new connection might reuse the same socket fd, but not the handles.
+	c, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	<-s.openCh
+
+	cmds := map[string]func(AsyncCallback) error{
+		"write": func(cb AsyncCallback) error { return s.eng.AsyncWriteGFD(fd, []byte("ping"), cb) },
+		"writev": func(cb AsyncCallback) error {
+			return s.eng.AsyncWritevGFD(fd, [][]byte{[]byte("pi"), []byte("ng")}, cb)
+		},
+		"close": func(cb AsyncCallback) error { return s.eng.CloseGFD(fd, cb) },
+		"wake":  func(cb AsyncCallback) error { return s.eng.WakeGFD(fd, cb) },
+	}
+	for name, cmd := range cmds {
+		require.NoError(t, cmd(func(c Conn, err error) error {
+			assert.Nil(t, c)
+			done <- err
+			return nil
+		}), name)
+		assert.ErrorIs(t, <-done, errorx.ErrInvalidConn, name)
+	}
+	assert.ErrorIs(t, s.eng.AsyncWriteGFD(GFD{}, []byte("ping"), nil), errorx.ErrInvalidConn)
+	assert.ErrorIs(t, s.eng.AsyncWrite(id, []byte("ping"), nil), errorx.ErrInvalidConn)
+}
+
+// testMessageEncoder frames the messages in angle brackets, and fails to encode the empty ones.
+type testMessageEncoder struct{}
+
+func (testMessageEncoder) Encode(w io.Writer, msg []byte) error {
+	if len(msg) == 0 {
+		return errors.New("empty message")
+	}
+	_, err := w.Write([]byte("<" + string(msg) + ">"))
+	return err
+}
+
+func TestEngineMessageEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		encode bool
+		reply  string
+	}{
+		{"raw", false, "pingpong"},
+		{"encoded", true, "<ping><pong>"}, // the empty message fails to be encoded and is dropped
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &testConnIdServer{openCh: make(chan Conn, 1), closeCh: make(chan int64, 1)}
+			addr := runTestServer(t, s, "tcp", WithMessageEncoding(tc.encode))
+
+			c, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer c.Close()
+			id := (<-s.openCh).ConnId()
+			s.eng.Trigger(id, func(c Conn) { c.SetContext(testMessageEncoder{}) })
+			errs := make(chan error, 3)
+			for _, msg := range []string{"ping", "", "pong"} {
+				require.NoError(t, s.eng.AsyncWrite(id, []byte(msg), func(c Conn, err error) error {
+					assert.NotNil(t, c)
+					errs <- err
+					return nil
+				}))
+			}
+			expectRead(t, c, tc.reply)
+			assert.NoError(t, <-errs)
+			if err := <-errs; tc.encode {
+				assert.Error(t, err, "the error of encoding should be reported")
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, <-errs)
+		})
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	s := new(testBroadcastServer)
+	addr := runTestServer(t, s, "tcp", WithNumEventLoop(2))
+
+	send := func(c net.Conn, cmd string) {
+		_, err := c.Write([]byte(cmd))
+		require.NoError(t, err)
+		expectRead(t, c, "ok")
+	}
+	clients := make([]net.Conn, 3)
+	for i := range clients {
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer c.Close()
+		clients[i] = c
+	}
+	send(clients[0], "join")
+	send(clients[1], "join")
+	send(clients[1], "join")
+
+	require.NoError(t, s.eng.Broadcast("room", []byte("hi")))
+	expectRead(t, clients[0], "hi")
+	expectRead(t, clients[1], "hi")
+
+	send(clients[1], "leave")
+	require.NoError(t, s.eng.Broadcast("room", []byte("yo")))
+	require.NoError(t, s.eng.Broadcast("nobody", []byte("no")))
+	expectRead(t, clients[0], "yo")
+	for _, c := range clients[1:] {
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+		_, err := c.Read(make([]byte, 2))
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded, "non-members are not supposed to receive anything")
+	}
+
+	// Members leave their groups when they're closed.
+	require.NoError(t, clients[0].Close())
+	assert.Eventually(t, func() bool {
+		groups := 0
+		s.eng.eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+			_ = el.execSync(func() error {
+				groups += len(el.groups)
+				return nil
+			})
+			return true
+		})
+		return groups == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+type testBroadcastServer struct {
+	testBaseServer
+}
+
+func (s *testBroadcastServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	switch string(buf) {
+	case "join":
+		_ = c.Join("room")
+	case "leave":
+		c.Leave("room")
+	}
+	_, _ = c.Write([]byte("ok"))
+	return
+}
+
+func TestBindKey(t *testing.T) {
+	s := new(testBindKeyServer)
+	addr := runTestServer(t, s, "tcp", WithNumEventLoop(2))
+
+	clients := make([]net.Conn, 3)
+	for i, key := range []string{"user:1", "user:1", "user:2"} {
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer c.Close()
+		clients[i] = c
+		_, err = c.Write([]byte("bind " + key))
+		require.NoError(t, err)
+		expectRead(t, c, "ok")
+	}
+	assert.Len(t, s.eng.LookupKey("user:1"), 2)
+	assert.Len(t, s.eng.LookupKey("user:2"), 1)
+	assert.Empty(t, s.eng.LookupKey("user:3"))
+
+	require.NoError(t, s.eng.AsyncWriteKey("user:1", []byte("hi")))
+	expectRead(t, clients[0], "hi")
+	expectRead(t, clients[1], "hi")
+	require.NoError(t, s.eng.TriggerKey("user:2", func(c Conn) {
+		_, _ = c.Write([]byte("yo"))
+	}))
+	expectRead(t, clients[2], "yo")
+	assert.ErrorIs(t, s.eng.AsyncWriteKey("user:3", []byte("no")), errorx.ErrInvalidConn)
+
+	_, err := clients[1].Write([]byte("unbind user:1"))
+	require.NoError(t, err)
+	expectRead(t, clients[1], "ok")
+	require.NoError(t, s.eng.AsyncWriteKey("user:1", []byte("hi")))
+	expectRead(t, clients[0], "hi")
+	require.NoError(t, clients[1].SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, err = clients[1].Read(make([]byte, 2))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded, "the unbound connection is not supposed to receive anything")
+
+	// Keys are unbound when connections are closed.
+	require.NoError(t, clients[0].Close())
+	assert.Eventually(t, func() bool { return len(s.eng.LookupKey("user:1")) == 0 }, time.Second, 10*time.Millisecond)
+	assert.ErrorIs(t, s.eng.AsyncWriteKey("user:1", []byte("hi")), errorx.ErrInvalidConn)
+}
+
+type testBindKeyServer struct {
+	testBaseServer
+}
+
+func (s *testBindKeyServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	cmd, key, _ := strings.Cut(string(buf), " ")
+	switch cmd {
+	case "bind":
+		_ = c.Bind(key)
+	case "unbind":
+		c.Unbind(key)
+	}
+	_, _ = c.Write([]byte("ok"))
+	return
+}
+
+func TestIterateSync(t *testing.T) {
+	s := &testConnIdServer{openCh: make(chan Conn, 4), closeCh: make(chan int64, 4)}
+	addr := runTestServer(t, s, "tcp", WithNumEventLoop(2))
+
+	ids := make(map[int64]struct{})
+	for i := 0; i < 4; i++ {
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer c.Close()
+		ids[(<-s.openCh).ConnId()] = struct{}{}
+	}
+
+	seen := make(map[int64]struct{})
+	require.NoError(t, s.eng.IterateSync(context.Background(), func(c Conn) bool {
+		seen[c.ConnId()] = struct{}{}
+		return true
+	}))
+	assert.Equal(t, ids, seen)
+
+	n := 0
+	require.NoError(t, s.eng.IterateSync(context.Background(), func(Conn) bool {
+		n++
+		return n < 3
+	}))
+	assert.Equal(t, 3, n)
+
+	// IterateSync on an event-loop fails rather than waiting for the event-loop itself.
+	onLoop := make(chan error, 1)
+	for id := range ids {
+		s.eng.Trigger(id, func(Conn) {
+			onLoop <- s.eng.IterateSync(context.Background(), func(Conn) bool { return true })
+		})
+		break
+	}
+	select {
+	case err := <-onLoop:
+		assert.ErrorIs(t, err, errorx.ErrOnEventLoop)
+	case <-time.After(3 * time.Second):
+		require.FailNow(t, "IterateSync on the event-loop is blocked")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, s.eng.IterateSync(ctx, func(Conn) bool { return true }), context.Canceled)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	release := make(chan struct{})
+	var calls int32
+	assert.ErrorIs(t, s.eng.IterateSync(ctx, func(Conn) bool {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return true
+	}), context.DeadlineExceeded)
+	close(release)
+	// The iteration stops after the blocked call returns.
+	time.Sleep(100 * time.Millisecond)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
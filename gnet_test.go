@@ -21,6 +21,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 	"golang.org/x/sync/errgroup"
 
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
@@ -1532,6 +1534,34 @@ func TestMultiInstLoggerRace(t *testing.T) {
 	assert.ErrorIs(t, g.Wait(), errorx.ErrUnsupportedProtocol)
 }
 
+func TestMultiInstLogger(t *testing.T) {
+	defaultLogger := logging.GetDefaultLogger()
+
+	core1, logs1 := observer.New(zapcore.DebugLevel)
+	core2, logs2 := observer.New(zapcore.DebugLevel)
+	core3, logs3 := observer.New(zapcore.DebugLevel)
+	g := errgroup.Group{}
+	g.Go(func() error {
+		return Run(new(testMultiInstLoggerRaceServer), "tcp://:9214", WithLogger(zap.New(core1).Sugar()))
+	})
+	g.Go(func() error {
+		return Run(new(testMultiInstLoggerRaceServer), "tcp://:9215", WithLogger(zap.New(core2).Sugar()))
+	})
+	cli, err := NewClient(new(BuiltinEventEngine), WithLogger(zap.New(core3).Sugar()))
+	require.NoError(t, err)
+	require.NoError(t, cli.Start())
+	require.NoError(t, cli.Stop())
+	require.NoError(t, g.Wait())
+
+	// Each engine logs via its own logger without replacing the default one.
+	assert.Equal(t, 1, logs1.FilterMessageSnippet("tcp://:9214").Len())
+	assert.Zero(t, logs1.FilterMessageSnippet("tcp://:9215").Len())
+	assert.Equal(t, 1, logs2.FilterMessageSnippet("tcp://:9215").Len())
+	assert.Zero(t, logs2.FilterMessageSnippet("tcp://:9214").Len())
+	assert.Equal(t, 1, logs3.FilterMessageSnippet("Starting gnet client").Len())
+	assert.Same(t, defaultLogger, logging.GetDefaultLogger())
+}
+
 var errIncompletePacket = errors.New("incomplete packet")
 
 type simServer struct {
@@ -0,0 +1,389 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/panjf2000/gnet/v2/internal/socket"
+	"github.com/panjf2000/gnet/v2/pkg/logging"
+)
+
+// The hand-off protocol over the Unix domain socket is as follows:
+//
+//  1. The old process listens on the socket and the new process connects to it,
+//     the new process inherits nothing if no process is listening on the socket.
+//     The socket is listened on at a temporary path which is renamed to its path
+//     afterwards, so that it never exists without being listened on.
+//  2. The old process sends a frame for each listener with the listener fd attached
+//     via SCM_RIGHTS, then an empty frame to mark the end of listeners.
+//  3. The new process starts its engine from the inherited listeners and sends back
+//     a single byte as acknowledgement, it just closes the connection if it fails.
+//
+// A frame consists of a 4-byte big-endian length and a JSON-encoded handoffHeader.
+
+// handoffAck is sent by the new process once its engine has been started.
+const handoffAck = 'A'
+
+var (
+	// handoffDialTimeout is how long the new process keeps trying to connect to the old process
+	// that is listening on the socket but fails to accept the connection for now.
+	handoffDialTimeout = 5 * time.Second
+
+	// handoffDialInterval is how often the new process tries to connect to the old process.
+	handoffDialInterval = 50 * time.Millisecond
+)
+
+// handoffHeader describes a listener that is handed off.
+type handoffHeader struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+}
+
+// Handoff passes all listeners of this Engine, including the ones of every event-loop
+// with SO_REUSEPORT, to another process via the Unix domain socket at path, which is
+// expected to start its engine with WithHandoffSocket(path) and the same protocol addresses.
+// The other process must be started after the socket appears at path, otherwise it inherits
+// nothing and listens on the addresses itself.
+//
+// Once the new engine is up and running, this Engine stops accepting new connections,
+// drains the existing connections within the deadline of ctx and shuts down like Stop does.
+// This Engine keeps serving if the new engine fails to start.
+func (e Engine) Handoff(ctx context.Context, path string) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	lns, err := e.eng.collectListeners()
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	_ = os.RemoveAll(tmpPath)
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	l.SetUnlinkOnClose(false)
+	defer l.Close() //nolint:errcheck
+	if err = os.Chmod(tmpPath, 0o600); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	defer os.Remove(path) //nolint:errcheck
+
+	defer unblockOnDone(ctx, l.SetDeadline)()
+	c, err := l.AcceptUnix()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer c.Close() //nolint:errcheck
+	defer unblockOnDone(ctx, c.SetDeadline)()
+
+	for _, ln := range lns {
+		if err = writeHandoffFrame(c, &handoffHeader{ln.network, ln.address}, ln.fd); err != nil {
+			return fmt.Errorf("failed to hand off listener(%s://%s): %w", ln.network, ln.address, err)
+		}
+	}
+	if err = writeHandoffFrame(c, nil, -1); err != nil {
+		return err
+	}
+
+	ack := make([]byte, 1)
+	if _, err = io.ReadFull(c, ack); err != nil || ack[0] != handoffAck {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("gnet: the new process failed to take over listeners: %v", err)
+	}
+
+	// The Unix domain sockets are in use by the new process now, keep their files.
+	for _, ln := range lns {
+		atomic.StoreInt32(&ln.detached, 1)
+	}
+	e.eng.opts.Logger.Infof("gnet engine has handed off %d listeners via %s", len(lns), path)
+
+	e.eng.drain(ctx)
+	return e.Stop(ctx)
+}
+
+// unblockOnDone unblocks the pending I/O by setting the deadline when ctx is done,
+// the returned function must be called to release the resources.
+func unblockOnDone(ctx context.Context, setDeadline func(time.Time) error) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = setDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// collectListeners collects all listeners from the event-loops that monitor them.
+func (eng *engine) collectListeners() (lns []*listener, err error) {
+	eng.lnMu.RLock()
+	defer eng.lnMu.RUnlock()
+
+	var owners []*eventloop
+	if eng.ingress != nil {
+		owners = append(owners, eng.ingress)
+	} else {
+		eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+			owners = append(owners, el)
+			return true
+		})
+	}
+
+	for _, el := range owners {
+		el := el
+		err = el.execSync(func() error {
+			for _, ln := range el.listeners {
+				lns = append(lns, ln)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+func writeHandoffFrame(c *net.UnixConn, hdr *handoffHeader, fd int) error {
+	frame := make([]byte, 4)
+	if hdr != nil {
+		payload, err := json.Marshal(hdr)
+		if err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+		frame = append(frame, payload...)
+	}
+	var oob []byte
+	if fd >= 0 {
+		oob = unix.UnixRights(fd)
+	}
+	_, _, err := c.WriteMsgUnix(frame, oob, nil)
+	return err
+}
+
+func readHandoffFrame(c *net.UnixConn) (hdr *handoffHeader, fd int, err error) {
+	fd = -1
+	frame := make([]byte, 4)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := c.ReadMsgUnix(frame, oob)
+	if err != nil {
+		return
+	}
+	if oobn > 0 {
+		var scms []unix.SocketControlMessage
+		if scms, err = unix.ParseSocketControlMessage(oob[:oobn]); err != nil {
+			return
+		}
+		for _, scm := range scms {
+			var fds []int
+			if fds, err = unix.ParseUnixRights(&scm); err != nil {
+				return
+			}
+			for _, f := range fds {
+				if fd < 0 {
+					fd = f
+				} else {
+					_ = unix.Close(f)
+				}
+			}
+		}
+	}
+	if _, err = io.ReadFull(c, frame[n:]); err != nil {
+		return
+	}
+
+	size := binary.BigEndian.Uint32(frame)
+	if size == 0 {
+		return
+	}
+	payload := make([]byte, size)
+	if _, err = io.ReadFull(c, payload); err != nil {
+		return
+	}
+	hdr = new(handoffHeader)
+	err = json.Unmarshal(payload, hdr)
+	return
+}
+
+// inheritance holds the listeners that are inherited from another process,
+// the listeners of the same address are taken in the order of being handed off.
+type inheritance struct {
+	conn      *net.UnixConn
+	logger    logging.Logger
+	listeners map[string][]*listener // inherited listeners that are not taken yet
+	taken     []*listener
+	acked     bool
+}
+
+// inheritListeners connects to the process that is handing off its listeners
+// via the Unix domain socket at path and receives the listeners, it returns
+// nil if there is no such process, i.e. the socket doesn't exist or is stale.
+func inheritListeners(path string, options *Options) (ih *inheritance, err error) {
+	logger := options.Logger
+	var c *net.UnixConn
+	deadline := time.Now().Add(handoffDialTimeout)
+	for {
+		c, err = net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+		if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.ECONNREFUSED) {
+			logger.Infof("no listeners to inherit via %s: %v", path, err)
+			return nil, nil
+		}
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(handoffDialInterval)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ih = &inheritance{conn: c, logger: logger, listeners: make(map[string][]*listener)}
+	defer func() {
+		if err != nil {
+			ih.close()
+			ih = nil
+		}
+	}()
+	for {
+		hdr, fd, err := readHandoffFrame(c)
+		if err != nil {
+			if fd >= 0 {
+				_ = unix.Close(fd)
+			}
+			return ih, err
+		}
+		if hdr == nil {
+			if fd >= 0 {
+				_ = unix.Close(fd)
+			}
+			break
+		}
+		if fd < 0 {
+			return ih, fmt.Errorf("gnet: no fd received for listener(%s://%s)", hdr.Network, hdr.Address)
+		}
+
+		ln := &listener{fd: fd, network: hdr.Network, address: hdr.Address, detached: 1, logger: logger}
+		ln.proxyProtocol = options.acceptsProxyProtocol(ln.network, ln.address)
+		key := listenerKey(ln.network, ln.address)
+		ih.listeners[key] = append(ih.listeners[key], ln)
+		sa, err := unix.Getsockname(fd)
+		if err != nil {
+			return ih, os.NewSyscallError("getsockname", err)
+		}
+		if ln.network == "udp" {
+			ln.addr = socket.SockaddrToUDPAddr(sa)
+		} else {
+			ln.addr = socket.SockaddrToTCPOrUnixAddr(sa)
+		}
+		// The fd might have been switched into blocking mode by the previous owner.
+		if err = unix.SetNonblock(fd, true); err != nil {
+			return ih, os.NewSyscallError("fcntl nonblock", err)
+		}
+	}
+	return
+}
+
+// take returns the next inherited listener of the given address, nil if there is none.
+func (ih *inheritance) take(network, address string) *listener {
+	if ih == nil {
+		return nil
+	}
+	key := listenerKey(network, address)
+	lns := ih.listeners[key]
+	if len(lns) == 0 {
+		return nil
+	}
+	ln := lns[0]
+	ih.listeners[key] = lns[1:]
+	ih.taken = append(ih.taken, ln)
+	return ln
+}
+
+// takeAll returns the rest of the inherited listeners of the given address.
+func (ih *inheritance) takeAll(network, address string) []*listener {
+	if ih == nil {
+		return nil
+	}
+	key := listenerKey(network, address)
+	lns := ih.listeners[key]
+	delete(ih.listeners, key)
+	ih.taken = append(ih.taken, lns...)
+	return lns
+}
+
+// ack tells the previous owner of listeners that the engine is serving on them,
+// the taken listeners are owned by this process from then on.
+func (ih *inheritance) ack() {
+	if ih == nil {
+		return
+	}
+	if _, err := ih.conn.Write([]byte{handoffAck}); err != nil {
+		ih.logger.Errorf("failed to acknowledge the hand-off of listeners: %v", err)
+		return
+	}
+	ih.acked = true
+	for _, ln := range ih.taken {
+		atomic.StoreInt32(&ln.detached, 0)
+	}
+}
+
+// close closes the connection to the previous owner of listeners and
+// the inherited listeners which are not taken.
+func (ih *inheritance) close() {
+	if ih == nil {
+		return
+	}
+	_ = ih.conn.Close()
+	for key, lns := range ih.listeners {
+		for _, ln := range lns {
+			if ih.acked {
+				ih.logger.Warnf("inherited listener(%s) is not in use, closing it", key)
+				atomic.StoreInt32(&ln.detached, 0)
+			}
+			ln.close()
+		}
+	}
+	ih.listeners = nil
+}
@@ -0,0 +1,142 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandoff(t *testing.T) {
+	t.Run("tcp-reuseport", func(t *testing.T) {
+		testHandoff(t, "tcp://"+freeAddr(t, "tcp"), WithReusePort(true), WithNumEventLoop(2))
+	})
+	t.Run("unix", func(t *testing.T) {
+		testHandoff(t, "unix://"+sockPath(t))
+	})
+	t.Run("rollback", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "handoff.sock")
+		parent := &testHandoffServer{name: "parent"}
+		addr := runTestServer(t, parent, "tcp")
+
+		handoffCh := make(chan error, 1)
+		go func() { handoffCh <- parent.eng.Handoff(context.Background(), path) }()
+		waitForHandoffSocket(t, path)
+		child := &testHandoffServer{name: "child", shutdown: true}
+		child.booted = make(chan struct{})
+		require.NoError(t, Run(child, "tcp://127.0.0.1:0", WithReuseAddr(true), WithHandoffSocket(path)))
+		require.Error(t, <-handoffCh)
+
+		// The parent keeps serving.
+		assert.Equal(t, "parent", handoffEcho(t, "tcp", addr))
+	})
+	t.Run("no-parent", func(t *testing.T) {
+		// Neither a missing socket nor a stale one holds up the start.
+		path := filepath.Join(t.TempDir(), "handoff.sock")
+		stale := filepath.Join(t.TempDir(), "stale.sock")
+		l, err := net.ListenUnix("unix", &net.UnixAddr{Name: stale, Net: "unix"})
+		require.NoError(t, err)
+		l.SetUnlinkOnClose(false)
+		require.NoError(t, l.Close())
+
+		for _, p := range []string{path, stale} {
+			s := &testHandoffServer{name: "fresh"}
+			start := time.Now()
+			addr := runTestServer(t, s, "tcp", WithHandoffSocket(p))
+			assert.Less(t, time.Since(start), time.Second)
+			assert.Equal(t, "fresh", handoffEcho(t, "tcp", addr))
+			s.stop(t)
+		}
+	})
+}
+
+// waitForHandoffSocket waits for Engine.Handoff to listen on the socket at path.
+func waitForHandoffSocket(t *testing.T, path string) {
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func testHandoff(t *testing.T, protoAddr string, opts ...Option) {
+	path := filepath.Join(t.TempDir(), "handoff.sock")
+	network, addr, _ := strings.Cut(protoAddr, "://")
+
+	parent := &testHandoffServer{name: "parent"}
+	startTestServer(t, parent, []string{protoAddr}, opts...)
+	assert.Equal(t, "parent", handoffEcho(t, network, addr))
+
+	// The connection established before the hand-off is served by the parent until it's drained.
+	c, err := net.Dial(network, addr)
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	handoffCh := make(chan error, 1)
+	go func() { handoffCh <- parent.eng.Handoff(ctx, path) }()
+	waitForHandoffSocket(t, path)
+
+	// The child starts with the same protocol addresses as the parent.
+	child := &testHandoffServer{name: "child"}
+	startTestServer(t, child, []string{protoAddr}, append(opts, WithHandoffSocket(path))...)
+
+	require.NoError(t, <-handoffCh)
+	require.NoError(t, <-parent.errCh)
+	_, err = c.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	// New connections are served by the child.
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "child", handoffEcho(t, network, addr))
+	}
+	if network == "unix" {
+		assert.FileExists(t, addr)
+	}
+
+	child.stop(t)
+	if network == "unix" {
+		assert.NoFileExists(t, addr)
+	}
+}
+
+func handoffEcho(t *testing.T, network, addr string) string {
+	c, err := net.Dial(network, addr)
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Write([]byte{'?'})
+	require.NoError(t, err)
+	name, err := io.ReadAll(c)
+	require.NoError(t, err)
+	return string(name)
+}
+
+type testHandoffServer struct {
+	testBaseServer
+	name     string
+	shutdown bool
+}
+
+func (s *testHandoffServer) OnBoot(eng Engine) (action Action) {
+	s.testBaseServer.OnBoot(eng)
+	if s.shutdown {
+		action = Shutdown
+	}
+	return
+}
+
+func (s *testHandoffServer) OnTraffic(c Conn) (action Action) {
+	_, _ = c.Discard(-1)
+	_, _ = c.Write([]byte(s.name))
+	return Close
+}
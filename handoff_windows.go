@@ -0,0 +1,38 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import (
+	"context"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// Handoff is not supported on Windows.
+func (e Engine) Handoff(_ context.Context, _ string) error {
+	return errorx.ErrUnsupportedOp
+}
+
+type inheritance struct{}
+
+func inheritListeners(_ string, _ *Options) (*inheritance, error) {
+	return nil, errorx.ErrUnsupportedOp
+}
+
+func (ih *inheritance) take(_, _ string) *listener {
+	return nil
+}
+
+func (ih *inheritance) close() {}
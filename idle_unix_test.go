@@ -0,0 +1,66 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	s := &testIdleTimeoutServer{closeCh: make(chan error, 1)}
+	addr := runTestServer(t, s, "tcp", WithIdleTimeout(300*time.Millisecond))
+
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	// Keep the connection active for a while.
+	var active time.Time
+	buf := make([]byte, 5)
+	for i := 0; i < 5; i++ {
+		active = time.Now()
+		_, err = c.Write([]byte("hello"))
+		require.NoError(t, err)
+		_, err = io.ReadFull(c, buf)
+		require.NoError(t, err)
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Zero(t, atomic.LoadInt32(&s.idle), "an active connection should not be idle")
+
+	select {
+	case err = <-s.closeCh:
+		assert.ErrorIs(t, err, errorx.ErrIdleTimeout)
+		// The connection was kept at the first time.
+		assert.EqualValues(t, 2, atomic.LoadInt32(&s.idle))
+		assert.GreaterOrEqual(t, time.Since(active), 600*time.Millisecond)
+	case <-time.After(3 * time.Second):
+		require.Fail(t, "idle connection should have been closed")
+	}
+}
+
+type testIdleTimeoutServer struct {
+	testEchoServer
+	idle    int32
+	closeCh chan error
+}
+
+func (s *testIdleTimeoutServer) OnIdle(Conn) (action Action) {
+	if atomic.AddInt32(&s.idle, 1) == 1 {
+		return None
+	}
+	return Close
+}
+
+func (s *testIdleTimeoutServer) OnClose(_ Conn, err error) (action Action) {
+	s.closeCh <- err
+	return
+}
@@ -41,11 +41,12 @@ type Poller struct {
 	asyncTaskQueue              queue.AsyncTaskQueue // queue with low priority
 	urgentAsyncTaskQueue        queue.AsyncTaskQueue // queue with high priority
 	highPriorityEventsThreshold int32                // threshold of high-priority events
+	logger                      logging.Logger       // logger of the engine that owns the poller
 }
 
-// OpenPoller instantiates a poller.
-func OpenPoller() (poller *Poller, err error) {
-	poller = new(Poller)
+// OpenPoller instantiates a poller, which logs via the given logger.
+func OpenPoller(logger logging.Logger) (poller *Poller, err error) {
+	poller = &Poller{logger: logger}
 	if poller.fd, err = unix.EpollCreate1(unix.EPOLL_CLOEXEC); err != nil {
 		poller = nil
 		err = os.NewSyscallError("epoll_create1", err)
@@ -124,7 +125,7 @@ func (p *Poller) Polling(callback PollEventHandler) error {
 			runtime.Gosched()
 			continue
 		} else if err != nil {
-			logging.Errorf("error occurs in epoll: %v", os.NewSyscallError("epoll_wait", err))
+			p.logger.Errorf("error occurs in epoll: %v", os.NewSyscallError("epoll_wait", err))
 			return err
 		}
 		msec = 0
@@ -170,7 +171,7 @@ func (p *Poller) Polling(callback PollEventHandler) error {
 						continue
 					}
 					if err != nil {
-						logging.Errorf("failed to notify next round of event-loop for leftover tasks, %v", os.NewSyscallError("write", err))
+						p.logger.Errorf("failed to notify next round of event-loop for leftover tasks, %v", os.NewSyscallError("write", err))
 					}
 					break
 				}
@@ -235,6 +236,23 @@ func (p *Poller) ModReadWrite(pa *PollAttachment, edgeTriggered bool) error {
 		unix.EpollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &unix.EpollEvent{Fd: int32(pa.FD), Events: ev}))
 }
 
+// ModWrite renews the given file-descriptor with writable event in the poller.
+func (p *Poller) ModWrite(pa *PollAttachment, edgeTriggered bool) error {
+	var ev uint32 = WriteEvents
+	if edgeTriggered {
+		ev |= unix.EPOLLET
+	}
+	return os.NewSyscallError("epoll_ctl mod",
+		unix.EpollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &unix.EpollEvent{Fd: int32(pa.FD), Events: ev}))
+}
+
+// ModNone renews the given file-descriptor with no events in the poller,
+// only the exceptional events are reported for it from then on.
+func (p *Poller) ModNone(pa *PollAttachment) error {
+	return os.NewSyscallError("epoll_ctl mod",
+		unix.EpollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &unix.EpollEvent{Fd: int32(pa.FD)}))
+}
+
 // Delete removes the given file-descriptor from the poller.
 func (p *Poller) Delete(fd int) error {
 	return os.NewSyscallError("epoll_ctl del", unix.EpollCtl(p.fd, unix.EPOLL_CTL_DEL, fd, nil))
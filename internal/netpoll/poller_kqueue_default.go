@@ -39,11 +39,12 @@ type Poller struct {
 	asyncTaskQueue              queue.AsyncTaskQueue // queue with low priority
 	urgentAsyncTaskQueue        queue.AsyncTaskQueue // queue with high priority
 	highPriorityEventsThreshold int32                // threshold of high-priority events
+	logger                      logging.Logger       // logger of the engine that owns the poller
 }
 
-// OpenPoller instantiates a poller.
-func OpenPoller() (poller *Poller, err error) {
-	poller = new(Poller)
+// OpenPoller instantiates a poller, which logs via the given logger.
+func OpenPoller(logger logging.Logger) (poller *Poller, err error) {
+	poller = &Poller{logger: logger}
 	if poller.fd, err = unix.Kqueue(); err != nil {
 		poller = nil
 		err = os.NewSyscallError("kqueue", err)
@@ -108,7 +109,7 @@ func (p *Poller) Polling(callback PollEventHandler) error {
 			runtime.Gosched()
 			continue
 		} else if err != nil {
-			logging.Errorf("error occurs in kqueue: %v", os.NewSyscallError("kevent wait", err))
+			p.logger.Errorf("error occurs in kqueue: %v", os.NewSyscallError("kevent wait", err))
 			return err
 		}
 		tsp = &ts
@@ -219,6 +220,14 @@ func (p *Poller) ModReadWrite(pa *PollAttachment, edgeTriggered bool) error {
 	return os.NewSyscallError("kevent add", err)
 }
 
+// DeleteRead removes the readable event of the given file-descriptor from the poller.
+func (p *Poller) DeleteRead(pa *PollAttachment) error {
+	_, err := unix.Kevent(p.fd, []unix.Kevent_t{
+		{Ident: keventIdent(pa.FD), Flags: unix.EV_DELETE, Filter: unix.EVFILT_READ},
+	}, nil, nil)
+	return os.NewSyscallError("kevent delete", err)
+}
+
 // Delete removes the given file-descriptor from the poller.
 func (*Poller) Delete(_ int) error {
 	return nil
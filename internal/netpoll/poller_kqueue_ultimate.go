@@ -40,11 +40,12 @@ type Poller struct {
 	asyncTaskQueue              queue.AsyncTaskQueue // queue with low priority
 	urgentAsyncTaskQueue        queue.AsyncTaskQueue // queue with high priority
 	highPriorityEventsThreshold int32                // threshold of high-priority events
+	logger                      logging.Logger       // logger of the engine that owns the poller
 }
 
-// OpenPoller instantiates a poller.
-func OpenPoller() (poller *Poller, err error) {
-	poller = new(Poller)
+// OpenPoller instantiates a poller, which logs via the given logger.
+func OpenPoller(logger logging.Logger) (poller *Poller, err error) {
+	poller = &Poller{logger: logger}
 	if poller.fd, err = unix.Kqueue(); err != nil {
 		poller = nil
 		err = os.NewSyscallError("kqueue", err)
@@ -109,7 +110,7 @@ func (p *Poller) Polling() error {
 			runtime.Gosched()
 			continue
 		} else if err != nil {
-			logging.Errorf("error occurs in kqueue: %v", os.NewSyscallError("kevent wait", err))
+			p.logger.Errorf("error occurs in kqueue: %v", os.NewSyscallError("kevent wait", err))
 			return err
 		}
 		tsp = &ts
@@ -232,6 +233,16 @@ func (p *Poller) ModReadWrite(pa *PollAttachment, edgeTriggered bool) error {
 	return os.NewSyscallError("kevent add", err)
 }
 
+// DeleteRead removes the readable event of the given file-descriptor from the poller.
+func (p *Poller) DeleteRead(pa *PollAttachment) error {
+	var evs [1]unix.Kevent_t
+	evs[0].Ident = keventIdent(pa.FD)
+	evs[0].Filter = unix.EVFILT_READ
+	evs[0].Flags = unix.EV_DELETE
+	_, err := unix.Kevent(p.fd, evs[:], nil, nil)
+	return os.NewSyscallError("kevent delete", err)
+}
+
 // Delete removes the given file-descriptor from the poller.
 func (p *Poller) Delete(_ int) error {
 	return nil
@@ -17,11 +17,7 @@
 
 package netpoll
 
-import (
-	"golang.org/x/sys/unix"
-
-	"github.com/panjf2000/gnet/v2/pkg/logging"
-)
+import "golang.org/x/sys/unix"
 
 func (p *Poller) addWakeupEvent() error {
 	_, err := unix.Kevent(p.fd, []unix.Kevent_t{{
@@ -48,7 +44,7 @@ retry:
 		// to make a 100% commitment.
 		goto retry
 	}
-	logging.Warnf("failed to wake up the poller: %v", err)
+	p.logger.Warnf("failed to wake up the poller: %v", err)
 	return err
 }
 
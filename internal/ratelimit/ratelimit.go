@@ -0,0 +1,122 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit implements the token bucket algorithm. Bucket is not concurrency-safe,
+// the callers are supposed to guard the buckets shared among goroutines by themselves,
+// while Limiter can be shared among goroutines as it is.
+package ratelimit
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Bucket is a token bucket that is refilled at a fixed rate up to its capacity.
+type Bucket struct {
+	rate   float64   // tokens refilled per second
+	burst  float64   // capacity of the bucket
+	tokens float64   // tokens available at the time of last
+	last   time.Time // the last time when tokens were refilled
+}
+
+// New creates a full Bucket that is refilled with rate tokens per second and holds up to burst tokens,
+// burst is rounded up to the rate or 1 if it's not positive.
+func New(rate float64, burst int, now time.Time) *Bucket {
+	b := &Bucket{rate: rate, burst: float64(burst), last: now}
+	if b.burst <= 0 {
+		b.burst = math.Max(1, math.Ceil(rate))
+	}
+	b.tokens = b.burst
+	return b
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// Take takes a token from the bucket and returns 0, or it takes nothing and returns
+// how long it's going to take for a token to be available if the bucket is empty.
+func (b *Bucket) Take(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	d := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if d <= 0 {
+		d = time.Nanosecond
+	}
+	return d
+}
+
+// Put returns a token that was taken but not used to the bucket.
+func (b *Bucket) Put() {
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// Full reports whether the bucket has been refilled up to its capacity by now.
+func (b *Bucket) Full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// Limiter is a token bucket like Bucket which is safe for concurrent use without locks.
+// Instead of the tokens, it keeps the time when the bucket is going to be refilled up,
+// which is advanced by the interval between two tokens on every token taken, so that
+// a token is taken by a single compare-and-swap.
+type Limiter struct {
+	epoch    time.Time    // the time to which the times in nanoseconds are relative
+	interval int64        // nanoseconds to refill a token
+	window   int64        // nanoseconds to refill the bucket up from empty
+	full     atomic.Int64 // nanoseconds since epoch when the bucket is going to be refilled up
+}
+
+// NewLimiter creates a full Limiter that is refilled with rate tokens per second and holds up
+// to burst tokens, burst is rounded up to the rate or 1 if it's not positive.
+func NewLimiter(rate float64, burst int, now time.Time) *Limiter {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	interval := int64(math.Max(1, float64(time.Second)/rate))
+	return &Limiter{epoch: now, interval: interval, window: int64(burst) * interval}
+}
+
+// Take takes a token from the bucket and returns 0, or it takes nothing and returns
+// how long it's going to take for a token to be available if the bucket is empty.
+func (l *Limiter) Take(now time.Time) time.Duration {
+	t := int64(now.Sub(l.epoch))
+	for {
+		full := l.full.Load()
+		next := full
+		if next < t {
+			next = t
+		}
+		next += l.interval
+		if d := next - t - l.window; d > 0 {
+			return time.Duration(d)
+		}
+		if l.full.CompareAndSwap(full, next) {
+			return 0
+		}
+	}
+}
+
+// Put returns a token that was taken but not used to the bucket.
+func (l *Limiter) Put() {
+	l.full.Add(-l.interval)
+}
@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketTake(t *testing.T) {
+	now := time.Now()
+	b := New(10, 3, now)
+	assert.True(t, b.Full(now))
+
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, b.Take(now))
+	}
+	assert.Equal(t, 100*time.Millisecond, b.Take(now))
+	assert.False(t, b.Full(now))
+
+	// Half a token has been refilled.
+	now = now.Add(50 * time.Millisecond)
+	assert.Equal(t, 50*time.Millisecond, b.Take(now))
+	now = now.Add(50 * time.Millisecond)
+	assert.Zero(t, b.Take(now))
+
+	// The tokens never exceed the capacity.
+	now = now.Add(time.Hour)
+	assert.True(t, b.Full(now))
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, b.Take(now))
+	}
+	assert.NotZero(t, b.Take(now))
+
+	b.Put()
+	assert.Zero(t, b.Take(now))
+}
+
+func TestBucketDefaultBurst(t *testing.T) {
+	now := time.Now()
+	b := New(2.5, 0, now)
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, b.Take(now))
+	}
+	assert.NotZero(t, b.Take(now))
+
+	b = New(0.5, 0, now)
+	assert.Zero(t, b.Take(now))
+	assert.Equal(t, 2*time.Second, b.Take(now))
+}
+
+func TestLimiterTake(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(10, 3, now)
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, l.Take(now))
+	}
+	assert.Equal(t, 100*time.Millisecond, l.Take(now))
+
+	// Half a token has been refilled.
+	now = now.Add(50 * time.Millisecond)
+	assert.Equal(t, 50*time.Millisecond, l.Take(now))
+	now = now.Add(50 * time.Millisecond)
+	assert.Zero(t, l.Take(now))
+
+	// The tokens never exceed the capacity.
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, l.Take(now))
+	}
+	assert.NotZero(t, l.Take(now))
+
+	l.Put()
+	assert.Zero(t, l.Take(now))
+	assert.NotZero(t, l.Take(now))
+
+	l = NewLimiter(2.5, 0, now)
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, l.Take(now))
+	}
+	assert.NotZero(t, l.Take(now))
+}
+
+func TestLimiterConcurrentTake(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(1, 100, now)
+	var (
+		wg    sync.WaitGroup
+		taken atomic.Int32
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if l.Take(now) == 0 {
+					taken.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 100, taken.Load())
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package timingwheel implements a hashed timing wheel which is meant to be owned
+// and driven by a single event-loop, it's therefore not concurrency-safe except for Wheel.Len.
+//
+// Timers are intrusive list nodes that are supposed to be embedded in the objects they
+// time out, so scheduling, rescheduling and stopping a timer never allocate and take O(1),
+// advancing the wheel only visits the slots whose ticks have elapsed.
+package timingwheel
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/panjf2000/gnet/v2/internal/math"
+)
+
+// Timer is an entry of Wheel.
+type Timer struct {
+	expiration int64  // the tick at which the timer expires
+	list       *Timer // sentinel of the list where the timer is linked, nil if the timer is idle
+	prev, next *Timer
+
+	// Func is invoked when the timer expires.
+	Func func() error
+}
+
+// Scheduled reports whether the timer is pending in a wheel.
+func (t *Timer) Scheduled() bool {
+	return t.list != nil
+}
+
+// Wheel is a hashed timing wheel.
+type Wheel struct {
+	tick    int64   // duration of a tick in nanoseconds
+	mask    int64   // number of slots minus one
+	current int64   // the latest tick that has been processed
+	count   int32   // number of pending timers
+	slots   []Timer // sentinels of the timer lists
+	expired Timer   // sentinel of the list of timers which are about to fire
+}
+
+// New instantiates a Wheel with the given tick and number of slots,
+// the number of slots will be rounded up to the nearest power of two.
+func New(tick time.Duration, slots int) *Wheel {
+	if tick <= 0 {
+		tick = time.Millisecond
+	}
+	slots = math.CeilToPowerOfTwo(slots)
+	w := &Wheel{
+		tick:  int64(tick),
+		mask:  int64(slots - 1),
+		slots: make([]Timer, slots),
+	}
+	for i := range w.slots {
+		w.slots[i].prev, w.slots[i].next = &w.slots[i], &w.slots[i]
+	}
+	w.expired.prev, w.expired.next = &w.expired, &w.expired
+	w.current = time.Now().UnixNano() / w.tick
+	return w
+}
+
+// Len returns the number of pending timers, it's concurrency-safe.
+func (w *Wheel) Len() int {
+	return int(atomic.LoadInt32(&w.count))
+}
+
+// Schedule arranges for t to fire at the given time, a timer that is
+// already pending will be rescheduled.
+func (w *Wheel) Schedule(t *Timer, when time.Time) {
+	w.Stop(t)
+
+	// Round up to make sure that the timer never fires before the expected time.
+	expiration := (when.UnixNano() + w.tick - 1) / w.tick
+	if expiration <= w.current {
+		expiration = w.current + 1
+	}
+	t.expiration = expiration
+	w.link(&w.slots[expiration&w.mask], t)
+	atomic.AddInt32(&w.count, 1)
+}
+
+// Stop prevents t from firing, it returns false if t was not pending.
+func (w *Wheel) Stop(t *Timer) bool {
+	if t.list == nil {
+		return false
+	}
+	w.unlink(t)
+	atomic.AddInt32(&w.count, -1)
+	return true
+}
+
+// Advance moves the wheel forward to the given time and fires all expired timers,
+// timers may be scheduled or stopped from within Timer.Func.
+//
+// Advance stops at the first error returned by Timer.Func and returns it,
+// the rest of the expired timers will be fired by the next call.
+func (w *Wheel) Advance(now time.Time) error {
+	if target := now.UnixNano() / w.tick; target > w.current {
+		// Visiting each slot once is enough to collect all expired timers
+		// if the wheel has fallen behind more than one revolution.
+		first := w.current + 1
+		if target-first > w.mask {
+			first = target - w.mask
+		}
+		for tick := first; tick <= target; tick++ {
+			head := &w.slots[tick&w.mask]
+			for t := head.next; t != head; {
+				next := t.next
+				if t.expiration <= target {
+					w.unlink(t)
+					w.link(&w.expired, t)
+				}
+				t = next
+			}
+		}
+		w.current = target
+	}
+
+	for w.expired.next != &w.expired {
+		t := w.expired.next
+		w.unlink(t)
+		atomic.AddInt32(&w.count, -1)
+		if t.Func == nil {
+			continue
+		}
+		if err := t.Func(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Wheel) link(list, t *Timer) {
+	t.list = list
+	t.prev, t.next = list.prev, list
+	list.prev.next = t
+	list.prev = t
+}
+
+func (w *Wheel) unlink(t *Timer) {
+	t.prev.next = t.next
+	t.next.prev = t.prev
+	t.list, t.prev, t.next = nil, nil, nil
+}
@@ -0,0 +1,114 @@
+package timingwheel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWheelAdvance(t *testing.T) {
+	w := New(10*time.Millisecond, 8)
+	now := time.Now()
+
+	var fired []int
+	timers := make([]Timer, 4)
+	for i := range timers {
+		i := i
+		timers[i].Func = func() error {
+			fired = append(fired, i)
+			return nil
+		}
+	}
+	w.Schedule(&timers[0], now.Add(20*time.Millisecond))
+	w.Schedule(&timers[1], now.Add(50*time.Millisecond))
+	// Far beyond one revolution of the wheel.
+	w.Schedule(&timers[2], now.Add(500*time.Millisecond))
+	// In the past, it ought to fire at the next tick.
+	w.Schedule(&timers[3], now.Add(-time.Second))
+	require.EqualValues(t, 4, w.Len())
+
+	_ = w.Advance(now.Add(30 * time.Millisecond))
+	assert.ElementsMatch(t, []int{0, 3}, fired)
+	assert.EqualValues(t, 2, w.Len())
+	assert.False(t, timers[0].Scheduled())
+	assert.True(t, timers[1].Scheduled())
+
+	fired = fired[:0]
+	_ = w.Advance(now.Add(100 * time.Millisecond))
+	assert.Equal(t, []int{1}, fired)
+
+	fired = fired[:0]
+	_ = w.Advance(now.Add(490 * time.Millisecond))
+	assert.Empty(t, fired)
+	_ = w.Advance(now.Add(520 * time.Millisecond))
+	assert.Equal(t, []int{2}, fired)
+	assert.Zero(t, w.Len())
+}
+
+func TestWheelStopAndReschedule(t *testing.T) {
+	w := New(10*time.Millisecond, 8)
+	now := time.Now()
+
+	var a, b, c Timer
+	var fired []string
+	a.Func = func() error {
+		fired = append(fired, "a")
+		// Stopping a timer that expires at the same tick prevents it from firing.
+		assert.True(t, w.Stop(&b))
+		// Rescheduling from within the callback is allowed.
+		w.Schedule(&c, now.Add(200*time.Millisecond))
+		return nil
+	}
+	b.Func = func() error {
+		fired = append(fired, "b")
+		return nil
+	}
+	c.Func = func() error {
+		fired = append(fired, "c")
+		return nil
+	}
+
+	w.Schedule(&a, now.Add(20*time.Millisecond))
+	w.Schedule(&b, now.Add(20*time.Millisecond))
+	w.Schedule(&c, now.Add(30*time.Millisecond))
+	assert.False(t, w.Stop(&Timer{}))
+
+	_ = w.Advance(now.Add(50 * time.Millisecond))
+	assert.Equal(t, []string{"a"}, fired)
+	assert.EqualValues(t, 1, w.Len())
+
+	_ = w.Advance(now.Add(220 * time.Millisecond))
+	assert.Equal(t, []string{"a", "c"}, fired)
+	assert.Zero(t, w.Len())
+}
+
+func TestWheelAdvanceError(t *testing.T) {
+	w := New(10*time.Millisecond, 8)
+	now := time.Now()
+
+	errStop := errors.New("stop")
+	var a, b Timer
+	var fired []string
+	a.Func = func() error {
+		fired = append(fired, "a")
+		return errStop
+	}
+	b.Func = func() error {
+		fired = append(fired, "b")
+		return nil
+	}
+	w.Schedule(&a, now.Add(10*time.Millisecond))
+	w.Schedule(&b, now.Add(20*time.Millisecond))
+
+	assert.ErrorIs(t, w.Advance(now.Add(50*time.Millisecond)), errStop)
+	assert.Equal(t, []string{"a"}, fired)
+	assert.EqualValues(t, 1, w.Len())
+
+	// The leftover expired timers fire even if the time hasn't moved.
+	assert.NoError(t, w.Advance(now.Add(50*time.Millisecond)))
+	assert.Equal(t, []string{"a", "b"}, fired)
+	assert.Zero(t, w.Len())
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"fmt"
+	"net/netip"
+
+	"golang.org/x/sys/unix"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// ipFilter decides whether the peers are allowed to reach the engine by their IP addresses,
+// it's immutable once created so that it can be swapped atomically.
+type ipFilter struct {
+	allow []netip.Prefix // only the addresses in these networks are allowed if it's not empty
+	deny  []netip.Prefix // the addresses in these networks are denied, it takes precedence over allow
+}
+
+// newIPFilter validates and normalizes the networks, it returns nil if both lists are empty.
+func newIPFilter(allow, deny []netip.Prefix) (*ipFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+
+	normalize := func(prefixes []netip.Prefix) ([]netip.Prefix, error) {
+		normalized := make([]netip.Prefix, 0, len(prefixes))
+		for _, p := range prefixes {
+			if !p.IsValid() {
+				return nil, fmt.Errorf("%w: invalid network %q", errorx.ErrInvalidNetworkAddress, p)
+			}
+			if p.Addr().Is4In6() && p.Bits() >= 96 {
+				p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+			}
+			normalized = append(normalized, p.Masked())
+		}
+		return normalized, nil
+	}
+	f := new(ipFilter)
+	var err error
+	if f.allow, err = normalize(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = normalize(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// permits reports whether the peer at sa is allowed, peers other than IP are always allowed.
+func (f *ipFilter) permits(sa unix.Sockaddr) bool {
+	if f == nil {
+		return true
+	}
+	addr, ok := sockaddrToAddr(sa)
+	if !ok {
+		return true
+	}
+
+	for _, p := range f.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, p := range f.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sockaddrToAddr converts sa to an IP address with IPv4-mapped IPv6 addresses unmapped.
+func sockaddrToAddr(sa unix.Sockaddr) (netip.Addr, bool) {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return netip.AddrFrom4(sa.Addr), true
+	case *unix.SockaddrInet6:
+		return netip.AddrFrom16(sa.Addr).Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+// permits reports whether the peer at sa passes the IP filter of the engine.
+func (eng *engine) permits(sa unix.Sockaddr) bool {
+	return eng.ipFilter.Load().permits(sa)
+}
+
+// SetIPFilter replaces the allow and deny lists of Options atomically, which take effect on
+// the connections accepted and the UDP packets received afterwards, the connections that
+// have been accepted are not affected. Passing two empty lists disables the IP filter.
+func (e Engine) SetIPFilter(allow, deny []netip.Prefix) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	f, err := newIPFilter(allow, deny)
+	if err != nil {
+		return err
+	}
+	e.eng.ipFilter.Store(f)
+	return nil
+}
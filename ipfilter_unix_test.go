@@ -0,0 +1,77 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+func TestIPFilter(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		s := &testAdmissionServer{rejectCh: make(chan error, 1)}
+		addr := runTestServer(t, s, "tcp", WithIPFilter(nil, []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}))
+
+		expectDenied := func() {
+			c, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer c.Close()
+			require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+			_, err = c.Read(make([]byte, 1))
+			assert.ErrorIs(t, err, io.EOF)
+			select {
+			case err = <-s.rejectCh:
+				assert.ErrorIs(t, err, errorx.ErrAddressDenied)
+			case <-time.After(time.Second):
+				require.FailNow(t, "OnReject is not fired")
+			}
+		}
+		expectDenied()
+		assert.EqualValues(t, 1, s.eng.AdmissionStats().RejectedByIPFilter)
+
+		// The deny list takes precedence over the allow list.
+		require.NoError(t, s.eng.SetIPFilter(
+			[]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+			[]netip.Prefix{netip.MustParsePrefix("::ffff:127.0.0.1/128")}))
+		expectDenied()
+
+		require.NoError(t, s.eng.SetIPFilter([]netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}, nil))
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer c.Close()
+		echoConn(t, c)
+
+		require.NoError(t, s.eng.SetIPFilter([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, nil))
+		expectDenied()
+		assert.EqualValues(t, 3, s.eng.AdmissionStats().RejectedByIPFilter)
+		assert.ErrorIs(t, s.eng.SetIPFilter([]netip.Prefix{{}}, nil), errorx.ErrInvalidNetworkAddress)
+	})
+	t.Run("udp", func(t *testing.T) {
+		s := &testAdmissionServer{rejectCh: make(chan error, 1)}
+		addr := runTestServer(t, s, "udp", WithIPFilter([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, nil))
+
+		c, err := net.Dial("udp", addr)
+		require.NoError(t, err)
+		defer c.Close()
+		_, err = c.Write([]byte("ping"))
+		require.NoError(t, err)
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(300*time.Millisecond)))
+		_, err = c.Read(make([]byte, 4))
+		assert.True(t, errors.Is(err, os.ErrDeadlineExceeded), err)
+		assert.EqualValues(t, 1, s.eng.AdmissionStats().DroppedByIPFilter)
+
+		require.NoError(t, s.eng.SetIPFilter(nil, nil))
+		echoConn(t, c)
+	})
+}
@@ -22,6 +22,8 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/sys/unix"
 
@@ -39,6 +41,10 @@ type listener struct {
 	sockOptInts      []socket.Option[int]
 	sockOptStrs      []socket.Option[string]
 	pollAttachment   *netpoll.PollAttachment // listener attachment for poller
+	detached         int32                   // whether the listener is shared with another process
+	throttle         *time.Timer             // timer to watch the listener again after it's throttled by Options.AcceptRate
+	proxyProtocol    bool                    // whether the connections start with a PROXY protocol header
+	logger           logging.Logger
 }
 
 func (ln *listener) packPollAttachment(handler netpoll.PollEventHandler) *netpoll.PollAttachment {
@@ -46,6 +52,21 @@ func (ln *listener) packPollAttachment(handler netpoll.PollEventHandler) *netpol
 	return ln.pollAttachment
 }
 
+// listenerKey identifies a listener by its normalized network and the address it was created with.
+func listenerKey(network, address string) string {
+	switch {
+	case strings.HasPrefix(network, "tcp"):
+		network = "tcp"
+	case strings.HasPrefix(network, "udp"):
+		network = "udp"
+	}
+	return network + "://" + address
+}
+
+func (ln *listener) key() string {
+	return listenerKey(ln.network, ln.address)
+}
+
 func (ln *listener) dup() (int, error) {
 	return socket.Dup(ln.fd)
 }
@@ -71,10 +92,15 @@ func (ln *listener) close() {
 	ln.once.Do(
 		func() {
 			if ln.fd > 0 {
-				logging.Error(os.NewSyscallError("close", unix.Close(ln.fd)))
+				if err := unix.Close(ln.fd); err != nil {
+					ln.logger.Errorf("failed to close listener(%s): %v", ln.key(), os.NewSyscallError("close", err))
+				}
 			}
-			if ln.network == "unix" {
-				logging.Error(os.RemoveAll(ln.address))
+			// The socket file is still in use if the listener is shared with another process.
+			if ln.network == "unix" && atomic.LoadInt32(&ln.detached) == 0 {
+				if err := os.RemoveAll(ln.address); err != nil {
+					ln.logger.Errorf("failed to remove socket file of listener(%s): %v", ln.key(), err)
+				}
 			}
 		})
 }
@@ -84,7 +110,8 @@ func initListener(network, addr string, options *Options) (l *listener, err erro
 		sockOptInts []socket.Option[int]
 		sockOptStrs []socket.Option[string]
 	)
-	if options.ReusePort || strings.HasPrefix(network, "udp") {
+	// SO_REUSEPORT is not supported for Unix domain sockets.
+	if (options.ReusePort && network != "unix") || strings.HasPrefix(network, "udp") {
 		sockOpt := socket.Option[int]{SetSockOpt: socket.SetReuseport, Opt: 1}
 		sockOptInts = append(sockOptInts, sockOpt)
 	}
@@ -117,7 +144,14 @@ func initListener(network, addr string, options *Options) (l *listener, err erro
 		sockOpt := socket.Option[string]{SetSockOpt: socket.SetBindToDevice, Opt: options.BindToDevice}
 		sockOptStrs = append(sockOptStrs, sockOpt)
 	}
-	l = &listener{network: network, address: addr, sockOptInts: sockOptInts, sockOptStrs: sockOptStrs}
+	l = &listener{
+		network:       network,
+		address:       addr,
+		sockOptInts:   sockOptInts,
+		sockOptStrs:   sockOptStrs,
+		proxyProtocol: options.acceptsProxyProtocol(network, addr),
+		logger:        options.Logger,
+	}
 	err = l.normalize()
 	return
 }
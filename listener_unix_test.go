@@ -0,0 +1,70 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+func TestAddRemoveListener(t *testing.T) {
+	t.Run("reactors", func(t *testing.T) {
+		// The listeners are addressed by the addresses they're created with, so they need fixed ports.
+		addr1, addr2 := freeAddr(t, "tcp"), freeAddr(t, "tcp")
+		s := new(testEchoServer)
+		startTestServer(t, s, []string{"tcp://" + addr1}, WithNumEventLoop(2))
+		echoOver(t, "tcp", addr1)
+
+		require.NoError(t, s.eng.AddListener("tcp://"+addr2))
+		echoOver(t, "tcp", addr2)
+		assert.ErrorIs(t, s.eng.AddListener("tcp://"+addr2), errorx.ErrListenerExists)
+		assert.ErrorIs(t, s.eng.AddListener("udp://"+addr2), errorx.ErrUnsupportedOp)
+
+		// The connection accepted from the removed listener is still alive.
+		c, err := net.Dial("tcp", addr1)
+		require.NoError(t, err)
+		defer c.Close()
+		require.Eventually(t, func() bool { return s.eng.CountConnections() == 1 }, time.Second, 10*time.Millisecond)
+		require.NoError(t, s.eng.RemoveListener("tcp://"+addr1))
+		_, err = net.Dial("tcp", addr1)
+		assert.Error(t, err)
+		echoConn(t, c)
+		echoOver(t, "tcp", addr2)
+
+		assert.ErrorIs(t, s.eng.RemoveListener("tcp://"+addr1), errorx.ErrListenerNotFound)
+		assert.ErrorIs(t, s.eng.RemoveListener("tcp://"+addr2), errorx.ErrUnsupportedOp)
+	})
+
+	t.Run("reuseport", func(t *testing.T) {
+		addr1, addr2, addr3 := freeAddr(t, "tcp"), freeAddr(t, "tcp"), freeAddr(t, "udp")
+		sock := sockPath(t)
+		s := new(testEchoServer)
+		startTestServer(t, s, []string{"tcp://" + addr1}, WithReusePort(true), WithNumEventLoop(2))
+
+		require.NoError(t, s.eng.AddListener("tcp://"+addr2))
+		require.NoError(t, s.eng.AddListener("udp://"+addr3))
+		require.NoError(t, s.eng.AddListener("unix://"+sock))
+		for i := 0; i < 10; i++ {
+			echoOver(t, "tcp", addr2)
+			echoOver(t, "udp", addr3)
+			echoOver(t, "unix", sock)
+		}
+
+		require.NoError(t, s.eng.RemoveListener("tcp://"+addr1))
+		require.NoError(t, s.eng.RemoveListener("udp://"+addr3))
+		require.NoError(t, s.eng.RemoveListener("unix://"+sock))
+		_, err := net.Dial("tcp", addr1)
+		assert.Error(t, err)
+		assert.NoFileExists(t, sock)
+		for i := 0; i < 10; i++ {
+			echoOver(t, "tcp", addr2)
+		}
+	})
+}
@@ -35,6 +35,7 @@ type listener struct {
 	ln      net.Listener
 	pc      net.PacketConn
 	addr    net.Addr
+	logger  logging.Logger
 }
 
 func (l *listener) dup() (int, error) {
@@ -85,11 +86,15 @@ func (l *listener) dup() (int, error) {
 
 func (l *listener) close() {
 	l.once.Do(func() {
+		var err error
 		if l.pc != nil {
-			logging.Error(os.NewSyscallError("close", l.pc.Close()))
-			return
+			err = l.pc.Close()
+		} else {
+			err = l.ln.Close()
+		}
+		if err != nil {
+			l.logger.Errorf("failed to close listener(%s://%s): %v", l.network, l.address, err)
 		}
-		logging.Error(os.NewSyscallError("close", l.ln.Close()))
 	})
 }
 
@@ -113,7 +118,7 @@ func initListener(network, addr string, options *Options) (l *listener, err erro
 		},
 		KeepAlive: options.TCPKeepAlive,
 	}
-	l = &listener{network: network, address: addr}
+	l = &listener{network: network, address: addr, logger: options.Logger}
 	switch network {
 	case "udp", "udp4", "udp6":
 		if l.pc, err = lc.ListenPacket(context.Background(), network, addr); err != nil {
@@ -15,6 +15,8 @@
 package gnet
 
 import (
+	"crypto/tls"
+	"net/netip"
 	"time"
 
 	"github.com/panjf2000/gnet/v2/pkg/logging"
@@ -148,6 +150,153 @@ type Options struct {
 	// 1MB is used. The value of EdgeTriggeredIOChunk must be a power of 2,
 	// otherwise, it will be rounded up to the nearest power of 2.
 	EdgeTriggeredIOChunk int
+
+	// IdleTimeout is the maximum amount of time that a connection is allowed to stay
+	// without reading or writing any data, the connection will be closed with
+	// errors.ErrIdleTimeout when it's idle for longer than that, unless the EventHandler
+	// implements IdleHandler and decides to keep it. Zero means no timeout.
+	//
+	// Note that idle connections are detected by the timer of event-loop with a resolution of 100ms.
+	IdleTimeout time.Duration
+
+	// DrainTimeout is the maximum amount of time that Engine.Stop waits for connections
+	// to flush their pending outbound data after the listeners stop accepting, connections
+	// will be closed forcibly when it expires. Zero means shutting down without draining.
+	// The UDP sockets keep serving during draining, and are closed along with the engine.
+	DrainTimeout time.Duration
+
+	// HandoffSocket is the path of the Unix domain socket via which the engine inherits
+	// the listeners from another process that is calling Engine.Handoff, the addresses
+	// that are not handed off will be listened on as usual, and so are all addresses
+	// if no process is listening on the socket, e.g. on the first start.
+	HandoffSocket string
+
+	// PanicRecovery recovers the panics in the callbacks of EventHandler and AsyncCallback
+	// that are invoked by event-loops instead of crashing the whole process, the panic is
+	// logged along with the stack trace, the connection in question is closed with
+	// errors.ErrPanicRecovered and PanicHandler.OnPanic fires if EventHandler implements it.
+	PanicRecovery bool
+
+	// OutboundHighWatermark is the number of bytes pending in the outbound buffer of a connection
+	// at which writing to the connection starts failing with errors.ErrOutboundBufferFull,
+	// until the outbound buffer drains to OutboundLowWatermark, when WritableHandler.OnWritable
+	// fires if EventHandler implements it. The write that takes the outbound buffer to it is
+	// buffered as a whole, however large it is. Zero means no limit.
+	OutboundHighWatermark int
+
+	// OutboundLowWatermark is the number of bytes pending in the outbound buffer of a connection
+	// at which writing to the connection is resumed after reaching OutboundHighWatermark.
+	// It's set to half of OutboundHighWatermark if it's not less than OutboundHighWatermark.
+	OutboundLowWatermark int
+
+	// MaxConns is the maximum number of connections that the engine accepts at the same time,
+	// the connections beyond it are rejected with errors.ErrTooManyConns. Zero means no limit.
+	MaxConns int
+
+	// MaxConnsPerLoop is the maximum number of accepted connections that an event-loop serves
+	// at the same time. A connection assigned to an event-loop that has reached it is served by
+	// the event-loop with the fewest connections instead, and it's rejected with
+	// errors.ErrTooManyConnsOnLoop only if all event-loops have reached it. Zero means no limit.
+	MaxConnsPerLoop int
+
+	// MaxConnsPerSource is the maximum number of connections accepted from the same source
+	// at the same time, the connections beyond it are rejected with errors.ErrTooManyConnsFromSource.
+	// The source of a TCP connection is its remote IP masked by SourcePrefixLenV4 or SourcePrefixLenV6.
+	// Zero means no limit.
+	MaxConnsPerSource int
+
+	// SourcePrefixLenV4 is the prefix length of the IPv4 networks by which the connections
+	// are grouped for MaxConnsPerSource, each IPv4 address is a source on its own by default.
+	SourcePrefixLenV4 int
+
+	// SourcePrefixLenV6 is the prefix length of the IPv6 networks by which the connections
+	// are grouped for MaxConnsPerSource, each IPv6 address is a source on its own by default.
+	SourcePrefixLenV6 int
+
+	// RejectPayload is written to the connections rejected by MaxConns, MaxConnsPerLoop or
+	// MaxConnsPerSource before they're closed, the connections are closed straightaway if it's empty.
+	RejectPayload []byte
+
+	// AcceptRate is the maximum number of connections accepted per second, the listeners are not
+	// watched while the rate is exceeded, so that the excess connections wait in the backlog of
+	// kernel instead of being accepted and dropped. Zero means no limit.
+	AcceptRate float64
+
+	// AcceptBurst is the maximum number of connections accepted at once under AcceptRate,
+	// it's AcceptRate rounded up if it's not set.
+	AcceptBurst int
+
+	// AcceptRatePerSource is the maximum number of connections accepted from the same source
+	// per second, where the sources are made up as MaxConnsPerSource, the connections beyond it
+	// are rejected with errors.ErrAcceptRateExceeded. Zero means no limit.
+	AcceptRatePerSource float64
+
+	// AcceptBurstPerSource is the maximum number of connections accepted at once from
+	// the same source under AcceptRatePerSource, it's AcceptRatePerSource rounded up if it's not set.
+	AcceptBurstPerSource int
+
+	// AllowList is the networks from which the connections are accepted and the UDP packets are received,
+	// the peers out of them are rejected with errors.ErrAddressDenied before any connection is created.
+	// All peers are allowed if it's empty. It can be replaced at runtime via Engine.SetIPFilter.
+	AllowList []netip.Prefix
+
+	// DenyList is the networks from which the connections are rejected with errors.ErrAddressDenied and
+	// the UDP packets are dropped, it takes precedence over AllowList. It can be replaced at runtime
+	// via Engine.SetIPFilter.
+	DenyList []netip.Prefix
+
+	// ProxyProtocol is the protocol addresses of the listeners whose connections start with
+	// a PROXY protocol header of version 1 or 2, as passed to Run, Rotate or Engine.AddListener.
+	// OnOpen fires after the header is received, with Conn.RemoteAddr and Conn.LocalAddr being
+	// the original addresses in it and Conn.ProxyHeader returning it. The connections that send
+	// a malformed header or no header within ProxyProtocolTimeout are closed without firing
+	// OnOpen, and are reported to RejectHandler.OnReject if EventHandler implements it.
+	//
+	// Note that the connection limits and the IP filter apply to the addresses of proxies,
+	// and this option is only available for stream-oriented protocols.
+	ProxyProtocol []string
+
+	// ProxyProtocolTimeout is the maximum amount of time to receive the PROXY protocol header
+	// on the listeners in ProxyProtocol, 5 seconds by default.
+	ProxyProtocolTimeout time.Duration
+
+	// TLSConfig enables TLS on all stream-oriented connections of the engine, or of the Client
+	// as the client-side configuration. OnOpen fires after the TLS handshake completes, then
+	// OnTraffic sees the decrypted data and the data written to Conn is encrypted. The connections
+	// that fail the handshake or don't complete it within TLSHandshakeTimeout are closed without
+	// firing OnOpen, and are reported to RejectHandler.OnReject if EventHandler implements it.
+	//
+	// ServerName of the client-side configuration defaults to the host dialed by Client.Dial.
+	// The configuration can be replaced at runtime via Engine.SetTLSConfig, and certificates
+	// can be rotated and selected by SNI with tls.Config.GetCertificate, e.g. certstore.Store.
+	TLSConfig *tls.Config
+
+	// TLSHandshakeTimeout is the maximum amount of time to complete the TLS handshake, 10 seconds by default.
+	TLSHandshakeTimeout time.Duration
+
+	// MaxTLSHandshakesPerLoop is the maximum number of TLS handshakes in progress on an event-loop
+	// at the same time, each of which takes a goroutine until it completes or times out, 1024 by default.
+	// The connections beyond it are closed with errors.ErrTooManyTLSHandshakes before the handshake.
+	MaxTLSHandshakesPerLoop int
+
+	// StreamTransform creates the StreamTransform of each stream-oriented connection accepted by the engine,
+	// which transforms all bytes of the connection in both directions, beneath TLS and above the PROXY protocol.
+	// OnOpen fires after the header of the transform is received, then OnTraffic sees the transformed data
+	// through Peek, Next and the like, and the data written to Conn, as well as the data pushed to it by
+	// Engine.AsyncWrite, is transformed before it's sent. The connections that send an invalid header or no header
+	// within StreamTransformTimeout are closed without firing OnOpen, and are reported to RejectHandler.OnReject
+	// if EventHandler implements it.
+	StreamTransform func() StreamTransform
+
+	// StreamTransformTimeout is the maximum amount of time to receive the header of the StreamTransform,
+	// 5 seconds by default.
+	StreamTransformTimeout time.Duration
+
+	// MessageEncoding takes the data pushed to the connections by Engine.AsyncWrite, Engine.AsyncWriteKey and
+	// Engine.Broadcast as messages, which are encoded by the contexts of the connections that implement
+	// MessageEncoder, e.g. the codecs of the transports detected for each connection. The data is written
+	// as it is to the other connections, and to all connections if it's disabled.
+	MessageEncoding bool
 }
 
 // WithOptions sets up all options.
@@ -300,3 +449,139 @@ func WithEdgeTriggeredIOChunk(chunk int) Option {
 		opts.EdgeTriggeredIOChunk = chunk
 	}
 }
+
+// WithIdleTimeout sets the maximum amount of time that a connection is allowed to stay idle.
+func WithIdleTimeout(idleTimeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.IdleTimeout = idleTimeout
+	}
+}
+
+// WithDrainTimeout sets the maximum amount of time to drain connections during Engine.Stop.
+func WithDrainTimeout(drainTimeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.DrainTimeout = drainTimeout
+	}
+}
+
+// WithHandoffSocket sets the path of the Unix domain socket to inherit listeners from.
+func WithHandoffSocket(path string) Option {
+	return func(opts *Options) {
+		opts.HandoffSocket = path
+	}
+}
+
+// WithOutboundWatermarks sets the low and high watermarks of the outbound buffer of connections.
+func WithOutboundWatermarks(low, high int) Option {
+	return func(opts *Options) {
+		opts.OutboundLowWatermark = low
+		opts.OutboundHighWatermark = high
+	}
+}
+
+// WithPanicRecovery sets up panic recovery for the callbacks invoked by event-loops.
+func WithPanicRecovery(recovery bool) Option {
+	return func(opts *Options) {
+		opts.PanicRecovery = recovery
+	}
+}
+
+// WithMaxConns sets the maximum number of connections that the engine accepts at the same time.
+func WithMaxConns(maxConns int) Option {
+	return func(opts *Options) {
+		opts.MaxConns = maxConns
+	}
+}
+
+// WithMaxConnsPerLoop sets the maximum number of accepted connections that an event-loop serves at the same time.
+func WithMaxConnsPerLoop(maxConns int) Option {
+	return func(opts *Options) {
+		opts.MaxConnsPerLoop = maxConns
+	}
+}
+
+// WithMaxConnsPerSource sets the maximum number of connections accepted from the same source
+// at the same time, and the prefix lengths of the IPv4 and IPv6 networks that make up sources.
+func WithMaxConnsPerSource(maxConns, prefixLenV4, prefixLenV6 int) Option {
+	return func(opts *Options) {
+		opts.MaxConnsPerSource = maxConns
+		opts.SourcePrefixLenV4 = prefixLenV4
+		opts.SourcePrefixLenV6 = prefixLenV6
+	}
+}
+
+// WithRejectPayload sets the payload written to the connections rejected by the connection limits.
+func WithRejectPayload(payload []byte) Option {
+	return func(opts *Options) {
+		opts.RejectPayload = payload
+	}
+}
+
+// WithAcceptRate sets the maximum number of connections accepted per second and at once.
+func WithAcceptRate(rate float64, burst int) Option {
+	return func(opts *Options) {
+		opts.AcceptRate = rate
+		opts.AcceptBurst = burst
+	}
+}
+
+// WithAcceptRatePerSource sets the maximum number of connections accepted from the same source per second and at once.
+func WithAcceptRatePerSource(rate float64, burst int) Option {
+	return func(opts *Options) {
+		opts.AcceptRatePerSource = rate
+		opts.AcceptBurstPerSource = burst
+	}
+}
+
+// WithIPFilter sets the networks from which peers are allowed and denied.
+func WithIPFilter(allow, deny []netip.Prefix) Option {
+	return func(opts *Options) {
+		opts.AllowList = allow
+		opts.DenyList = deny
+	}
+}
+
+// WithProxyProtocol sets the listeners that accept the PROXY protocol and the timeout to receive the header.
+func WithProxyProtocol(timeout time.Duration, protoAddrs ...string) Option {
+	return func(opts *Options) {
+		opts.ProxyProtocolTimeout = timeout
+		opts.ProxyProtocol = protoAddrs
+	}
+}
+
+// WithTLSConfig enables TLS with config.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(opts *Options) {
+		opts.TLSConfig = config
+	}
+}
+
+// WithTLSHandshakeTimeout sets the maximum amount of time to complete the TLS handshake.
+func WithTLSHandshakeTimeout(timeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.TLSHandshakeTimeout = timeout
+	}
+}
+
+// WithMaxTLSHandshakesPerLoop sets the maximum number of TLS handshakes in progress on an event-loop at the same time.
+func WithMaxTLSHandshakesPerLoop(maxHandshakes int) Option {
+	return func(opts *Options) {
+		opts.MaxTLSHandshakesPerLoop = maxHandshakes
+	}
+}
+
+// WithStreamTransform sets the constructor of the StreamTransform of each connection and the timeout
+// to receive the header of the transform.
+func WithStreamTransform(timeout time.Duration, newTransform func() StreamTransform) Option {
+	return func(opts *Options) {
+		opts.StreamTransformTimeout = timeout
+		opts.StreamTransform = newTransform
+	}
+}
+
+// WithMessageEncoding sets up whether the data pushed to the connections is encoded by their contexts.
+func WithMessageEncoding(messageEncoding bool) Option {
+	return func(opts *Options) {
+		opts.MessageEncoding = messageEncoding
+	}
+}
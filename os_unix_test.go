@@ -4,10 +4,12 @@
 package gnet
 
 import (
+	"bufio"
 	"context"
 	crand "crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
 	"regexp"
@@ -20,10 +22,13 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 	"golang.org/x/sys/unix"
 
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
 	"github.com/panjf2000/gnet/v2/pkg/logging"
+	bbPool "github.com/panjf2000/gnet/v2/pkg/pool/bytebuffer"
+	goPool "github.com/panjf2000/gnet/v2/pkg/pool/goroutine"
 )
 
 var (
@@ -406,7 +411,6 @@ func TestBindToDevice(t *testing.T) {
 	})
 }
 
-/*
 func TestEngineAsyncWrite(t *testing.T) {
 	t.Run("tcp", func(t *testing.T) {
 		t.Run("1-loop", func(t *testing.T) {
@@ -492,7 +496,7 @@ func (s *testEngineAsyncWriteServer) OnTraffic(c Conn) (action Action) {
 				bs := make([][]byte, 2)
 				bs[0] = buf.B[:mid]
 				bs[1] = buf.B[mid:]
-				_ = s.eng.AsyncWritev(gFD, bs, func(c Conn, err error) error {
+				_ = s.eng.AsyncWritevGFD(gFD, bs, func(c Conn, err error) error {
 					if c.RemoteAddr() != nil {
 						logging.Debugf("conn=%s done writev: %v", c.RemoteAddr().String(), err)
 					}
@@ -500,7 +504,7 @@ func (s *testEngineAsyncWriteServer) OnTraffic(c Conn) (action Action) {
 					return nil
 				})
 			} else {
-				_ = s.eng.AsyncWrite(gFD, buf.Bytes(), func(c Conn, err error) error {
+				_ = s.eng.AsyncWriteGFD(gFD, buf.Bytes(), func(c Conn, err error) error {
 					if c.RemoteAddr() != nil {
 						logging.Debugf("conn=%s done write: %v", c.RemoteAddr().String(), err)
 					}
@@ -592,7 +596,7 @@ type testEngineWakeConnServer struct {
 	eng     Engine
 	network string
 	addr    string
-	gFD     chan gfd.GFD
+	gFD     chan GFD
 	wake    bool
 }
 
@@ -632,7 +636,7 @@ func (t *testEngineWakeConnServer) OnTick() (delay time.Duration, action Action)
 		return
 	}
 	gFD := <-t.gFD
-	_ = t.eng.Wake(gFD, func(c Conn, err error) error {
+	_ = t.eng.WakeGFD(gFD, func(c Conn, err error) error {
 		logging.Debugf("conn=%s done wake: %v", c.RemoteAddr().String(), err)
 		return nil
 	})
@@ -641,7 +645,7 @@ func (t *testEngineWakeConnServer) OnTick() (delay time.Duration, action Action)
 }
 
 func testEngineWakeConn(t *testing.T, network, addr string) {
-	svr := &testEngineWakeConnServer{tester: t, network: network, addr: addr, gFD: make(chan gfd.GFD, 1)}
+	svr := &testEngineWakeConnServer{tester: t, network: network, addr: addr, gFD: make(chan GFD, 1)}
 	logger := zap.NewExample()
 	err := Run(svr, network+"://"+addr,
 		WithTicker(true),
@@ -715,7 +719,7 @@ func (s *testEngineClosedWakeUpServer) OnTraffic(c Conn) Action {
 	fd := c.Gfd()
 
 	go func() { require.NoError(s.tester, c.Wake(nil)) }()
-	go s.eng.Close(fd, nil)
+	go s.eng.CloseGFD(fd, nil)
 
 	<-s.clientClosed
 
@@ -731,4 +735,3 @@ func (s *testEngineClosedWakeUpServer) OnClose(Conn, error) (action Action) {
 	}
 	return
 }
-*/
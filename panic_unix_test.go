@@ -0,0 +1,77 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	s := &testPanicServer{panicCh: make(chan any, 2), closeCh: make(chan error, 2)}
+	addr := runTestServer(t, s, "tcp", WithPanicRecovery(true))
+
+	survivor, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer survivor.Close()
+	echoConn(t, survivor)
+
+	for _, cmd := range []string{"panic", "async"} {
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		_, err = c.Write([]byte(cmd))
+		require.NoError(t, err)
+
+		assert.Equal(t, cmd, <-s.panicCh)
+		assert.ErrorIs(t, <-s.closeCh, errorx.ErrPanicRecovered)
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err = io.ReadAll(c)
+		assert.NoError(t, err, "the connection is supposed to be closed by the server")
+		_ = c.Close()
+
+		// Other connections are unaffected.
+		echoConn(t, survivor)
+	}
+}
+
+type testPanicServer struct {
+	testBaseServer
+	panicCh chan any
+	closeCh chan error
+}
+
+func (s *testPanicServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	switch string(buf) {
+	case "panic":
+		panic("panic")
+	case "async":
+		_ = c.AsyncWrite([]byte("async"), func(Conn, error) error {
+			panic("async")
+		})
+	default:
+		_, _ = c.Write(buf)
+	}
+	return
+}
+
+func (s *testPanicServer) OnPanic(c Conn, v any) {
+	if c != nil {
+		s.panicCh <- v
+	}
+}
+
+func (s *testPanicServer) OnClose(_ Conn, err error) (action Action) {
+	if err != nil {
+		s.closeCh <- err
+	}
+	return
+}
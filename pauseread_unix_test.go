@@ -0,0 +1,83 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	crand "crypto/rand"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPauseResumeRead(t *testing.T) {
+	t.Run("lt", func(t *testing.T) {
+		testPauseResumeRead(t)
+	})
+	t.Run("et", func(t *testing.T) {
+		testPauseResumeRead(t, WithEdgeTriggeredIO(true))
+	})
+}
+
+func testPauseResumeRead(t *testing.T, opts ...Option) {
+	s := &testPauseReadServer{openCh: make(chan Conn, 1), traffic: make(chan string, 16)}
+	addr := runTestServer(t, s, "tcp", opts...)
+
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	gc := <-s.openCh
+
+	require.NoError(t, gc.PauseRead())
+	require.NoError(t, gc.PauseRead())
+	_, err = c.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	// Writing works while reading is paused, including the data pending in the outbound buffer.
+	data := make([]byte, 8<<20)
+	_, _ = crand.Read(data)
+	require.NoError(t, gc.AsyncWrite(data, nil))
+	buf := make([]byte, len(data))
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(3*time.Second)))
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+	require.Equal(t, data, buf)
+
+	select {
+	case msg := <-s.traffic:
+		require.FailNow(t, "OnTraffic is not supposed to fire while reading is paused", "got %q", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	require.NoError(t, gc.ResumeRead())
+	select {
+	case msg := <-s.traffic:
+		assert.Equal(t, "hello", msg)
+	case <-time.After(time.Second):
+		require.FailNow(t, "OnTraffic is not fired after resuming reading")
+	}
+	_, err = c.Write([]byte("world"))
+	require.NoError(t, err)
+	assert.Equal(t, "world", <-s.traffic)
+}
+
+type testPauseReadServer struct {
+	testBaseServer
+	openCh  chan Conn
+	traffic chan string
+}
+
+func (s *testPauseReadServer) OnOpen(c Conn) (out []byte, action Action) {
+	s.openCh <- c
+	return
+}
+
+func (s *testPauseReadServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	s.traffic <- string(buf)
+	return
+}
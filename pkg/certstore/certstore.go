@@ -0,0 +1,162 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package certstore provides a set of TLS certificates that can be replaced
+// atomically at runtime and from which the certificate is selected by SNI.
+//
+// Plug Store.GetCertificate into tls.Config.GetCertificate, or use the config
+// returned by Store.Config, then the certificates can be rotated by Store.Set
+// or Store.Load without restarting the engine:
+//
+//	store := certstore.New()
+//	if err := store.Load(certstore.KeyPairFile{CertFile: "a.crt", KeyFile: "a.key"}); err != nil {
+//		...
+//	}
+//	gnet.Run(handler, "tcp://:443", gnet.WithTLSConfig(store.Config(nil)))
+package certstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// ErrNoCertificates occurs when there are no certificates to set or to select from.
+	ErrNoCertificates = errors.New("certstore: no certificates")
+	// ErrNoCertificateForName occurs when there is no certificate for the server name
+	// of the client and Store.Strict is set.
+	ErrNoCertificateForName = errors.New("certstore: no certificate for server name")
+)
+
+// KeyPairFile is the pair of PEM encoded files of a certificate and its private key.
+type KeyPairFile struct {
+	CertFile string
+	KeyFile  string
+}
+
+// certSet is an immutable set of certificates indexed by the names they're valid for.
+type certSet struct {
+	byName map[string]*tls.Certificate
+	def    *tls.Certificate
+}
+
+// Store is a set of TLS certificates, it's safe for concurrent use.
+type Store struct {
+	set atomic.Pointer[certSet]
+
+	// Strict makes GetCertificate fail rather than fall back to the default certificate
+	// when no certificate matches the server name of the client, it must be set before
+	// the store is used.
+	Strict bool
+}
+
+// New creates an empty Store.
+func New() *Store {
+	return new(Store)
+}
+
+// Set replaces all certificates of the store with certs atomically, the first one is the
+// default certificate which is used for the clients sending no or an unknown server name.
+//
+// A certificate is selected by the DNS names of its leaf certificate, or by its common name
+// if there are none, with wildcard names like "*.example.com" matching a single label.
+func (s *Store) Set(certs ...tls.Certificate) error {
+	if len(certs) == 0 {
+		return ErrNoCertificates
+	}
+
+	certs = append([]tls.Certificate(nil), certs...)
+	set := &certSet{byName: make(map[string]*tls.Certificate)}
+	for i := range certs {
+		cert := &certs[i]
+		leaf := cert.Leaf
+		if leaf == nil {
+			if len(cert.Certificate) == 0 {
+				return ErrNoCertificates
+			}
+			var err error
+			if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+				return err
+			}
+			cert.Leaf = leaf
+		}
+		names := leaf.DNSNames
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, ok := set.byName[name]; !ok {
+				set.byName[name] = cert
+			}
+		}
+	}
+	set.def = &certs[0]
+	s.set.Store(set)
+	return nil
+}
+
+// Load loads the certificates from files and replaces all certificates of the store with them
+// as Set does, the certificates of the store are kept if any of the files fails to be loaded.
+func (s *Store) Load(files ...KeyPairFile) error {
+	certs := make([]tls.Certificate, 0, len(files))
+	for _, f := range files {
+		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+	return s.Set(certs...)
+}
+
+// GetCertificate selects the certificate for the server name of hello,
+// it's meant to be used as tls.Config.GetCertificate.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := s.set.Load()
+	if set == nil {
+		return nil, ErrNoCertificates
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := set.byName[name]; ok {
+		return cert, nil
+	}
+	// Try the wildcard name by replacing the first label with "*".
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := set.byName["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	if s.Strict {
+		return nil, ErrNoCertificateForName
+	}
+	return set.def, nil
+}
+
+// Config returns a copy of base, or of an empty config if base is nil, whose certificates come from the store.
+func (s *Store) Config(base *tls.Config) *tls.Config {
+	var config *tls.Config
+	if base == nil {
+		config = new(tls.Config)
+	} else {
+		config = base.Clone()
+	}
+	config.Certificates = nil
+	config.GetCertificate = s.GetCertificate
+	return config
+}
@@ -0,0 +1,95 @@
+package certstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCert(t *testing.T, cn string, dnsNames ...string) (cert tls.Certificate, certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	cert = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return
+}
+
+func selected(t *testing.T, s *Store, serverName string) string {
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	require.NoError(t, err)
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestStoreSelect(t *testing.T) {
+	a, _, _ := newCert(t, "a", "a.example.com", "www.example.com")
+	b, _, _ := newCert(t, "b", "*.example.com")
+	c, _, _ := newCert(t, "c.example.com")
+
+	s := New()
+	_, err := s.GetCertificate(&tls.ClientHelloInfo{})
+	assert.ErrorIs(t, err, ErrNoCertificates)
+	assert.ErrorIs(t, s.Set(), ErrNoCertificates)
+
+	require.NoError(t, s.Set(a, b, c))
+	assert.Equal(t, "a", selected(t, s, "a.example.com"))
+	assert.Equal(t, "a", selected(t, s, "WWW.Example.com."))
+	assert.Equal(t, "b", selected(t, s, "x.example.com"))
+	assert.Equal(t, "c.example.com", selected(t, s, "c.example.com"))
+	assert.Equal(t, "a", selected(t, s, "x.y.example.com"))
+	assert.Equal(t, "a", selected(t, s, ""))
+
+	s.Strict = true
+	_, err = s.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.org"})
+	assert.ErrorIs(t, err, ErrNoCertificateForName)
+
+	require.NoError(t, s.Set(c))
+	assert.Equal(t, "c.example.com", selected(t, s, "c.example.com"))
+	_, err = s.GetCertificate(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	assert.ErrorIs(t, err, ErrNoCertificateForName)
+}
+
+func TestStoreLoad(t *testing.T) {
+	dir := t.TempDir()
+	_, certPEM, keyPEM := newCert(t, "a", "a.example.com")
+	certFile, keyFile := filepath.Join(dir, "a.crt"), filepath.Join(dir, "a.key")
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	s := New()
+	require.NoError(t, s.Load(KeyPairFile{CertFile: certFile, KeyFile: keyFile}))
+	assert.Equal(t, "a", selected(t, s, "a.example.com"))
+
+	// The certificates are kept if loading fails.
+	assert.Error(t, s.Load(KeyPairFile{CertFile: keyFile, KeyFile: certFile}))
+	assert.Equal(t, "a", selected(t, s, "a.example.com"))
+
+	config := s.Config(&tls.Config{MinVersion: tls.VersionTLS13})
+	assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+	cert, err := config.GetCertificate(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "a", cert.Leaf.Subject.CommonName)
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package codec splits the byte streams of connections into frames and encodes the messages into frames,
+// with the codecs of length-field-based frames, delimiter-based frames and fixed-length frames.
+//
+// Handler is a gnet.EventHandler that decodes the frames with a Codec and hands the messages over
+// to EventHandler.OnMessage one by one:
+//
+//	type server struct {
+//		gnet.BuiltinEventEngine
+//		codec codec.Codec
+//	}
+//
+//	func (s *server) OnMessage(c gnet.Conn, msg []byte) gnet.Action {
+//		_ = s.codec.Encode(c, msg)
+//		return gnet.None
+//	}
+//
+//	lc, _ := codec.NewLengthFieldCodec(codec.LengthFieldConfig{LengthFieldLength: 4, InitialBytesToStrip: 4})
+//	gnet.Run(codec.NewHandler(&server{codec: lc}, lc), "tcp://:9000")
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+var (
+	// ErrIncompleteFrame occurs when decoding a frame that hasn't been received completely.
+	ErrIncompleteFrame = errors.New("codec: incomplete frame")
+	// ErrFrameTooLarge occurs when the size of a frame exceeds the maximum of the codec.
+	ErrFrameTooLarge = errors.New("codec: frame too large")
+	// ErrInvalidFrame occurs when a frame is malformed, or a message can't be encoded into a frame.
+	ErrInvalidFrame = errors.New("codec: invalid frame")
+)
+
+// defaultMaxFrameSize is the maximum size of frames if the codec is not configured with one.
+const defaultMaxFrameSize = 4 << 20
+
+// Codec decodes the frames from the inbound buffer of a connection and encodes the messages into frames.
+// The built-in codecs keep no state of connections, so each of them can be shared by all connections,
+// the codecs with states are set as the contexts of the connections instead, see Handler.
+type Codec interface {
+	// Decode consumes a frame from r and returns the message in it, which is only valid until
+	// the next read from r, i.e. it must be copied to be retained after OnTraffic returns.
+	// It returns ErrIncompleteFrame and consumes nothing if the frame is incomplete.
+	//
+	// The connection must be closed after any other error, since the stream can't be split any more.
+	Decode(r gnet.Reader) (msg []byte, err error)
+
+	// Encode writes the frame of msg to w, the parts of the frame are written with
+	// a single Writev if w is a gnet.Writer.
+	Encode(w io.Writer, msg []byte) error
+}
+
+// Encode returns the frame of msg encoded by cd, e.g. for gnet.Conn.AsyncWrite or gnet.Engine.AsyncWrite.
+func Encode(cd Codec, msg []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := cd.Encode(&buf, msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteFrame writes the parts of a frame to w, with a single Writev if w is a gnet.Writer.
+func WriteFrame(w io.Writer, parts ...[]byte) error {
+	if wv, ok := w.(interface{ Writev([][]byte) (int, error) }); ok {
+		_, err := wv.Writev(parts)
+		return err
+	}
+	for _, p := range parts {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EventHandler is a gnet.EventHandler that is notified of the messages instead of the traffic,
+// its OnTraffic is never invoked by Handler.
+type EventHandler interface {
+	gnet.EventHandler
+
+	// OnMessage fires when a complete frame is decoded, msg is only valid until it returns.
+	OnMessage(c gnet.Conn, msg []byte) (action gnet.Action)
+}
+
+// Handler is a gnet.EventHandler that decodes the frames on the connections with a Codec,
+// all events other than OnTraffic are passed through to EventHandler.
+//
+// The context of a connection takes the place of the Codec of Handler if it's a Codec, so that the codecs
+// with states can be created for each connection in EventHandler.OnOpen. Such a context also encodes the data
+// pushed by gnet.Engine.AsyncWrite with gnet.WithMessageEncoding, since it implements gnet.MessageEncoder.
+type Handler struct {
+	EventHandler
+	codec Codec
+}
+
+// NewHandler creates a Handler that decodes the frames with codec and hands the messages over to eh,
+// codec can be nil if the contexts of all connections are Codecs.
+func NewHandler(eh EventHandler, codec Codec) *Handler {
+	return &Handler{EventHandler: eh, codec: codec}
+}
+
+// OnTraffic decodes the complete frames in the inbound buffer, the connection is closed
+// if a frame is malformed or too large.
+func (h *Handler) OnTraffic(c gnet.Conn) (action gnet.Action) {
+	cd, ok := c.Context().(Codec)
+	if !ok {
+		if cd = h.codec; cd == nil {
+			return gnet.Close
+		}
+	}
+	for {
+		msg, err := cd.Decode(c)
+		if errors.Is(err, ErrIncompleteFrame) {
+			return gnet.None
+		}
+		if err != nil {
+			return gnet.Close
+		}
+		if action = h.OnMessage(c, msg); action != gnet.None {
+			return
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package codec
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// testReader is a gnet.Reader over a byte slice.
+type testReader struct {
+	gnet.Reader
+	buf []byte
+}
+
+func (r *testReader) Next(n int) ([]byte, error) {
+	buf, err := r.Peek(n)
+	if err == nil {
+		r.buf = r.buf[len(buf):]
+	}
+	return buf, err
+}
+
+func (r *testReader) Peek(n int) ([]byte, error) {
+	if n > len(r.buf) {
+		return nil, io.ErrShortBuffer
+	} else if n <= 0 {
+		n = len(r.buf)
+	}
+	return r.buf[:n], nil
+}
+
+func (r *testReader) Discard(n int) (int, error) {
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *testReader) InboundBuffered() int {
+	return len(r.buf)
+}
+
+// decodeAll decodes the frames in data that is fed to cd byte by byte.
+func decodeAll(cd Codec, data []byte) (msgs []string, err error) {
+	r := &testReader{}
+	for _, b := range data {
+		r.buf = append(r.buf, b)
+		for {
+			msg, err := cd.Decode(r)
+			if errors.Is(err, ErrIncompleteFrame) {
+				break
+			}
+			if err != nil {
+				return msgs, err
+			}
+			msgs = append(msgs, string(msg))
+		}
+	}
+	if len(r.buf) > 0 {
+		return msgs, ErrIncompleteFrame
+	}
+	return
+}
+
+func TestLengthFieldCodec(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config LengthFieldConfig
+		frame  []byte // frame of "hello"
+	}{
+		{"big endian", LengthFieldConfig{LengthFieldLength: 2, InitialBytesToStrip: 2},
+			[]byte("\x00\x05hello")},
+		{"little endian including the length field", LengthFieldConfig{
+			ByteOrder: binary.LittleEndian, LengthFieldLength: 3, LengthAdjustment: -3, InitialBytesToStrip: 3,
+		}, []byte("\x08\x00\x00hello")},
+		{"varint", LengthFieldConfig{Varint: true, InitialBytesToStrip: 1}, []byte("\x05hello")},
+		{"header", LengthFieldConfig{LengthFieldOffset: 2, LengthFieldLength: 4},
+			[]byte("he\x00\x00\x00\x03llo")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lc, err := NewLengthFieldCodec(tc.config)
+			require.NoError(t, err)
+			frame, err := Encode(lc, []byte("hello"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.frame, frame)
+
+			if tc.config.LengthFieldOffset > 0 {
+				// The header isn't stripped, so the frame is decoded with the length field in it.
+				msgs, err := decodeAll(lc, frame)
+				require.NoError(t, err)
+				assert.Equal(t, []string{string(tc.frame)}, msgs)
+				return
+			}
+			msgs, err := decodeAll(lc, bytes.Repeat(frame, 3))
+			require.NoError(t, err)
+			assert.Equal(t, []string{"hello", "hello", "hello"}, msgs)
+		})
+	}
+
+	lc, err := NewLengthFieldCodec(LengthFieldConfig{Varint: true, InitialBytesToStrip: 1, MaxFrameSize: 200})
+	require.NoError(t, err)
+	msg := strings.Repeat("a", 150)
+	frame, err := Encode(lc, []byte(msg))
+	require.NoError(t, err)
+	assert.Len(t, frame, 152)
+	msgs, err := decodeAll(lc, frame)
+	require.NoError(t, err)
+	assert.Equal(t, []string{msg}, msgs)
+	_, err = Encode(lc, make([]byte, 199))
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+	_, err = decodeAll(lc, []byte("\xc8\x01"))
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+	_, err = decodeAll(lc, []byte("\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\x01"))
+	assert.ErrorIs(t, err, ErrInvalidFrame)
+
+	_, err = NewLengthFieldCodec(LengthFieldConfig{LengthFieldLength: 5})
+	assert.Error(t, err)
+	lc, err = NewLengthFieldCodec(LengthFieldConfig{LengthFieldLength: 1, LengthAdjustment: -2})
+	require.NoError(t, err)
+	_, err = decodeAll(lc, []byte("\x01"))
+	assert.ErrorIs(t, err, ErrInvalidFrame)
+	_, err = Encode(lc, make([]byte, 258))
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+}
+
+func TestDelimiterCodec(t *testing.T) {
+	dc := NewDelimiterCodec([]byte("||"), 8)
+	frame, err := Encode(dc, []byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello||", string(frame))
+	msgs, err := decodeAll(dc, []byte("hello||||12345678||"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hello", "", "12345678"}, msgs)
+	_, err = decodeAll(dc, []byte("123456789||"))
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+	assert.ErrorIs(t, dc.Encode(io.Discard, []byte("123456789")), ErrFrameTooLarge)
+
+	lc := NewLineCodec(1024)
+	frame, err = Encode(lc, []byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello\r\n", string(frame))
+	long := strings.Repeat("a", 1000)
+	msgs, err = decodeAll(lc, []byte("hello\r\nworld\n"+long+"\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hello", "world", long}, msgs)
+	_, err = decodeAll(lc, []byte(long+long))
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+}
+
+func TestFixedLengthCodec(t *testing.T) {
+	fc := NewFixedLengthCodec(4)
+	msgs, err := decodeAll(fc, []byte("abcdefgh"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"abcd", "efgh"}, msgs)
+	_, err = Encode(fc, []byte("abc"))
+	assert.ErrorIs(t, err, ErrInvalidFrame)
+}
+
+type testServer struct {
+	gnet.BuiltinEventEngine
+	codec   Codec
+	eng     gnet.Engine
+	booted  chan struct{}
+	closeCh chan struct{}
+}
+
+func (s *testServer) OnBoot(eng gnet.Engine) gnet.Action {
+	s.eng = eng
+	close(s.booted)
+	return gnet.None
+}
+
+func (s *testServer) OnMessage(c gnet.Conn, msg []byte) gnet.Action {
+	if string(msg) == "quit" {
+		return gnet.Close
+	}
+	_ = s.codec.Encode(c, bytes.ToUpper(msg))
+	return gnet.None
+}
+
+func (s *testServer) OnClose(_ gnet.Conn, _ error) gnet.Action {
+	s.closeCh <- struct{}{}
+	return gnet.None
+}
+
+func TestHandler(t *testing.T) {
+	lc, err := NewLengthFieldCodec(LengthFieldConfig{LengthFieldLength: 2, InitialBytesToStrip: 2, MaxFrameSize: 64})
+	require.NoError(t, err)
+	s := &testServer{codec: lc, booted: make(chan struct{}), closeCh: make(chan struct{}, 1)}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gnet.Run(NewHandler(s, lc), "tcp://127.0.0.1:9243", gnet.WithReuseAddr(true))
+	}()
+	select {
+	case <-s.booted:
+	case err := <-errCh:
+		require.FailNow(t, "engine exited before booting", "error: %v", err)
+	}
+	defer func() {
+		require.NoError(t, s.eng.Stop(context.Background()))
+		require.NoError(t, <-errCh)
+	}()
+
+	expectClosed := func(c net.Conn) {
+		_, err := c.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+		select {
+		case <-s.closeCh:
+		case <-time.After(time.Second):
+			require.FailNow(t, "timeout waiting for OnClose")
+		}
+	}
+
+	c, err := net.Dial("tcp", "127.0.0.1:9243")
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.SetDeadline(time.Now().Add(5*time.Second)))
+	// Two frames and a half in a write, followed by the other half.
+	_, err = c.Write([]byte("\x00\x03foo\x00\x03bar\x00\x04ba"))
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	_, err = c.Write([]byte("zz"))
+	require.NoError(t, err)
+	reply := make([]byte, 16)
+	_, err = io.ReadFull(c, reply)
+	require.NoError(t, err)
+	assert.Equal(t, "\x00\x03FOO\x00\x03BAR\x00\x04BAZZ", string(reply))
+	_, err = c.Write([]byte("\x00\x04quit"))
+	require.NoError(t, err)
+	expectClosed(c)
+
+	c, err = net.Dial("tcp", "127.0.0.1:9243")
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = c.Write([]byte("\x00\x41"))
+	require.NoError(t, err)
+	expectClosed(c)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// initialScanSize is the size of the inbound buffer that is first searched for the delimiter, which is
+// doubled on each miss, so that a short frame doesn't cost a copy of the whole buffer when it wraps.
+const initialScanSize = 512
+
+// DelimiterCodec is the codec of the frames that end with a delimiter, which is stripped from the messages.
+type DelimiterCodec struct {
+	delimiter    []byte
+	maxFrameSize int
+	line         bool
+}
+
+// NewDelimiterCodec creates a DelimiterCodec of delimiter, maxFrameSize is the maximum size of
+// the messages without the delimiter, which is 4MB if it's not positive.
+func NewDelimiterCodec(delimiter []byte, maxFrameSize int) *DelimiterCodec {
+	if maxFrameSize <= 0 {
+		maxFrameSize = defaultMaxFrameSize
+	}
+	return &DelimiterCodec{delimiter: append([]byte(nil), delimiter...), maxFrameSize: maxFrameSize}
+}
+
+// NewLineCodec creates a DelimiterCodec of the lines that end with "\n" or "\r\n", it encodes the lines
+// with "\r\n". maxFrameSize is the maximum size of the lines, which is 4MB if it's not positive.
+func NewLineCodec(maxFrameSize int) *DelimiterCodec {
+	dc := NewDelimiterCodec([]byte("\n"), maxFrameSize)
+	dc.line = true
+	return dc
+}
+
+// Decode consumes a frame from r and returns the message in it.
+func (dc *DelimiterCodec) Decode(r gnet.Reader) ([]byte, error) {
+	if len(dc.delimiter) == 0 {
+		return nil, fmt.Errorf("%w: empty delimiter", ErrInvalidFrame)
+	}
+	limit := dc.maxFrameSize + len(dc.delimiter)
+	if dc.line {
+		limit++ // for '\r'
+	}
+	buffered := r.InboundBuffered()
+	if buffered > limit {
+		buffered = limit
+	}
+	for n := initialScanSize; ; n *= 2 {
+		if n > buffered {
+			n = buffered
+		}
+		buf, _ := r.Peek(n)
+		if i := bytes.Index(buf, dc.delimiter); i >= 0 {
+			frame, _ := r.Next(i + len(dc.delimiter))
+			msg := frame[:i]
+			if dc.line && len(msg) > 0 && msg[len(msg)-1] == '\r' {
+				msg = msg[:len(msg)-1]
+			}
+			if len(msg) > dc.maxFrameSize {
+				return nil, ErrFrameTooLarge
+			}
+			return msg, nil
+		}
+		if n == buffered {
+			break
+		}
+	}
+	if buffered == limit {
+		return nil, ErrFrameTooLarge
+	}
+	return nil, ErrIncompleteFrame
+}
+
+// Encode writes msg followed by the delimiter to w.
+func (dc *DelimiterCodec) Encode(w io.Writer, msg []byte) error {
+	if len(msg) > dc.maxFrameSize {
+		return ErrFrameTooLarge
+	}
+	if dc.line {
+		return WriteFrame(w, msg, []byte("\r\n"))
+	}
+	return WriteFrame(w, msg, dc.delimiter)
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// FixedLengthCodec is the codec of the frames of a fixed size, which are the messages themselves.
+type FixedLengthCodec struct {
+	frameSize int
+}
+
+// NewFixedLengthCodec creates a FixedLengthCodec of frameSize.
+func NewFixedLengthCodec(frameSize int) *FixedLengthCodec {
+	return &FixedLengthCodec{frameSize: frameSize}
+}
+
+// Decode consumes a frame from r and returns it.
+func (fc *FixedLengthCodec) Decode(r gnet.Reader) ([]byte, error) {
+	if fc.frameSize <= 0 {
+		return nil, fmt.Errorf("%w: invalid frame size %d", ErrInvalidFrame, fc.frameSize)
+	}
+	frame, err := r.Next(fc.frameSize)
+	if err != nil {
+		return nil, ErrIncompleteFrame
+	}
+	return frame, nil
+}
+
+// Encode writes msg to w, whose size must be the frame size.
+func (fc *FixedLengthCodec) Encode(w io.Writer, msg []byte) error {
+	if len(msg) != fc.frameSize {
+		return fmt.Errorf("%w: message of %d bytes in frames of %d bytes", ErrInvalidFrame, len(msg), fc.frameSize)
+	}
+	_, err := w.Write(msg)
+	return err
+}
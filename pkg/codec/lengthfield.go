@@ -0,0 +1,212 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// LengthFieldConfig is the configuration of LengthFieldCodec. A frame is laid out as:
+//
+//	+----------------------+--------------+--------------------------------------+
+//	| LengthFieldOffset    | length field | length + LengthAdjustment bytes      |
+//	+----------------------+--------------+--------------------------------------+
+//
+// and the message in it starts after the first InitialBytesToStrip bytes of the frame.
+type LengthFieldConfig struct {
+	// ByteOrder is the byte order of the length field, binary.BigEndian by default.
+	ByteOrder binary.ByteOrder
+
+	// LengthFieldOffset is the offset of the length field in the frame.
+	LengthFieldOffset int
+
+	// LengthFieldLength is the size of the length field, which is 1, 2, 3, 4 or 8.
+	// It's ignored if Varint is set.
+	LengthFieldLength int
+
+	// Varint makes the length field an unsigned varint of encoding/binary, whose size varies
+	// with the length, ByteOrder is irrelevant then.
+	Varint bool
+
+	// LengthAdjustment is added to the length to get the size of the rest of the frame after the
+	// length field, e.g. it's the negative size of the length field if the length includes it.
+	LengthAdjustment int
+
+	// InitialBytesToStrip is the number of bytes at the start of the frame that are stripped
+	// from the message, e.g. it's the size of the header to get the body alone.
+	// A varint length field counts as a single byte in it whatever its size is.
+	InitialBytesToStrip int
+
+	// MaxFrameSize is the maximum size of the frames, 4MB by default.
+	MaxFrameSize int
+}
+
+// LengthFieldCodec is the codec of the frames that carry the length of their rest in a field.
+//
+// Encode inserts the length field at LengthFieldOffset of the message, so the message must contain
+// the bytes before the length field. Therefore, Encode and Decode are symmetric if InitialBytesToStrip
+// is 0, or if LengthFieldOffset is 0 and InitialBytesToStrip is the size of the length field,
+// which is 1 for a varint.
+type LengthFieldCodec struct {
+	config LengthFieldConfig
+}
+
+// NewLengthFieldCodec creates a LengthFieldCodec with config.
+func NewLengthFieldCodec(config LengthFieldConfig) (*LengthFieldCodec, error) {
+	if config.ByteOrder == nil {
+		config.ByteOrder = binary.BigEndian
+	}
+	if config.MaxFrameSize <= 0 {
+		config.MaxFrameSize = defaultMaxFrameSize
+	}
+	if !config.Varint {
+		switch config.LengthFieldLength {
+		case 1, 2, 3, 4, 8:
+		default:
+			return nil, fmt.Errorf("codec: invalid length field length %d", config.LengthFieldLength)
+		}
+	}
+	if config.LengthFieldOffset < 0 || config.InitialBytesToStrip < 0 {
+		return nil, errors.New("codec: negative length field offset or initial bytes to strip")
+	}
+	return &LengthFieldCodec{config: config}, nil
+}
+
+// Decode consumes a frame from r and returns the message in it.
+func (lc *LengthFieldCodec) Decode(r gnet.Reader) ([]byte, error) {
+	config := &lc.config
+	offset := config.LengthFieldOffset
+	var (
+		length uint64
+		end    int // end of the length field
+	)
+	if config.Varint {
+		n := r.InboundBuffered()
+		if n > offset+binary.MaxVarintLen64 {
+			n = offset + binary.MaxVarintLen64
+		}
+		if n <= offset {
+			return nil, ErrIncompleteFrame
+		}
+		buf, _ := r.Peek(n)
+		var size int
+		if length, size = binary.Uvarint(buf[offset:]); size == 0 && n < offset+binary.MaxVarintLen64 {
+			return nil, ErrIncompleteFrame
+		} else if size <= 0 {
+			return nil, fmt.Errorf("%w: length field overflows", ErrInvalidFrame)
+		}
+		end = offset + size
+	} else {
+		end = offset + config.LengthFieldLength
+		buf, err := r.Peek(end)
+		if err != nil {
+			return nil, ErrIncompleteFrame
+		}
+		length = lc.getLength(buf[offset:end])
+	}
+
+	if length > math.MaxInt32 {
+		return nil, ErrFrameTooLarge
+	}
+	strip := config.InitialBytesToStrip
+	if config.Varint && strip > offset {
+		strip += end - offset - 1
+	}
+	size := end + int(length) + config.LengthAdjustment
+	if size < end || size < strip {
+		return nil, fmt.Errorf("%w: frame size %d is too small", ErrInvalidFrame, size)
+	}
+	if size > config.MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	frame, err := r.Next(size)
+	if err != nil {
+		return nil, ErrIncompleteFrame
+	}
+	return frame[strip:], nil
+}
+
+// Encode writes the frame of msg to w, with the length field inserted at LengthFieldOffset.
+func (lc *LengthFieldCodec) Encode(w io.Writer, msg []byte) error {
+	config := &lc.config
+	offset := config.LengthFieldOffset
+	if len(msg) < offset {
+		return fmt.Errorf("%w: message is shorter than the length field offset", ErrInvalidFrame)
+	}
+	length := len(msg) - offset - config.LengthAdjustment
+	if length < 0 {
+		return fmt.Errorf("%w: negative length %d", ErrInvalidFrame, length)
+	}
+
+	var field []byte
+	if config.Varint {
+		field = binary.AppendUvarint(nil, uint64(length))
+	} else {
+		if config.LengthFieldLength < 8 && uint64(length) >= 1<<(8*config.LengthFieldLength) {
+			return ErrFrameTooLarge
+		}
+		field = make([]byte, config.LengthFieldLength)
+		lc.putLength(field, uint64(length))
+	}
+	if len(msg)+len(field) > config.MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	return WriteFrame(w, msg[:offset], field, msg[offset:])
+}
+
+func (lc *LengthFieldCodec) getLength(b []byte) uint64 {
+	order := lc.config.ByteOrder
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(order.Uint16(b))
+	case 3:
+		if order == binary.LittleEndian {
+			return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16
+		}
+		return uint64(b[2]) | uint64(b[1])<<8 | uint64(b[0])<<16
+	case 4:
+		return uint64(order.Uint32(b))
+	default:
+		return order.Uint64(b)
+	}
+}
+
+func (lc *LengthFieldCodec) putLength(b []byte, length uint64) {
+	order := lc.config.ByteOrder
+	switch len(b) {
+	case 1:
+		b[0] = byte(length)
+	case 2:
+		order.PutUint16(b, uint16(length))
+	case 3:
+		if order == binary.LittleEndian {
+			b[0], b[1], b[2] = byte(length), byte(length>>8), byte(length>>16)
+		} else {
+			b[0], b[1], b[2] = byte(length>>16), byte(length>>8), byte(length)
+		}
+	case 4:
+		order.PutUint32(b, uint32(length))
+	default:
+		order.PutUint64(b, length)
+	}
+}
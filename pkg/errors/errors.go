@@ -43,4 +43,44 @@ var (
 	ErrNoIPv4AddressOnInterface = errors.New("gnet: no IPv4 address on interface")
 	// ErrInvalidNetworkAddress occurs when the network address is invalid.
 	ErrInvalidNetworkAddress = errors.New("gnet: invalid network address")
+	// ErrIdleTimeout occurs when a connection is closed because it has been idle for too long.
+	ErrIdleTimeout = errors.New("gnet: connection has been idle for too long")
+	// ErrListenerExists occurs when trying to add a listener on an address that is already listened on.
+	ErrListenerExists = errors.New("gnet: listener already exists")
+	// ErrListenerNotFound occurs when trying to remove a listener that doesn't exist.
+	ErrListenerNotFound = errors.New("gnet: listener not found")
+	// ErrInvalidConn occurs when the connection is invalid or has been closed.
+	ErrInvalidConn = errors.New("gnet: invalid connection")
+	// ErrOutboundBufferFull occurs when writing to a connection whose outbound buffer has reached the high watermark.
+	ErrOutboundBufferFull = errors.New("gnet: outbound buffer has reached the high watermark")
+	// ErrPanicRecovered occurs when a connection is closed because of a panic recovered from its callbacks.
+	ErrPanicRecovered = errors.New("gnet: recovered from a panic in callback")
+	// ErrTooManyConns occurs when a connection is rejected because the engine has reached Options.MaxConns.
+	ErrTooManyConns = errors.New("gnet: too many connections")
+	// ErrTooManyConnsOnLoop occurs when a connection is rejected because the event-loop has reached Options.MaxConnsPerLoop.
+	ErrTooManyConnsOnLoop = errors.New("gnet: too many connections on event-loop")
+	// ErrTooManyConnsFromSource occurs when a connection is rejected because its source has reached Options.MaxConnsPerSource.
+	ErrTooManyConnsFromSource = errors.New("gnet: too many connections from the same source")
+	// ErrAcceptRateExceeded occurs when a connection is rejected because its source has exceeded Options.AcceptRatePerSource.
+	ErrAcceptRateExceeded = errors.New("gnet: accept rate exceeded for the same source")
+	// ErrAddressDenied occurs when a connection is rejected because its remote address is denied by Options.AllowList or Options.DenyList.
+	ErrAddressDenied = errors.New("gnet: remote address is denied")
+	// ErrInvalidProxyHeader occurs when a connection is closed because it sends a malformed PROXY protocol header.
+	ErrInvalidProxyHeader = errors.New("gnet: invalid PROXY protocol header")
+	// ErrProxyHeaderTimeout occurs when a connection is closed because it doesn't send the PROXY protocol header in time.
+	ErrProxyHeaderTimeout = errors.New("gnet: timeout waiting for PROXY protocol header")
+	// ErrTLSHandshake occurs when a connection is closed because its TLS handshake fails.
+	ErrTLSHandshake = errors.New("gnet: TLS handshake failed")
+	// ErrTLSHandshakeTimeout occurs when a connection is closed because its TLS handshake doesn't complete in time.
+	ErrTLSHandshakeTimeout = errors.New("gnet: timeout waiting for TLS handshake")
+	// ErrTooManyTLSHandshakes occurs when a connection is closed because the event-loop has reached
+	// Options.MaxTLSHandshakesPerLoop.
+	ErrTooManyTLSHandshakes = errors.New("gnet: too many TLS handshakes in progress on event-loop")
+	// ErrStreamTransform occurs when a connection is closed because it sends an invalid header of the stream transform.
+	ErrStreamTransform = errors.New("gnet: invalid stream transform header")
+	// ErrStreamTransformTimeout occurs when a connection is closed because it doesn't send the header of the stream
+	// transform in time.
+	ErrStreamTransformTimeout = errors.New("gnet: timeout waiting for stream transform header")
+	// ErrOnEventLoop occurs when Engine.IterateSync is called on an event-loop, which would wait for itself forever.
+	ErrOnEventLoop = errors.New("gnet: calling on event-loop")
 )
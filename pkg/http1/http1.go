@@ -0,0 +1,192 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package http1 implements the server side of HTTP/1.1 on gnet, with keep-alive, pipelining
+// and chunked bodies in both directions. The requests are parsed incrementally from the inbound
+// buffer of the connection as the bytes arrive, and the responses are written to the connection
+// on the event-loop, without any goroutine per connection.
+//
+// Handler is a gnet.EventHandler that serves the requests with a RequestHandler:
+//
+//	h := http1.NewHandler(http1.RequestHandlerFunc(func(w *http1.ResponseWriter, r *http1.Request) {
+//		_, _ = w.Write([]byte("ok"))
+//	}), http1.Config{})
+//	gnet.Run(h, "tcp://:8080")
+//
+// Parser and ResponseWriter can also be used directly in gnet.EventHandler.OnTraffic, e.g. to serve
+// HTTP and another protocol on the same port:
+//
+//	for {
+//		req, err := parser.Parse(c)
+//		if err != nil {
+//			http1.WriteError(c, err)
+//			return gnet.Close
+//		}
+//		if req == nil {
+//			return gnet.None
+//		}
+//		w := http1.NewResponseWriter(c, req)
+//		serve(w, req)
+//		if action := w.Finish(); action != gnet.None {
+//			return action
+//		}
+//	}
+package http1
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+var (
+	// ErrBadRequest occurs when a request is malformed, it's answered with 400 Bad Request.
+	ErrBadRequest = errors.New("http1: malformed request")
+	// ErrHeaderTooLarge occurs when the header or the trailer of a request exceeds Config.MaxHeaderSize,
+	// it's answered with 431 Request Header Fields Too Large.
+	ErrHeaderTooLarge = errors.New("http1: request header too large")
+	// ErrBodyTooLarge occurs when the body of a request exceeds Config.MaxBodySize,
+	// it's answered with 413 Content Too Large.
+	ErrBodyTooLarge = errors.New("http1: request body too large")
+	// ErrUnsupportedVersion occurs when a request isn't of HTTP/1.x, it's answered with
+	// 505 HTTP Version Not Supported.
+	ErrUnsupportedVersion = errors.New("http1: unsupported HTTP version")
+	// ErrUnsupportedTransferEncoding occurs when a request is encoded by anything other than chunked,
+	// it's answered with 501 Not Implemented.
+	ErrUnsupportedTransferEncoding = errors.New("http1: unsupported transfer encoding")
+	// ErrBodyNotAllowed occurs when writing the body of a response whose status doesn't allow one.
+	ErrBodyNotAllowed = errors.New("http1: response status doesn't allow a body")
+)
+
+// badRequest returns an ErrBadRequest with reason.
+func badRequest(reason string) error {
+	return fmt.Errorf("%w: %s", ErrBadRequest, reason)
+}
+
+// ErrorStatus returns the status code of the response to a request that fails to be parsed with err.
+func ErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrHeaderTooLarge):
+		return http.StatusRequestHeaderFieldsTooLarge
+	case errors.Is(err, ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrUnsupportedVersion):
+		return http.StatusHTTPVersionNotSupported
+	case errors.Is(err, ErrUnsupportedTransferEncoding):
+		return http.StatusNotImplemented
+	}
+	return http.StatusBadRequest
+}
+
+// WriteError writes the response to a request that fails to be parsed with err,
+// the connection must be closed after it.
+func WriteError(w gnet.Writer, err error) {
+	status := ErrorStatus(err)
+	_, _ = fmt.Fprintf(w, "HTTP/1.1 %d %s\r\nConnection: close\r\nContent-Length: 0\r\n\r\n",
+		status, http.StatusText(status))
+}
+
+const (
+	defaultMaxHeaderSize = 8 << 10
+	defaultMaxBodySize   = 4 << 20
+)
+
+// Config is the configuration of Parser and Handler.
+type Config struct {
+	// MaxHeaderSize is the maximum size of the request line and the header of a request,
+	// which also limits the size of the trailer of a chunked body, 8KB by default.
+	MaxHeaderSize int
+
+	// MaxBodySize is the maximum size of the body of a request, 4MB by default.
+	// The body is buffered in full before the request is handed over.
+	MaxBodySize int64
+}
+
+func (config *Config) setDefaults() {
+	if config.MaxHeaderSize <= 0 {
+		config.MaxHeaderSize = defaultMaxHeaderSize
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = defaultMaxBodySize
+	}
+}
+
+// RequestHandler serves the requests on the event-loops, the response is buffered in
+// ResponseWriter and sent when ServeHTTP returns, unless ResponseWriter.Flush is called.
+//
+// Note that neither r nor w may be retained after ServeHTTP returns.
+type RequestHandler interface {
+	ServeHTTP(w *ResponseWriter, r *Request)
+}
+
+// RequestHandlerFunc is an adapter to use an ordinary function as RequestHandler.
+type RequestHandlerFunc func(w *ResponseWriter, r *Request)
+
+// ServeHTTP calls f(w, r).
+func (f RequestHandlerFunc) ServeHTTP(w *ResponseWriter, r *Request) {
+	f(w, r)
+}
+
+var continueResponse = []byte("HTTP/1.1 100 Continue\r\n\r\n")
+
+// Handler is a gnet.EventHandler that serves HTTP/1.1 on the connections, it can be embedded
+// in another gnet.EventHandler to handle the events of the engine, e.g. OnBoot and OnTick.
+//
+// The context of the connections is occupied by Handler.
+type Handler struct {
+	*gnet.BuiltinEventEngine
+	rh     RequestHandler
+	config Config
+}
+
+// NewHandler creates a Handler that serves the requests with rh.
+func NewHandler(rh RequestHandler, config Config) *Handler {
+	config.setDefaults()
+	return &Handler{rh: rh, config: config}
+}
+
+// OnOpen creates the Parser of the connection.
+func (h *Handler) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
+	c.SetContext(NewParser(h.config))
+	return
+}
+
+// OnTraffic serves the complete requests in the inbound buffer in order,
+// the rest of the bytes are kept until more of them arrive.
+func (h *Handler) OnTraffic(c gnet.Conn) (action gnet.Action) {
+	p, ok := c.Context().(*Parser)
+	if !ok {
+		return gnet.Close
+	}
+	for {
+		req, err := p.Parse(c)
+		if err != nil {
+			WriteError(c, err)
+			return gnet.Close
+		}
+		if req == nil {
+			if p.ExpectContinue() {
+				_, _ = c.Write(continueResponse)
+			}
+			return gnet.None
+		}
+		w := NewResponseWriter(c, req)
+		h.rh.ServeHTTP(w, req)
+		if action = w.Finish(); action != gnet.None {
+			return
+		}
+	}
+}
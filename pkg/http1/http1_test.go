@@ -0,0 +1,204 @@
+package http1
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+type testServer struct {
+	*Handler
+	eng    gnet.Engine
+	booted chan struct{}
+}
+
+func (s *testServer) OnBoot(eng gnet.Engine) gnet.Action {
+	s.eng = eng
+	close(s.booted)
+	return gnet.None
+}
+
+func serveTest(w *ResponseWriter, r *Request) {
+	switch r.URL.Path {
+	case "/stream":
+		_, _ = w.Write([]byte("hello, "))
+		_ = w.Flush()
+		_, _ = w.Write([]byte("world"))
+	case "/empty":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("X-Trailer", r.Trailer.Get("X-Checksum"))
+		_, _ = fmt.Fprintf(w, "%s %s %s", r.Method, r.RequestURI, r.Body)
+	}
+}
+
+func runServer(t *testing.T, addr string, config Config) (stop func()) {
+	s := &testServer{Handler: NewHandler(RequestHandlerFunc(serveTest), config), booted: make(chan struct{})}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gnet.Run(s, "tcp://"+addr, gnet.WithReuseAddr(true))
+	}()
+	select {
+	case <-s.booted:
+	case err := <-errCh:
+		require.FailNow(t, "engine exited before booting", "error: %v", err)
+	}
+	return func() {
+		require.NoError(t, s.eng.Stop(context.Background()))
+		require.NoError(t, <-errCh)
+	}
+}
+
+func dial(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	require.NoError(t, c.SetDeadline(time.Now().Add(5*time.Second)))
+	return c, bufio.NewReader(c)
+}
+
+func readResponse(t *testing.T, br *bufio.Reader, method string) (*http.Response, string) {
+	resp, err := http.ReadResponse(br, &http.Request{Method: method})
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func expectClosed(t *testing.T, br *bufio.Reader) {
+	_, err := br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestServer(t *testing.T) {
+	const addr = "127.0.0.1:9242"
+	stop := runServer(t, addr, Config{MaxHeaderSize: 1024, MaxBodySize: 64})
+	defer stop()
+
+	t.Run("pipelining", func(t *testing.T) {
+		c, br := dial(t, addr)
+		defer c.Close()
+		_, err := c.Write([]byte("\r\nGET /a?x=1 HTTP/1.1\r\nHost: test\r\n\r\n" +
+			"POST /b HTTP/1.1\r\nHost: test\r\nContent-Length: 5\r\n\r\nhello" +
+			"HEAD /c HTTP/1.1\r\nHost: test\r\n\r\n" +
+			"GET /empty HTTP/1.1\r\nHost: test\r\n\r\n"))
+		require.NoError(t, err)
+
+		resp, body := readResponse(t, br, http.MethodGet)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.EqualValues(t, len("GET /a?x=1 "), resp.ContentLength)
+		assert.NotEmpty(t, resp.Header.Get("Date"))
+		assert.Equal(t, "GET /a?x=1 ", body)
+		_, body = readResponse(t, br, http.MethodPost)
+		assert.Equal(t, "POST /b hello", body)
+		resp, body = readResponse(t, br, http.MethodHead)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, body)
+		resp, body = readResponse(t, br, http.MethodGet)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Empty(t, body)
+		assert.False(t, resp.Close)
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		c, br := dial(t, addr)
+		defer c.Close()
+		req := "POST /chunked HTTP/1.1\r\nHost: test\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"5;ext=1\r\nhello\r\n1\r\n,\r\n6\r\n world\r\n0\r\nX-Checksum: 42\r\n\r\n"
+		for i := 0; i < len(req); i++ {
+			_, err := c.Write([]byte{req[i]})
+			require.NoError(t, err)
+			if i%8 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		resp, body := readResponse(t, br, http.MethodPost)
+		assert.Equal(t, "POST /chunked hello, world", body)
+		assert.Equal(t, "42", resp.Header.Get("X-Trailer"))
+	})
+
+	t.Run("chunked response", func(t *testing.T) {
+		c, br := dial(t, addr)
+		defer c.Close()
+		_, err := c.Write([]byte("GET /stream HTTP/1.1\r\nHost: test\r\n\r\n"))
+		require.NoError(t, err)
+		resp, body := readResponse(t, br, http.MethodGet)
+		assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+		assert.Equal(t, "hello, world", body)
+
+		// HTTP/1.0 has no chunked encoding, so the body ends with the connection.
+		_, err = c.Write([]byte("GET /stream HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+		require.NoError(t, err)
+		resp, body = readResponse(t, br, http.MethodGet)
+		assert.True(t, resp.Close)
+		assert.Equal(t, "hello, world", body)
+	})
+
+	t.Run("keep-alive", func(t *testing.T) {
+		c, br := dial(t, addr)
+		defer c.Close()
+		_, err := c.Write([]byte("GET /a HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+		require.NoError(t, err)
+		resp, _ := readResponse(t, br, http.MethodGet)
+		assert.Equal(t, "keep-alive", resp.Header.Get("Connection"))
+
+		_, err = c.Write([]byte("GET /b HTTP/1.0\r\n\r\n"))
+		require.NoError(t, err)
+		resp, _ = readResponse(t, br, http.MethodGet)
+		assert.True(t, resp.Close)
+		expectClosed(t, br)
+	})
+
+	t.Run("expect continue", func(t *testing.T) {
+		c, br := dial(t, addr)
+		defer c.Close()
+		_, err := c.Write([]byte("PUT /d HTTP/1.1\r\nHost: test\r\nExpect: 100-continue\r\nContent-Length: 2\r\n\r\n"))
+		require.NoError(t, err)
+		resp, _ := readResponse(t, br, http.MethodPut)
+		assert.Equal(t, http.StatusContinue, resp.StatusCode)
+		_, err = c.Write([]byte("ok"))
+		require.NoError(t, err)
+		_, body := readResponse(t, br, http.MethodPut)
+		assert.Equal(t, "PUT /d ok", body)
+	})
+
+	for _, tc := range []struct {
+		name   string
+		req    string
+		status int
+	}{
+		{"header too large", "GET / HTTP/1.1\r\nHost: test\r\nX-Big: " + strings.Repeat("a", 1024) + "\r\n\r\n",
+			http.StatusRequestHeaderFieldsTooLarge},
+		{"body too large", "POST / HTTP/1.1\r\nHost: test\r\nContent-Length: 65\r\n\r\n", http.StatusRequestEntityTooLarge},
+		{"chunked body too large", "POST / HTTP/1.1\r\nHost: test\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"40\r\n" + strings.Repeat("a", 64) + "\r\n1\r\n", http.StatusRequestEntityTooLarge},
+		{"missing host", "GET / HTTP/1.1\r\n\r\n", http.StatusBadRequest},
+		{"smuggling", "POST / HTTP/1.1\r\nHost: test\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n",
+			http.StatusBadRequest},
+		{"bad chunk", "POST / HTTP/1.1\r\nHost: test\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n", http.StatusBadRequest},
+		{"line folding", "GET / HTTP/1.1\r\nHost: test\r\nX-A: a\r\n b\r\n\r\n", http.StatusBadRequest},
+		{"transfer encoding", "POST / HTTP/1.1\r\nHost: test\r\nTransfer-Encoding: gzip\r\n\r\n", http.StatusNotImplemented},
+		{"version", "GET / HTTP/2.0\r\n\r\n", http.StatusHTTPVersionNotSupported},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, br := dial(t, addr)
+			defer c.Close()
+			_, err := c.Write([]byte(tc.req))
+			require.NoError(t, err)
+			resp, _ := readResponse(t, br, http.MethodGet)
+			assert.Equal(t, tc.status, resp.StatusCode)
+			assert.True(t, resp.Close)
+			expectClosed(t, br)
+		})
+	}
+}
@@ -0,0 +1,428 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http1
+
+import (
+	"bytes"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// maxRetainedBodySize is the maximum capacity of the buffer for chunked bodies
+// that is kept for the next request.
+const maxRetainedBodySize = 64 << 10
+
+// maxChunkLineSize is the maximum size of the line of a chunk size with its extensions.
+const maxChunkLineSize = 4 << 10
+
+var (
+	crlf     = []byte("\r\n")
+	crlfcrlf = []byte("\r\n\r\n")
+)
+
+// Request is an HTTP request parsed by Parser.
+type Request struct {
+	Method     string
+	RequestURI string   // request-target of the request line
+	URL        *url.URL // parsed from RequestURI
+	Proto      string   // "HTTP/1.0" or "HTTP/1.1"
+	ProtoMinor int
+	Header     http.Header
+	Host       string
+
+	// ContentLength is the size of the body, it's -1 if the body is chunked.
+	ContentLength int64
+
+	// Body is the complete body, which is only valid until the request has been handled.
+	Body []byte
+
+	// Trailer is the trailer of a chunked body.
+	Trailer http.Header
+
+	// Close reports whether the connection is closed after the response to the request.
+	Close bool
+
+	expectContinue bool
+}
+
+type parseState uint8
+
+const (
+	stateHeader parseState = iota
+	stateBody
+	stateChunkSize
+	stateChunkData
+	stateChunkEnd
+	stateTrailer
+)
+
+// Parser parses the requests on a connection incrementally, the bytes that have been parsed
+// are consumed from the inbound buffer, so that a partial request is never parsed twice.
+type Parser struct {
+	config    Config
+	state     parseState
+	req       Request
+	scanned   int    // bytes of the header that have been searched for its end
+	remaining int64  // bytes left of the current chunk
+	trailer   int    // size of the trailer so far
+	body      []byte // chunked body reassembled so far
+	consumed  int    // size of the body of the last request that is still in the inbound buffer
+}
+
+// NewParser creates a Parser for a connection.
+func NewParser(config Config) *Parser {
+	config.setDefaults()
+	return &Parser{config: config}
+}
+
+// Parse parses the next request from r, it returns nil if the request is incomplete, in which case
+// it should be called again when more bytes arrive. The request is valid until the next call.
+//
+// The connection must be closed after an error, which can be answered with WriteError.
+func (p *Parser) Parse(r gnet.Reader) (*Request, error) {
+	if p.consumed > 0 {
+		_, _ = r.Discard(p.consumed)
+		p.consumed = 0
+	}
+	for {
+		switch p.state {
+		case stateHeader:
+			done, err := p.readHeader(r)
+			if err != nil || !done {
+				return nil, err
+			}
+			switch {
+			case p.req.ContentLength < 0:
+				p.state = stateChunkSize
+			case p.req.ContentLength > 0:
+				p.state = stateBody
+			default:
+				return p.complete(), nil
+			}
+		case stateBody:
+			body, err := r.Peek(int(p.req.ContentLength))
+			if err != nil {
+				return nil, nil
+			}
+			p.req.Body = body
+			p.consumed = len(body)
+			return p.complete(), nil
+		case stateChunkSize:
+			line, size, err := readLine(r, maxChunkLineSize)
+			if err != nil {
+				return nil, badRequest("chunk size line too long")
+			}
+			if size == 0 {
+				return nil, nil
+			}
+			n, err := parseChunkSize(line)
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(p.body))+n > p.config.MaxBodySize {
+				return nil, ErrBodyTooLarge
+			}
+			_, _ = r.Discard(size)
+			if n == 0 {
+				p.state = stateTrailer
+			} else {
+				p.remaining, p.state = n, stateChunkData
+			}
+		case stateChunkData:
+			// The data of the chunk is consumed as it arrives rather than when it is complete,
+			// so that the inbound buffer doesn't have to hold a large chunk twice.
+			n := r.InboundBuffered()
+			if n == 0 {
+				return nil, nil
+			}
+			if int64(n) > p.remaining {
+				n = int(p.remaining)
+			}
+			data, _ := r.Next(n)
+			p.body = append(p.body, data...)
+			if p.remaining -= int64(n); p.remaining == 0 {
+				p.state = stateChunkEnd
+			}
+		case stateChunkEnd:
+			buf, err := r.Peek(2)
+			if err != nil {
+				return nil, nil
+			}
+			if !bytes.Equal(buf, crlf) {
+				return nil, badRequest("missing CRLF after chunk data")
+			}
+			_, _ = r.Discard(2)
+			p.state = stateChunkSize
+		case stateTrailer:
+			line, size, err := readLine(r, p.config.MaxHeaderSize-p.trailer)
+			if err != nil {
+				return nil, ErrHeaderTooLarge
+			}
+			if size == 0 {
+				return nil, nil
+			}
+			p.trailer += size
+			if len(line) == 0 {
+				_, _ = r.Discard(size)
+				p.req.Body = p.body
+				return p.complete(), nil
+			}
+			if p.req.Trailer == nil {
+				p.req.Trailer = make(http.Header)
+			}
+			if err = addField(p.req.Trailer, line); err != nil {
+				return nil, err
+			}
+			_, _ = r.Discard(size)
+		}
+	}
+}
+
+// ExpectContinue reports whether the client of the request whose body is being received waits for
+// a "100 Continue" response before sending the body, it returns true only once for each request.
+func (p *Parser) ExpectContinue() bool {
+	if p.state == stateHeader || !p.req.expectContinue {
+		return false
+	}
+	p.req.expectContinue = false
+	return true
+}
+
+// complete returns the request that has been parsed and gets ready for the next one.
+func (p *Parser) complete() *Request {
+	p.state = stateHeader
+	p.req.expectContinue = false
+	return &p.req
+}
+
+// readHeader reads the request line and the header, it returns false if they are incomplete.
+func (p *Parser) readHeader(r gnet.Reader) (bool, error) {
+	buf, _ := r.Peek(-1)
+	// Empty lines before the request line are ignored, see RFC 9112, section 2.2.
+	for p.scanned == 0 && bytes.HasPrefix(buf, crlf) {
+		_, _ = r.Discard(2)
+		buf, _ = r.Peek(-1)
+	}
+	if len(buf) > p.config.MaxHeaderSize {
+		buf = buf[:p.config.MaxHeaderSize]
+	}
+	start := p.scanned - len(crlfcrlf) + 1
+	if start < 0 {
+		start = 0
+	}
+	i := bytes.Index(buf[start:], crlfcrlf)
+	if i < 0 {
+		if len(buf) >= p.config.MaxHeaderSize {
+			return false, ErrHeaderTooLarge
+		}
+		p.scanned = len(buf)
+		return false, nil
+	}
+	size := start + i + len(crlfcrlf)
+	p.scanned = 0
+
+	if cap(p.body) > maxRetainedBodySize {
+		p.body = nil
+	}
+	p.req = Request{}
+	p.body, p.trailer = p.body[:0], 0
+	if err := p.parseHeader(buf[:size-len(crlfcrlf)]); err != nil {
+		return false, err
+	}
+	_, _ = r.Discard(size)
+	return true, nil
+}
+
+// parseHeader parses the request line and the header fields in hdr, which has no trailing empty line.
+func (p *Parser) parseHeader(hdr []byte) error {
+	line, rest, _ := bytes.Cut(hdr, crlf)
+	method, target, ok1 := strings.Cut(string(line), " ")
+	target, proto, ok2 := strings.Cut(target, " ")
+	if !ok1 || !ok2 || !isToken(method) || target == "" {
+		return badRequest("invalid request line")
+	}
+	req := &p.req
+	req.Method, req.RequestURI, req.Proto = method, target, proto
+	switch proto {
+	case "HTTP/1.1":
+		req.ProtoMinor = 1
+	case "HTTP/1.0":
+	default:
+		if !strings.HasPrefix(proto, "HTTP/") {
+			return badRequest("invalid protocol version")
+		}
+		return ErrUnsupportedVersion
+	}
+	var err error
+	if target == "*" {
+		req.URL = &url.URL{Path: "*"}
+	} else if req.URL, err = url.ParseRequestURI(target); err != nil {
+		return badRequest("invalid request target")
+	}
+
+	req.Header = make(http.Header)
+	for len(rest) > 0 {
+		line, rest, _ = bytes.Cut(rest, crlf)
+		if err = addField(req.Header, line); err != nil {
+			return err
+		}
+	}
+	return p.checkHeader()
+}
+
+// checkHeader checks the fields of the header that affect how the request is parsed and answered.
+func (p *Parser) checkHeader() error {
+	req := &p.req
+	hosts := req.Header["Host"]
+	if len(hosts) > 1 || (len(hosts) == 0 && req.ProtoMinor == 1) {
+		return badRequest("missing or duplicate Host")
+	}
+	if len(hosts) == 1 {
+		req.Host = hosts[0]
+	}
+	if req.ProtoMinor == 0 {
+		req.Close = !headerContains(req.Header, "Connection", "keep-alive")
+	} else {
+		req.Close = headerContains(req.Header, "Connection", "close")
+	}
+
+	te, cl := req.Header["Transfer-Encoding"], req.Header["Content-Length"]
+	switch {
+	case len(te) > 0:
+		// A request with both headers may be parsed differently by the proxies in front of
+		// the server, which is the essence of request smuggling.
+		if len(cl) > 0 {
+			return badRequest("both Transfer-Encoding and Content-Length")
+		}
+		if len(te) > 1 || !strings.EqualFold(te[0], "chunked") {
+			return ErrUnsupportedTransferEncoding
+		}
+		req.ContentLength = -1
+	case len(cl) > 0:
+		for _, v := range cl[1:] {
+			if v != cl[0] {
+				return badRequest("conflicting Content-Length")
+			}
+		}
+		n, err := strconv.ParseUint(cl[0], 10, 63)
+		if err != nil {
+			return badRequest("invalid Content-Length")
+		}
+		if int64(n) > p.config.MaxBodySize {
+			return ErrBodyTooLarge
+		}
+		req.ContentLength = int64(n)
+	}
+
+	req.expectContinue = req.ContentLength != 0 && req.ProtoMinor == 1 &&
+		strings.EqualFold(req.Header.Get("Expect"), "100-continue")
+	return nil
+}
+
+// addField parses a header field in line and adds it to h.
+func addField(h http.Header, line []byte) error {
+	name, value, ok := bytes.Cut(line, []byte(":"))
+	// Obsolete line folding starts with whitespace, which is also rejected by isToken.
+	if !ok || !isToken(string(name)) {
+		return badRequest("invalid header field")
+	}
+	value = bytes.Trim(value, " \t")
+	if bytes.ContainsAny(value, "\r\n\x00") {
+		return badRequest("invalid header field value")
+	}
+	key := textproto.CanonicalMIMEHeaderKey(string(name))
+	h[key] = append(h[key], string(value))
+	return nil
+}
+
+// readLine peeks a line ending with CRLF that is no longer than limit, it returns the line without
+// CRLF and the size of the line in the buffer, which is 0 if the line is incomplete.
+func readLine(r gnet.Reader, limit int) (line []byte, size int, err error) {
+	if limit <= 0 {
+		return nil, 0, ErrHeaderTooLarge
+	}
+	buf, _ := r.Peek(-1)
+	if len(buf) > limit {
+		buf = buf[:limit]
+	}
+	i := bytes.Index(buf, crlf)
+	if i < 0 {
+		if len(buf) >= limit {
+			return nil, 0, ErrHeaderTooLarge
+		}
+		return nil, 0, nil
+	}
+	return buf[:i], i + len(crlf), nil
+}
+
+// parseChunkSize parses the size in the line of a chunk size, the chunk extensions are ignored.
+func parseChunkSize(line []byte) (int64, error) {
+	if i := bytes.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	line = bytes.TrimRight(line, " \t")
+	if len(line) == 0 || len(line) > 15 {
+		return 0, badRequest("invalid chunk size")
+	}
+	var n int64
+	for _, b := range line {
+		switch {
+		case b >= '0' && b <= '9':
+			b -= '0'
+		case b >= 'a' && b <= 'f':
+			b -= 'a' - 10
+		case b >= 'A' && b <= 'F':
+			b -= 'A' - 10
+		default:
+			return 0, badRequest("invalid chunk size")
+		}
+		n = n<<4 | int64(b)
+	}
+	return n, nil
+}
+
+// isToken reports whether s is a token of RFC 9110, section 5.6.2.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// headerContains reports whether the comma-separated header of name contains token.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[name] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
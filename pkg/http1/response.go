@@ -0,0 +1,241 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http1
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+var lastChunk = []byte("0\r\n\r\n")
+
+// date is the value of the Date header, which is formatted once per second.
+type date struct {
+	sec   int64
+	value string
+}
+
+var dateCache atomic.Pointer[date]
+
+func now() string {
+	t := time.Now()
+	if d := dateCache.Load(); d != nil && d.sec == t.Unix() {
+		return d.value
+	}
+	d := &date{t.Unix(), t.UTC().Format(http.TimeFormat)}
+	dateCache.Store(d)
+	return d.value
+}
+
+// ResponseWriter writes the response to a request. The body is buffered and sent with a Content-Length
+// header when the response finishes, unless the header is sent earlier by Flush, in which case the body
+// is sent in chunks, or until the connection is closed if the request is of HTTP/1.0.
+//
+// Note that it's not concurrency-safe, it must be used on the event-loop of the connection.
+type ResponseWriter struct {
+	w             gnet.Writer
+	req           *Request
+	header        http.Header
+	status        int
+	hdr           []byte // header that is sent with the next part of the body
+	wroteHeader   bool   // whether the header has been written
+	chunked       bool   // whether the body is sent in chunks
+	close         bool   // whether the connection is closed after the response
+	finished      bool   // whether the response has finished
+	body          []byte // part of the body that hasn't been sent
+	contentLength int64  // value of the Content-Length header, -1 if there is none
+	written       int64  // size of the body that has been sent
+	err           error
+}
+
+// NewResponseWriter creates a ResponseWriter for req on the connection w.
+func NewResponseWriter(w gnet.Writer, req *Request) *ResponseWriter {
+	return &ResponseWriter{w: w, req: req, close: req.Close, contentLength: -1}
+}
+
+// Header returns the header of the response, which can't be changed after the header is sent.
+func (w *ResponseWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+// WriteHeader sets the status code of the response, which is 200 OK by default.
+// It only takes effect before the header is sent.
+func (w *ResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader && status >= 200 && status <= 999 {
+		w.status = status
+	}
+}
+
+// Write appends data to the body of the response.
+func (w *ResponseWriter) Write(data []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if !bodyAllowed(w.status) {
+		return 0, ErrBodyNotAllowed
+	}
+	if w.req.Method != http.MethodHead {
+		w.body = append(w.body, data...)
+	}
+	return len(data), nil
+}
+
+// Flush sends the header if it hasn't been sent, and then the body that has been written so far.
+func (w *ResponseWriter) Flush() error {
+	if w.err == nil && !w.finished {
+		if !w.wroteHeader {
+			w.writeHeader(false)
+		}
+		w.writeBody(false)
+	}
+	return w.err
+}
+
+// Finish sends the rest of the response, it returns gnet.Close if the connection must be closed
+// after the response, e.g. because the request or the response carries "Connection: close".
+func (w *ResponseWriter) Finish() gnet.Action {
+	if w.err == nil && !w.finished {
+		if !w.wroteHeader {
+			w.writeHeader(true)
+		}
+		w.writeBody(true)
+		w.finished = true
+		// The peer can't tell where the response ends if the body is shorter than Content-Length.
+		if w.contentLength >= 0 && w.written != w.contentLength && w.hasBody() {
+			w.close = true
+		}
+	}
+	if w.err != nil || w.close {
+		return gnet.Close
+	}
+	return gnet.None
+}
+
+func (w *ResponseWriter) hasBody() bool {
+	return w.req.Method != http.MethodHead && bodyAllowed(w.status)
+}
+
+// bodyAllowed reports whether a response of status can have a body, see RFC 9110, section 6.4.1.
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// writeHeader encodes the header, final reports whether the whole body has been written.
+func (w *ResponseWriter) writeHeader(final bool) {
+	w.wroteHeader = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	h := w.Header()
+
+	switch {
+	case !bodyAllowed(w.status):
+		h.Del("Transfer-Encoding")
+		h.Del("Content-Length")
+	case h.Get("Transfer-Encoding") == "chunked" && w.req.ProtoMinor == 1:
+		h.Del("Content-Length")
+		w.chunked = true
+	case h.Get("Content-Length") != "":
+		h.Del("Transfer-Encoding")
+		n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+		if err == nil && n >= 0 {
+			w.contentLength = n
+			break
+		}
+		h.Del("Content-Length")
+		fallthrough
+	default:
+		h.Del("Transfer-Encoding")
+		switch {
+		case final && w.hasBody():
+			w.contentLength = int64(len(w.body))
+			h.Set("Content-Length", strconv.Itoa(len(w.body)))
+		case final:
+			// The body of a HEAD response is discarded, so its size is unknown.
+		case w.req.ProtoMinor == 1:
+			h.Set("Transfer-Encoding", "chunked")
+			w.chunked = true
+		default:
+			// HTTP/1.0 has no chunked encoding, the end of the body is the end of the connection.
+			w.close = true
+		}
+	}
+
+	if headerContains(h, "Connection", "close") {
+		w.close = true
+	}
+	switch {
+	case w.close:
+		h.Set("Connection", "close")
+	case w.req.ProtoMinor == 0:
+		h.Set("Connection", "keep-alive")
+	}
+	if _, ok := h["Date"]; !ok {
+		h.Set("Date", now())
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("HTTP/1.1 ")
+	buf.WriteString(strconv.Itoa(w.status))
+	buf.WriteByte(' ')
+	if text := http.StatusText(w.status); text != "" {
+		buf.WriteString(text)
+	} else {
+		buf.WriteString("status code " + strconv.Itoa(w.status))
+	}
+	buf.Write(crlf)
+	_ = h.Write(&buf)
+	buf.Write(crlf)
+	w.hdr = buf.Bytes()
+}
+
+// writeBody sends the header that hasn't been sent and the buffered body, final reports
+// whether it's the last part of the body.
+func (w *ResponseWriter) writeBody(final bool) {
+	bs := make([][]byte, 0, 4)
+	if w.hdr != nil {
+		bs = append(bs, w.hdr)
+		w.hdr = nil
+	}
+	body := w.body
+	if w.contentLength >= 0 && int64(len(body)) > w.contentLength-w.written {
+		// The excess of the body over Content-Length would be taken as the next response.
+		body = body[:w.contentLength-w.written]
+		w.close = true
+	}
+	if len(body) > 0 && w.hasBody() {
+		if w.chunked {
+			bs = append(bs, []byte(strconv.FormatInt(int64(len(body)), 16)+"\r\n"), body, crlf)
+		} else {
+			bs = append(bs, body)
+		}
+		w.written += int64(len(body))
+	}
+	if final && w.chunked {
+		bs = append(bs, lastChunk)
+	}
+	if len(bs) > 0 {
+		_, w.err = w.w.Writev(bs)
+	}
+	w.body = w.body[:0]
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mtproto implements the codecs of the MTProto transports, i.e. abridged, intermediate,
+// padded intermediate and full, see https://core.telegram.org/mtproto/mtproto-transports.
+//
+// Codec detects the transport from the first bytes that the client sends, so that a server serves
+// all transports on the same port. It keeps the state of a connection, thus it's created for each
+// connection and set as the context of the connection, where it's picked up by codec.Handler to decode
+// the messages and by gnet.Engine.AsyncWrite to encode the messages pushed to the connection with
+// gnet.WithMessageEncoding:
+//
+//	func (s *server) OnOpen(c gnet.Conn) ([]byte, gnet.Action) {
+//		c.SetContext(mtproto.NewCodec(0))
+//		return nil, gnet.None
+//	}
+//
+//	gnet.Run(codec.NewHandler(s, nil), "tcp://:10443", gnet.WithMessageEncoding(true))
+//
+// The obfuscated2 transport is served by setting up Obfuscated2 as the gnet.StreamTransform of the connections,
+// Codec then takes the transport chosen in the header of a connection instead of detecting it.
+package mtproto
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/panjf2000/gnet/v2"
+	"github.com/panjf2000/gnet/v2/pkg/codec"
+)
+
+// Transport is an MTProto transport.
+type Transport int
+
+// MTProto transports.
+const (
+	// TransportUnknown is the transport of the connections that haven't sent enough bytes to detect it.
+	TransportUnknown Transport = iota
+	TransportAbridged
+	TransportIntermediate
+	TransportPaddedIntermediate
+	TransportFull
+)
+
+func (t Transport) String() string {
+	switch t {
+	case TransportAbridged:
+		return "abridged"
+	case TransportIntermediate:
+		return "intermediate"
+	case TransportPaddedIntermediate:
+		return "padded intermediate"
+	case TransportFull:
+		return "full"
+	}
+	return "unknown"
+}
+
+// Tags that the clients send at the start of the connections to choose the transports,
+// the full transport has none.
+const (
+	tagAbridged           = 0xef
+	tagIntermediate       = 0xeeeeeeee
+	tagPaddedIntermediate = 0xdddddddd
+)
+
+const (
+	defaultMaxFrameSize = 16 << 20
+	quickAckFlag        = 0x80000000
+	fullOverhead        = 12 // length, sequence number and CRC32 of the full transport
+)
+
+var (
+	// ErrUnknownTransport occurs when a connection starts with the bytes of none of the transports.
+	ErrUnknownTransport = errors.New("mtproto: unknown transport")
+	// ErrQuickAckUnsupported occurs when writing a quick ack on a transport that doesn't support it.
+	ErrQuickAckUnsupported = errors.New("mtproto: quick ack is not supported by the transport")
+)
+
+// Codec is the codec of the MTProto transport of a connection, it implements codec.Codec and
+// gnet.MessageEncoder. The errors of decoding are the ones of package codec, i.e. codec.ErrIncompleteFrame,
+// codec.ErrFrameTooLarge and codec.ErrInvalidFrame, as well as ErrUnknownTransport.
+//
+// Note that it's not concurrency-safe, it must be used on the event-loop of the connection.
+type Codec struct {
+	maxFrameSize int
+	transport    Transport
+	quickAck     bool   // whether the last message requests a quick ack
+	recvSeq      uint32 // next sequence number of the full transport from the client
+	sendSeq      uint32 // next sequence number of the full transport to the client
+}
+
+// NewCodec creates a Codec for a connection, maxFrameSize is the maximum size of
+// the frames, which is 16MB if it's not positive.
+func NewCodec(maxFrameSize int) *Codec {
+	if maxFrameSize <= 0 {
+		maxFrameSize = defaultMaxFrameSize
+	}
+	return &Codec{maxFrameSize: maxFrameSize}
+}
+
+// Transport returns the transport of the connection.
+func (cd *Codec) Transport() Transport { return cd.transport }
+
+// QuickAck reports whether the client requests a quick ack of the message that was decoded last,
+// which should be answered with WriteQuickAck.
+func (cd *Codec) QuickAck() bool { return cd.quickAck }
+
+// Decode consumes a frame from r and returns the message in it, the transport is detected
+// from the first bytes of the connection.
+func (cd *Codec) Decode(r gnet.Reader) (msg []byte, err error) {
+	if cd.transport == TransportUnknown {
+		if err = cd.detect(r); err != nil {
+			return
+		}
+	}
+	cd.quickAck = false
+	switch cd.transport {
+	case TransportAbridged:
+		return cd.decodeAbridged(r)
+	case TransportIntermediate, TransportPaddedIntermediate:
+		return cd.decodeIntermediate(r)
+	default:
+		return cd.decodeFull(r)
+	}
+}
+
+// detect detects the transport from the first bytes of the connection and consumes its tag,
+// or takes the transport from the header of the obfuscated2 connection.
+func (cd *Codec) detect(r gnet.Reader) error {
+	if c, ok := r.(gnet.Conn); ok {
+		if o, ok := c.StreamTransform().(*Obfuscated2); ok {
+			cd.transport = o.Transport()
+			return nil
+		}
+	}
+	buf, err := r.Peek(1)
+	if err != nil {
+		return codec.ErrIncompleteFrame
+	}
+	if buf[0] == tagAbridged {
+		_, _ = r.Discard(1)
+		cd.transport = TransportAbridged
+		return nil
+	}
+	if buf, err = r.Peek(8); err != nil {
+		return codec.ErrIncompleteFrame
+	}
+	switch binary.LittleEndian.Uint32(buf) {
+	case tagIntermediate:
+		_, _ = r.Discard(4)
+		cd.transport = TransportIntermediate
+		return nil
+	case tagPaddedIntermediate:
+		_, _ = r.Discard(4)
+		cd.transport = TransportPaddedIntermediate
+		return nil
+	}
+	// The first frame of the full transport starts with its length and the sequence number 0.
+	if binary.LittleEndian.Uint32(buf[4:]) == 0 {
+		cd.transport = TransportFull
+		return nil
+	}
+	return ErrUnknownTransport
+}
+
+// decodeAbridged decodes a frame of the abridged transport, whose length is the number of 4-byte words
+// in a byte, or in 3 bytes following 0x7f, the highest bit of the first byte requests a quick ack.
+func (cd *Codec) decodeAbridged(r gnet.Reader) ([]byte, error) {
+	buf, err := r.Peek(1)
+	if err != nil {
+		return nil, codec.ErrIncompleteFrame
+	}
+	quickAck := buf[0]&0x80 != 0
+	hdrLen, length := 1, int(buf[0]&0x7f)
+	if length == 0x7f {
+		if buf, err = r.Peek(4); err != nil {
+			return nil, codec.ErrIncompleteFrame
+		}
+		hdrLen, length = 4, int(buf[1])|int(buf[2])<<8|int(buf[3])<<16
+	}
+	return cd.next(r, hdrLen, length*4, quickAck)
+}
+
+// decodeIntermediate decodes a frame of the intermediate transport, whose length is in 4 bytes,
+// the highest bit of which requests a quick ack. The random padding of the padded intermediate
+// transport is kept in the message.
+func (cd *Codec) decodeIntermediate(r gnet.Reader) ([]byte, error) {
+	buf, err := r.Peek(4)
+	if err != nil {
+		return nil, codec.ErrIncompleteFrame
+	}
+	length := binary.LittleEndian.Uint32(buf)
+	return cd.next(r, 4, int(length&^quickAckFlag), length&quickAckFlag != 0)
+}
+
+// next consumes the frame of a message of length following a header of hdrLen.
+func (cd *Codec) next(r gnet.Reader, hdrLen, length int, quickAck bool) ([]byte, error) {
+	if hdrLen+length > cd.maxFrameSize {
+		return nil, codec.ErrFrameTooLarge
+	}
+	frame, err := r.Next(hdrLen + length)
+	if err != nil {
+		return nil, codec.ErrIncompleteFrame
+	}
+	cd.quickAck = quickAck
+	return frame[hdrLen:], nil
+}
+
+// decodeFull decodes a frame of the full transport, which is made up of its length, the sequence number,
+// the message and the CRC32 of all of them, and checks the sequence number and the CRC32.
+func (cd *Codec) decodeFull(r gnet.Reader) ([]byte, error) {
+	buf, err := r.Peek(4)
+	if err != nil {
+		return nil, codec.ErrIncompleteFrame
+	}
+	length := binary.LittleEndian.Uint32(buf)
+	if length < fullOverhead || length%4 != 0 {
+		return nil, fmt.Errorf("%w: invalid length %d", codec.ErrInvalidFrame, length)
+	}
+	if length > uint32(cd.maxFrameSize) {
+		return nil, codec.ErrFrameTooLarge
+	}
+	frame, err := r.Next(int(length))
+	if err != nil {
+		return nil, codec.ErrIncompleteFrame
+	}
+	if seq := binary.LittleEndian.Uint32(frame[4:]); seq != cd.recvSeq {
+		return nil, fmt.Errorf("%w: sequence number %d, expected %d", codec.ErrInvalidFrame, seq, cd.recvSeq)
+	}
+	if crc32.ChecksumIEEE(frame[:length-4]) != binary.LittleEndian.Uint32(frame[length-4:]) {
+		return nil, fmt.Errorf("%w: mismatched CRC32", codec.ErrInvalidFrame)
+	}
+	cd.recvSeq++
+	return frame[8 : length-4], nil
+}
+
+// Encode writes the frame of msg to w in the transport of the connection, whose length must be
+// a multiple of 4, i.e. an MTProto message.
+func (cd *Codec) Encode(w io.Writer, msg []byte) error {
+	if len(msg)%4 != 0 {
+		return fmt.Errorf("%w: message length %d is not a multiple of 4", codec.ErrInvalidFrame, len(msg))
+	}
+	switch cd.transport {
+	case TransportAbridged:
+		words := len(msg) / 4
+		if words < 0x7f {
+			return codec.WriteFrame(w, []byte{byte(words)}, msg)
+		}
+		if words >= 1<<24 {
+			return codec.ErrFrameTooLarge
+		}
+		return codec.WriteFrame(w, []byte{0x7f, byte(words), byte(words >> 8), byte(words >> 16)}, msg)
+	case TransportIntermediate:
+		return codec.WriteFrame(w, binary.LittleEndian.AppendUint32(nil, uint32(len(msg))), msg)
+	case TransportPaddedIntermediate:
+		var padding [16]byte
+		_, _ = rand.Read(padding[:])
+		pad := padding[:padding[0]&0x0f]
+		return codec.WriteFrame(w, binary.LittleEndian.AppendUint32(nil, uint32(len(msg)+len(pad))), msg, pad)
+	case TransportFull:
+		hdr := make([]byte, 8)
+		binary.LittleEndian.PutUint32(hdr, uint32(len(msg)+fullOverhead))
+		binary.LittleEndian.PutUint32(hdr[4:], cd.sendSeq)
+		crc := crc32.Update(crc32.ChecksumIEEE(hdr), crc32.IEEETable, msg)
+		cd.sendSeq++
+		return codec.WriteFrame(w, hdr, msg, binary.LittleEndian.AppendUint32(nil, crc))
+	}
+	return ErrUnknownTransport
+}
+
+// WriteQuickAck writes the quick ack of token to w, which is the first 32 bits of the SHA256
+// of the auth key and the message, as computed to verify the msg_key of the message.
+// The full transport doesn't support quick acks.
+func (cd *Codec) WriteQuickAck(w io.Writer, token uint32) error {
+	var ack [4]byte
+	switch cd.transport {
+	case TransportAbridged:
+		binary.BigEndian.PutUint32(ack[:], token|quickAckFlag)
+	case TransportIntermediate, TransportPaddedIntermediate:
+		binary.LittleEndian.PutUint32(ack[:], token|quickAckFlag)
+	default:
+		return ErrQuickAckUnsupported
+	}
+	_, err := w.Write(ack[:])
+	return err
+}
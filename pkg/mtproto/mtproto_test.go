@@ -0,0 +1,403 @@
+package mtproto
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/panjf2000/gnet/v2"
+	"github.com/panjf2000/gnet/v2/pkg/codec"
+)
+
+// testReader is a gnet.Reader over a byte slice.
+type testReader struct {
+	gnet.Reader
+	buf []byte
+}
+
+func (r *testReader) Next(n int) ([]byte, error) {
+	buf, err := r.Peek(n)
+	if err == nil {
+		r.buf = r.buf[len(buf):]
+	}
+	return buf, err
+}
+
+func (r *testReader) Peek(n int) ([]byte, error) {
+	if n > len(r.buf) {
+		return nil, io.ErrShortBuffer
+	} else if n <= 0 {
+		n = len(r.buf)
+	}
+	return r.buf[:n], nil
+}
+
+func (r *testReader) Discard(n int) (int, error) {
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *testReader) InboundBuffered() int {
+	return len(r.buf)
+}
+
+type decoded struct {
+	msg      string
+	quickAck bool
+}
+
+// decodeAll decodes the frames in data that is fed to cd byte by byte.
+func decodeAll(cd *Codec, data []byte) (msgs []decoded, err error) {
+	r := &testReader{}
+	for _, b := range data {
+		r.buf = append(r.buf, b)
+		for {
+			msg, err := cd.Decode(r)
+			if errors.Is(err, codec.ErrIncompleteFrame) {
+				break
+			}
+			if err != nil {
+				return msgs, err
+			}
+			msgs = append(msgs, decoded{string(msg), cd.QuickAck()})
+		}
+	}
+	return
+}
+
+// fullFrame encodes a frame of the full transport.
+func fullFrame(seq uint32, msg string) []byte {
+	frame := binary.LittleEndian.AppendUint32(nil, uint32(len(msg)+fullOverhead))
+	frame = binary.LittleEndian.AppendUint32(frame, seq)
+	frame = append(frame, msg...)
+	return binary.LittleEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame))
+}
+
+func TestDecode(t *testing.T) {
+	long := string(bytes.Repeat([]byte("abcd"), 0x80))
+	for _, tc := range []struct {
+		transport Transport
+		data      []byte
+		msgs      []decoded
+	}{
+		{TransportAbridged, []byte("\xef\x01ping\x81pong\x7f\x80\x00\x00" + long),
+			[]decoded{{"ping", false}, {"pong", true}, {long, false}}},
+		{TransportIntermediate, []byte("\xee\xee\xee\xee\x04\x00\x00\x00ping\x04\x00\x00\x80pong"),
+			[]decoded{{"ping", false}, {"pong", true}}},
+		{TransportPaddedIntermediate, []byte("\xdd\xdd\xdd\xdd\x06\x00\x00\x00ping\x01\x02"),
+			[]decoded{{"ping\x01\x02", false}}},
+		{TransportFull, append(fullFrame(0, "ping"), fullFrame(1, "pong")...),
+			[]decoded{{"ping", false}, {"pong", false}}},
+	} {
+		t.Run(tc.transport.String(), func(t *testing.T) {
+			cd := NewCodec(0)
+			msgs, err := decodeAll(cd, tc.data)
+			require.NoError(t, err)
+			assert.Equal(t, tc.transport, cd.Transport())
+			assert.Equal(t, tc.msgs, msgs)
+		})
+	}
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"unknown transport", []byte("GET / HTTP/1.1\r\n"), ErrUnknownTransport},
+		{"sequence number", append(fullFrame(0, "ping"), fullFrame(2, "pong")...), codec.ErrInvalidFrame},
+		{"crc32", append(fullFrame(0, "ping")[:16], 0, 0, 0, 0), codec.ErrInvalidFrame},
+		{"full too large", fullFrame(0, string(make([]byte, 64))), codec.ErrFrameTooLarge},
+		{"abridged too large", []byte("\xef\x7f\x20\x00\x00"), codec.ErrFrameTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decodeAll(NewCodec(64), tc.data)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	long := bytes.Repeat([]byte("abcd"), 0x80)
+	for _, tc := range []struct {
+		transport Transport
+		msg       []byte
+		frame     []byte
+		ack       []byte
+	}{
+		{TransportAbridged, []byte("ping"), []byte("\x01ping"), []byte("\x80\x00\x00\x01")},
+		{TransportAbridged, long, append([]byte("\x7f\x80\x00\x00"), long...), []byte("\x80\x00\x00\x01")},
+		{TransportIntermediate, []byte("ping"), []byte("\x04\x00\x00\x00ping"), []byte("\x01\x00\x00\x80")},
+		{TransportFull, []byte("ping"), fullFrame(0, "ping"), nil},
+	} {
+		t.Run(tc.transport.String(), func(t *testing.T) {
+			cd := &Codec{transport: tc.transport}
+			frame, err := codec.Encode(cd, tc.msg)
+			require.NoError(t, err)
+			assert.Equal(t, tc.frame, frame)
+
+			var ack bytes.Buffer
+			if err = cd.WriteQuickAck(&ack, 1); tc.ack == nil {
+				assert.ErrorIs(t, err, ErrQuickAckUnsupported)
+			} else {
+				assert.Equal(t, tc.ack, ack.Bytes())
+			}
+		})
+	}
+
+	cd := &Codec{transport: TransportPaddedIntermediate}
+	frame, err := codec.Encode(cd, []byte("ping"))
+	require.NoError(t, err)
+	assert.EqualValues(t, len(frame)-4, binary.LittleEndian.Uint32(frame))
+	assert.Equal(t, "ping", string(frame[4:8]))
+	assert.LessOrEqual(t, len(frame), 4+4+15)
+
+	cd = &Codec{transport: TransportFull}
+	frame, err = codec.Encode(cd, []byte("ping"))
+	require.NoError(t, err)
+	assert.Equal(t, fullFrame(0, "ping"), frame)
+	frame, err = codec.Encode(cd, []byte("pong"))
+	require.NoError(t, err)
+	assert.Equal(t, fullFrame(1, "pong"), frame)
+
+	_, err = codec.Encode(cd, []byte("odd"))
+	assert.ErrorIs(t, err, codec.ErrInvalidFrame)
+	_, err = codec.Encode(NewCodec(0), []byte("ping"))
+	assert.ErrorIs(t, err, ErrUnknownTransport)
+}
+
+type testServer struct {
+	gnet.BuiltinEventEngine
+	eng    gnet.Engine
+	booted chan struct{}
+	msgCh  chan int64
+}
+
+func (s *testServer) OnBoot(eng gnet.Engine) gnet.Action {
+	s.eng = eng
+	close(s.booted)
+	return gnet.None
+}
+
+func (s *testServer) OnOpen(c gnet.Conn) ([]byte, gnet.Action) {
+	c.SetContext(NewCodec(0))
+	return nil, gnet.None
+}
+
+func (s *testServer) OnMessage(c gnet.Conn, msg []byte) gnet.Action {
+	cd := c.Context().(*Codec)
+	if cd.QuickAck() {
+		_ = cd.WriteQuickAck(c, 7)
+	}
+	_ = cd.Encode(c, msg)
+	s.msgCh <- c.ConnId()
+	return gnet.None
+}
+
+func TestServer(t *testing.T) {
+	s := &testServer{booted: make(chan struct{}), msgCh: make(chan int64, 4)}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gnet.Run(codec.NewHandler(s, nil), "tcp://127.0.0.1:9244",
+			gnet.WithReuseAddr(true), gnet.WithMessageEncoding(true))
+	}()
+	select {
+	case <-s.booted:
+	case err := <-errCh:
+		require.FailNow(t, "engine exited before booting", "error: %v", err)
+	}
+	defer func() {
+		require.NoError(t, s.eng.Stop(context.Background()))
+		require.NoError(t, <-errCh)
+	}()
+
+	for _, tc := range []struct {
+		transport Transport
+		request   []byte
+		reply     []byte // echo of the request followed by the pushed message
+	}{
+		{TransportAbridged, []byte("\xef\x81ping"), []byte("\x80\x00\x00\x07\x01ping\x01push")},
+		{TransportIntermediate, []byte("\xee\xee\xee\xee\x04\x00\x00\x00ping"),
+			[]byte("\x04\x00\x00\x00ping\x04\x00\x00\x00push")},
+		{TransportFull, fullFrame(0, "ping"), append(fullFrame(0, "ping"), fullFrame(1, "push")...)},
+	} {
+		t.Run(tc.transport.String(), func(t *testing.T) {
+			c, err := net.Dial("tcp", "127.0.0.1:9244")
+			require.NoError(t, err)
+			defer c.Close()
+			require.NoError(t, c.SetDeadline(time.Now().Add(5*time.Second)))
+			_, err = c.Write(tc.request)
+			require.NoError(t, err)
+
+			var connID int64
+			select {
+			case connID = <-s.msgCh:
+			case <-time.After(time.Second):
+				require.FailNow(t, "timeout waiting for the message")
+			}
+			require.NoError(t, s.eng.AsyncWrite(connID, []byte("push"), nil))
+			reply := make([]byte, len(tc.reply))
+			_, err = io.ReadFull(c, reply)
+			require.NoError(t, err)
+			assert.Equal(t, tc.reply, reply)
+		})
+	}
+}
+
+// obfuscated2Client is the client side of an obfuscated2 connection.
+type obfuscated2Client struct {
+	header  []byte
+	encrypt cipher.Stream
+	decrypt cipher.Stream
+}
+
+func newObfuscated2Client(t *testing.T, secret []byte, tag uint32, dc int16) *obfuscated2Client {
+	hdr := make([]byte, 64)
+	_, err := rand.Read(hdr)
+	require.NoError(t, err)
+	binary.LittleEndian.PutUint32(hdr[56:], tag)
+	binary.LittleEndian.PutUint16(hdr[60:], uint16(dc))
+	rev := make([]byte, 48)
+	for i := range rev {
+		rev[i] = hdr[55-i]
+	}
+	newCipher := func(key, iv []byte) cipher.Stream {
+		if len(secret) > 0 {
+			sum := sha256.Sum256(append(append([]byte(nil), key...), secret...))
+			key = sum[:]
+		}
+		block, err := aes.NewCipher(key)
+		require.NoError(t, err)
+		return cipher.NewCTR(block, iv)
+	}
+	cli := &obfuscated2Client{encrypt: newCipher(hdr[8:40], hdr[40:56]), decrypt: newCipher(rev[:32], rev[32:])}
+	// Bytes 56 to 64 are sent encrypted, the rest as they are.
+	encrypted := make([]byte, 64)
+	cli.encrypt.XORKeyStream(encrypted, hdr)
+	cli.header = append(hdr[:56], encrypted[56:]...)
+	return cli
+}
+
+func (cli *obfuscated2Client) seal(data string) []byte {
+	b := []byte(data)
+	cli.encrypt.XORKeyStream(b, b)
+	return b
+}
+
+func (cli *obfuscated2Client) open(b []byte) string {
+	cli.decrypt.XORKeyStream(b, b)
+	return string(b)
+}
+
+func TestObfuscated2(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x5a}, 16)
+	newTransform, err := NewObfuscated2(secret)
+	require.NoError(t, err)
+	cli := newObfuscated2Client(t, secret, tagIntermediate, -2)
+	o := newTransform().(*Obfuscated2)
+	n, err := o.Init(cli.header[:63])
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	n, err = o.Init(cli.header)
+	require.NoError(t, err)
+	assert.Equal(t, 64, n)
+	assert.Equal(t, TransportIntermediate, o.Transport())
+	assert.Equal(t, -2, o.DC())
+	b := cli.seal("ping")
+	o.Inbound(b)
+	assert.Equal(t, "ping", string(b))
+	b = make([]byte, 4)
+	o.Outbound(b, []byte("pong"))
+	assert.Equal(t, "pong", cli.open(b))
+
+	for _, tc := range []struct {
+		name   string
+		secret []byte
+		client *obfuscated2Client
+	}{
+		{"wrong secret", secret, newObfuscated2Client(t, bytes.Repeat([]byte{0xa5}, 16), obfuscated2Abridged, 1)},
+		{"no secret", secret, newObfuscated2Client(t, nil, obfuscated2Abridged, 1)},
+		{"padded only", append([]byte{0xdd}, secret...), newObfuscated2Client(t, secret, obfuscated2Abridged, 1)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			newTransform, err := NewObfuscated2(tc.secret)
+			require.NoError(t, err)
+			_, err = newTransform().Init(tc.client.header)
+			assert.ErrorIs(t, err, ErrInvalidObfuscated2Header)
+		})
+	}
+
+	newTransform, err = NewObfuscated2(append([]byte{0xdd}, secret...))
+	require.NoError(t, err)
+	_, err = newTransform().Init(newObfuscated2Client(t, secret, tagPaddedIntermediate, 1).header)
+	assert.NoError(t, err)
+	_, err = NewObfuscated2(append([]byte{0xee}, secret...))
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+	_, err = NewObfuscated2(secret[:8])
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+}
+
+func TestObfuscated2Server(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x5a}, 16)
+	newTransform, err := NewObfuscated2(secret)
+	require.NoError(t, err)
+	s := &testServer{booted: make(chan struct{}), msgCh: make(chan int64, 4)}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gnet.Run(codec.NewHandler(s, nil), "tcp://127.0.0.1:9247",
+			gnet.WithReuseAddr(true), gnet.WithMessageEncoding(true), gnet.WithStreamTransform(time.Second, newTransform))
+	}()
+	select {
+	case <-s.booted:
+	case err := <-errCh:
+		require.FailNow(t, "engine exited before booting", "error: %v", err)
+	}
+	defer func() {
+		require.NoError(t, s.eng.Stop(context.Background()))
+		require.NoError(t, <-errCh)
+	}()
+
+	// The transport is taken from the header, the messages and the pushed data are encrypted.
+	cli := newObfuscated2Client(t, secret, obfuscated2Abridged, 2)
+	c, err := net.Dial("tcp", "127.0.0.1:9247")
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = c.Write(append(cli.header, cli.seal("\x81ping")...))
+	require.NoError(t, err)
+	var connID int64
+	select {
+	case connID = <-s.msgCh:
+	case <-time.After(time.Second):
+		require.FailNow(t, "timeout waiting for the message")
+	}
+	require.NoError(t, s.eng.AsyncWrite(connID, []byte("push"), nil))
+	reply := make([]byte, 14)
+	_, err = io.ReadFull(c, reply)
+	require.NoError(t, err)
+	assert.Equal(t, "\x80\x00\x00\x07\x01ping\x01push", cli.open(reply))
+
+	// The connection is closed if the header is encrypted with another secret.
+	cli = newObfuscated2Client(t, nil, obfuscated2Abridged, 2)
+	c, err = net.Dial("tcp", "127.0.0.1:9247")
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = c.Write(cli.header)
+	require.NoError(t, err)
+	_, err = c.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	assert.EqualValues(t, 1, s.eng.AdmissionStats().RejectedByStreamTransform)
+}
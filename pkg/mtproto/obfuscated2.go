@@ -0,0 +1,149 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mtproto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+const (
+	obfuscated2HeaderSize = 64
+	obfuscated2Abridged   = 0xefefefef // tag of the abridged transport in the obfuscated2 header
+	secretPrefixPadded    = 0xdd       // prefix of the secrets that only allow the padded intermediate transport
+	secretPrefixFakeTLS   = 0xee       // prefix of the secrets of the fake-TLS transport
+)
+
+var (
+	// ErrInvalidSecret occurs when creating the obfuscated2 transform with a malformed or unsupported secret.
+	ErrInvalidSecret = errors.New("mtproto: invalid secret")
+	// ErrInvalidObfuscated2Header occurs when the header of an obfuscated2 connection doesn't decrypt to
+	// the tag of a transport, e.g. it's encrypted with another secret.
+	ErrInvalidObfuscated2Header = errors.New("mtproto: invalid obfuscated2 header")
+)
+
+// Obfuscated2 is the gnet.StreamTransform of the obfuscated2 transport, which encrypts the stream of
+// the transport that is chosen in its header with AES-256-CTR, see
+// https://core.telegram.org/mtproto/mtproto-transports#transport-obfuscation.
+//
+// The keys are derived from the 64-byte random header that the client sends at the start of the connection,
+// and from the secret of the proxy if it's served as an MTProxy. Codec picks up the transport from it,
+// so that the server is set up as:
+//
+//	newTransform, _ := mtproto.NewObfuscated2(secret)
+//	gnet.Run(codec.NewHandler(s, nil), "tcp://:443", gnet.WithStreamTransform(0, newTransform))
+type Obfuscated2 struct {
+	secret     []byte
+	paddedOnly bool
+	decrypt    cipher.Stream
+	encrypt    cipher.Stream
+	transport  Transport
+	dc         int
+}
+
+// NewObfuscated2 returns the constructor of the Obfuscated2 of each connection for gnet.Options.StreamTransform.
+// secret is the 16-byte secret of the proxy, which may be prefixed with 0xdd to only allow the padded
+// intermediate transport, the keys are not mixed with any secret if it's empty. The secrets of
+// the fake-TLS transport, i.e. the ones prefixed with 0xee, are not supported.
+func NewObfuscated2(secret []byte) (func() gnet.StreamTransform, error) {
+	var paddedOnly bool
+	switch {
+	case len(secret) == 0 || len(secret) == 16:
+	case len(secret) == 17 && secret[0] == secretPrefixPadded:
+		secret, paddedOnly = secret[1:], true
+	case len(secret) > 16 && secret[0] == secretPrefixFakeTLS:
+		return nil, fmt.Errorf("%w: fake-TLS is not supported", ErrInvalidSecret)
+	default:
+		return nil, fmt.Errorf("%w: length %d", ErrInvalidSecret, len(secret))
+	}
+	secret = append([]byte(nil), secret...)
+	return func() gnet.StreamTransform {
+		return &Obfuscated2{secret: secret, paddedOnly: paddedOnly}
+	}, nil
+}
+
+// Transport returns the transport chosen in the header.
+func (o *Obfuscated2) Transport() Transport { return o.transport }
+
+// DC returns the ID of the data center chosen in the header, which is negative for the test servers
+// and 0 if the client leaves it out.
+func (o *Obfuscated2) DC() int { return o.dc }
+
+// Init sets up the ciphers with the header at the start of data. The client encrypts the stream
+// with the key and IV in bytes 8 to 56 of the header, and decrypts the stream with them in reverse
+// order, the tag of the transport and the data center follow them encrypted.
+func (o *Obfuscated2) Init(data []byte) (int, error) {
+	if len(data) < obfuscated2HeaderSize {
+		return 0, nil
+	}
+	var hdr, rev [obfuscated2HeaderSize]byte
+	copy(hdr[:], data)
+	for i := 8; i < 56; i++ {
+		rev[i] = hdr[63-i]
+	}
+	var err error
+	if o.decrypt, err = o.newCipher(hdr[8:40], hdr[40:56]); err != nil {
+		return 0, err
+	}
+	if o.encrypt, err = o.newCipher(rev[8:40], rev[40:56]); err != nil {
+		return 0, err
+	}
+
+	o.decrypt.XORKeyStream(hdr[:], hdr[:])
+	switch binary.LittleEndian.Uint32(hdr[56:]) {
+	case obfuscated2Abridged:
+		o.transport = TransportAbridged
+	case tagIntermediate:
+		o.transport = TransportIntermediate
+	case tagPaddedIntermediate:
+		o.transport = TransportPaddedIntermediate
+	default:
+		return 0, ErrInvalidObfuscated2Header
+	}
+	if o.paddedOnly && o.transport != TransportPaddedIntermediate {
+		return 0, fmt.Errorf("%w: %s transport is not allowed", ErrInvalidObfuscated2Header, o.transport)
+	}
+	o.dc = int(int16(binary.LittleEndian.Uint16(hdr[60:])))
+	return obfuscated2HeaderSize, nil
+}
+
+// newCipher creates the AES-256-CTR stream of key mixed with the secret and iv.
+func (o *Obfuscated2) newCipher(key, iv []byte) (cipher.Stream, error) {
+	if len(o.secret) > 0 {
+		sum := sha256.Sum256(append(append(make([]byte, 0, len(key)+len(o.secret)), key...), o.secret...))
+		key = sum[:]
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCTR(block, iv), nil
+}
+
+// Inbound decrypts the data received from the client in place.
+func (o *Obfuscated2) Inbound(b []byte) {
+	o.decrypt.XORKeyStream(b, b)
+}
+
+// Outbound encrypts the data to be sent to the client.
+func (o *Obfuscated2) Outbound(dst, src []byte) {
+	o.encrypt.XORKeyStream(dst, src)
+}
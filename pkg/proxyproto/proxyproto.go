@@ -0,0 +1,404 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proxyproto implements the version 1 and 2 of the PROXY protocol, which conveys
+// the original addresses of a connection through proxies and load balancers, as specified
+// in https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt.
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoHeader occurs when the data doesn't start with a PROXY protocol header.
+	ErrNoHeader = errors.New("proxyproto: no PROXY protocol header")
+	// ErrInvalidHeader occurs when the PROXY protocol header is malformed.
+	ErrInvalidHeader = errors.New("proxyproto: invalid PROXY protocol header")
+	// ErrIncomplete occurs when the data is a prefix of a PROXY protocol header, more data is needed to parse it.
+	ErrIncomplete = errors.New("proxyproto: incomplete PROXY protocol header")
+	// ErrUnsupportedAddr occurs when formatting a header with addresses that the version doesn't support.
+	ErrUnsupportedAddr = errors.New("proxyproto: unsupported addresses")
+)
+
+const (
+	v1Prefix = "PROXY "
+	// v1MaxLen is the maximum length of a version 1 header, including the CRLF.
+	v1MaxLen = 107
+	// v2HeaderLen is the length of the fixed part of a version 2 header.
+	v2HeaderLen = 16
+	// v2UnixAddrLen is the length of a Unix socket address in a version 2 header.
+	v2UnixAddrLen = 108
+)
+
+// v2Signature is the signature that starts a version 2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Command tells how the addresses in a header are supposed to be used.
+type Command byte
+
+const (
+	// Local means the connection is established by the proxy itself, e.g. for health checks,
+	// the addresses in the header are meaningless and the addresses of the connection apply.
+	Local Command = 0x0
+	// Proxy means the connection is relayed on behalf of another node, whose addresses are in the header.
+	Proxy Command = 0x1
+)
+
+// Types of the TLVs defined by the specification.
+const (
+	TypeALPN      byte = 0x01
+	TypeAuthority byte = 0x02
+	TypeCRC32C    byte = 0x03
+	TypeNoop      byte = 0x04
+	TypeUniqueID  byte = 0x05
+	TypeSSL       byte = 0x20
+	TypeNetNS     byte = 0x30
+)
+
+// TLV is a Type-Length-Value vector that carries additional information in a version 2 header.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// Header is a PROXY protocol header.
+type Header struct {
+	// Version is the version of the protocol, 1 or 2.
+	Version int
+	// Command is Proxy if Source and Destination hold the original addresses of the connection.
+	Command Command
+	// Source is the address of the original client, which is a *net.TCPAddr, *net.UDPAddr or *net.UnixAddr.
+	Source net.Addr
+	// Destination is the address that the original client connected to, of the same type as Source.
+	Destination net.Addr
+	// TLVs is the additional information in a version 2 header.
+	TLVs []TLV
+}
+
+// TLV returns the value of the first TLV of the given type and whether it exists.
+func (h *Header) TLV(typ byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Parse parses the header at the beginning of buf and returns the number of bytes it occupies.
+// ErrIncomplete is returned if buf is a prefix of a header, ErrNoHeader is returned if buf doesn't
+// start with a header at all. The returned header doesn't refer to buf.
+func Parse(buf []byte) (h *Header, n int, err error) {
+	if len(buf) == 0 {
+		return nil, 0, ErrIncomplete
+	}
+	switch buf[0] {
+	case v1Prefix[0]:
+		return parseV1(buf)
+	case v2Signature[0]:
+		return parseV2(buf)
+	}
+	return nil, 0, ErrNoHeader
+}
+
+// hasPrefix checks buf against prefix as far as buf goes, it returns ErrNoHeader
+// if they differ, or ErrIncomplete if buf is shorter than prefix.
+func hasPrefix(buf, prefix []byte) error {
+	n := len(buf)
+	if n > len(prefix) {
+		n = len(prefix)
+	}
+	if !bytes.Equal(buf[:n], prefix[:n]) {
+		return ErrNoHeader
+	}
+	if n < len(prefix) {
+		return ErrIncomplete
+	}
+	return nil
+}
+
+func parseV1(buf []byte) (*Header, int, error) {
+	if err := hasPrefix(buf, []byte(v1Prefix)); err != nil {
+		return nil, 0, err
+	}
+	line := buf
+	if len(line) > v1MaxLen {
+		line = line[:v1MaxLen]
+	}
+	end := bytes.Index(line, []byte("\r\n"))
+	if end < 0 {
+		if len(buf) >= v1MaxLen {
+			return nil, 0, fmt.Errorf("%w: no CRLF within %d bytes", ErrInvalidHeader, v1MaxLen)
+		}
+		return nil, 0, ErrIncomplete
+	}
+
+	fields := strings.Split(string(line[len(v1Prefix):end]), " ")
+	h := &Header{Version: 1}
+	switch fields[0] {
+	case "UNKNOWN":
+		// The rest of the line must be ignored.
+		h.Command = Local
+		return h, end + 2, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, 0, fmt.Errorf("%w: unknown protocol %q", ErrInvalidHeader, fields[0])
+	}
+	if len(fields) != 5 {
+		return nil, 0, fmt.Errorf("%w: %d fields in line", ErrInvalidHeader, len(fields))
+	}
+
+	parseIP := func(s string) (netip.Addr, error) {
+		ip, err := netip.ParseAddr(s)
+		if err != nil || ip.Zone() != "" || ip.Is4() != (fields[0] == "TCP4") {
+			return ip, fmt.Errorf("%w: invalid %s address %q", ErrInvalidHeader, fields[0], s)
+		}
+		return ip, nil
+	}
+	parsePort := func(s string) (int, error) {
+		port, err := strconv.ParseUint(s, 10, 16)
+		if err != nil || (len(s) > 1 && s[0] == '0') {
+			return 0, fmt.Errorf("%w: invalid port %q", ErrInvalidHeader, s)
+		}
+		return int(port), nil
+	}
+	srcIP, err := parseIP(fields[1])
+	if err != nil {
+		return nil, 0, err
+	}
+	dstIP, err := parseIP(fields[2])
+	if err != nil {
+		return nil, 0, err
+	}
+	srcPort, err := parsePort(fields[3])
+	if err != nil {
+		return nil, 0, err
+	}
+	dstPort, err := parsePort(fields[4])
+	if err != nil {
+		return nil, 0, err
+	}
+	h.Command = Proxy
+	h.Source = &net.TCPAddr{IP: srcIP.AsSlice(), Port: srcPort}
+	h.Destination = &net.TCPAddr{IP: dstIP.AsSlice(), Port: dstPort}
+	return h, end + 2, nil
+}
+
+func parseV2(buf []byte) (*Header, int, error) {
+	if err := hasPrefix(buf, v2Signature); err != nil {
+		return nil, 0, err
+	}
+	if len(buf) < v2HeaderLen {
+		return nil, 0, ErrIncomplete
+	}
+	if ver := buf[12] >> 4; ver != 2 {
+		return nil, 0, fmt.Errorf("%w: unknown version %d", ErrInvalidHeader, ver)
+	}
+	h := &Header{Version: 2, Command: Command(buf[12] & 0xf)}
+	if h.Command != Local && h.Command != Proxy {
+		return nil, 0, fmt.Errorf("%w: unknown command %d", ErrInvalidHeader, h.Command)
+	}
+	n := v2HeaderLen + int(binary.BigEndian.Uint16(buf[14:16]))
+	if len(buf) < n {
+		return nil, 0, ErrIncomplete
+	}
+	payload := buf[v2HeaderLen:n]
+
+	family, transport := buf[13]>>4, buf[13]&0xf
+	var addrLen int
+	switch family {
+	case 0x0: // AF_UNSPEC
+	case 0x1: // AF_INET
+		addrLen = 2*net.IPv4len + 4
+	case 0x2: // AF_INET6
+		addrLen = 2*net.IPv6len + 4
+	case 0x3: // AF_UNIX
+		addrLen = 2 * v2UnixAddrLen
+	default:
+		return nil, 0, fmt.Errorf("%w: unknown address family %d", ErrInvalidHeader, family)
+	}
+	if transport > 0x2 {
+		return nil, 0, fmt.Errorf("%w: unknown transport protocol %d", ErrInvalidHeader, transport)
+	}
+	if len(payload) < addrLen {
+		return nil, 0, fmt.Errorf("%w: %d bytes of addresses are too short", ErrInvalidHeader, len(payload))
+	}
+
+	// The addresses must be ignored for LOCAL, and they are unknown if either family or transport is unspecified.
+	if h.Command == Proxy && family != 0x0 && transport != 0x0 {
+		stream := transport == 0x1
+		switch family {
+		case 0x1, 0x2:
+			ipLen := (addrLen - 4) / 2
+			srcIP := append(net.IP(nil), payload[:ipLen]...)
+			dstIP := append(net.IP(nil), payload[ipLen:2*ipLen]...)
+			srcPort := int(binary.BigEndian.Uint16(payload[2*ipLen:]))
+			dstPort := int(binary.BigEndian.Uint16(payload[2*ipLen+2:]))
+			if stream {
+				h.Source = &net.TCPAddr{IP: srcIP, Port: srcPort}
+				h.Destination = &net.TCPAddr{IP: dstIP, Port: dstPort}
+			} else {
+				h.Source = &net.UDPAddr{IP: srcIP, Port: srcPort}
+				h.Destination = &net.UDPAddr{IP: dstIP, Port: dstPort}
+			}
+		case 0x3:
+			network := "unix"
+			if !stream {
+				network = "unixgram"
+			}
+			h.Source = &net.UnixAddr{Name: unixName(payload[:v2UnixAddrLen]), Net: network}
+			h.Destination = &net.UnixAddr{Name: unixName(payload[v2UnixAddrLen:addrLen]), Net: network}
+		}
+	} else if h.Command == Proxy {
+		h.Command = Local
+	}
+
+	for tlvs := payload[addrLen:]; len(tlvs) > 0; {
+		if len(tlvs) < 3 {
+			return nil, 0, fmt.Errorf("%w: truncated TLV", ErrInvalidHeader)
+		}
+		l := int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < 3+l {
+			return nil, 0, fmt.Errorf("%w: truncated TLV", ErrInvalidHeader)
+		}
+		h.TLVs = append(h.TLVs, TLV{Type: tlvs[0], Value: append([]byte(nil), tlvs[3:3+l]...)})
+		tlvs = tlvs[3+l:]
+	}
+	return h, n, nil
+}
+
+func unixName(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// addrInfo extracts the IP and port of addr, which is a *net.TCPAddr or *net.UDPAddr.
+func addrInfo(addr net.Addr) (ip net.IP, port int, stream, ok bool) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP, a.Port, true, true
+	case *net.UDPAddr:
+		return a.IP, a.Port, false, true
+	}
+	return
+}
+
+// Format encodes the header in its version, a version 1 header supports only TCP addresses
+// and can't carry TLVs, ErrUnsupportedAddr is returned if the addresses can't be encoded.
+func (h *Header) Format() ([]byte, error) {
+	switch h.Version {
+	case 1:
+		return h.formatV1()
+	case 2:
+		return h.formatV2()
+	}
+	return nil, fmt.Errorf("proxyproto: unknown version %d", h.Version)
+}
+
+func (h *Header) formatV1() ([]byte, error) {
+	if h.Command == Local {
+		return []byte(v1Prefix + "UNKNOWN\r\n"), nil
+	}
+	src, ok := h.Source.(*net.TCPAddr)
+	if !ok {
+		return nil, ErrUnsupportedAddr
+	}
+	dst, ok := h.Destination.(*net.TCPAddr)
+	if !ok {
+		return nil, ErrUnsupportedAddr
+	}
+	proto := "TCP6"
+	srcIP, dstIP := src.IP.To16(), dst.IP.To16()
+	if src.IP.To4() != nil && dst.IP.To4() != nil {
+		proto, srcIP, dstIP = "TCP4", src.IP.To4(), dst.IP.To4()
+	}
+	if srcIP == nil || dstIP == nil {
+		return nil, ErrUnsupportedAddr
+	}
+	srcAddr, _ := netip.AddrFromSlice(srcIP)
+	dstAddr, _ := netip.AddrFromSlice(dstIP)
+	return []byte(fmt.Sprintf("%s%s %s %s %d %d\r\n", v1Prefix, proto, srcAddr, dstAddr, src.Port, dst.Port)), nil
+}
+
+func (h *Header) formatV2() ([]byte, error) {
+	buf := make([]byte, v2HeaderLen, v2HeaderLen+2*v2UnixAddrLen)
+	copy(buf, v2Signature)
+	buf[12] = 0x20 | byte(h.Command&0xf)
+
+	if h.Command == Proxy {
+		if srcIP, srcPort, stream, ok := addrInfo(h.Source); ok {
+			dstIP, dstPort, dstStream, ok := addrInfo(h.Destination)
+			if !ok || stream != dstStream {
+				return nil, ErrUnsupportedAddr
+			}
+			family := byte(0x20)
+			if srcIP.To4() != nil && dstIP.To4() != nil {
+				family = 0x10
+				srcIP, dstIP = srcIP.To4(), dstIP.To4()
+			} else {
+				srcIP, dstIP = srcIP.To16(), dstIP.To16()
+			}
+			if srcIP == nil || dstIP == nil {
+				return nil, ErrUnsupportedAddr
+			}
+			transport := byte(0x1)
+			if !stream {
+				transport = 0x2
+			}
+			buf[13] = family | transport
+			buf = append(buf, srcIP...)
+			buf = append(buf, dstIP...)
+			buf = binary.BigEndian.AppendUint16(buf, uint16(srcPort))
+			buf = binary.BigEndian.AppendUint16(buf, uint16(dstPort))
+		} else if src, ok := h.Source.(*net.UnixAddr); ok {
+			dst, ok := h.Destination.(*net.UnixAddr)
+			if !ok || len(src.Name) > v2UnixAddrLen || len(dst.Name) > v2UnixAddrLen {
+				return nil, ErrUnsupportedAddr
+			}
+			buf[13] = 0x31
+			if src.Net == "unixgram" {
+				buf[13] = 0x32
+			}
+			buf = append(buf, make([]byte, 2*v2UnixAddrLen)...)
+			copy(buf[v2HeaderLen:], src.Name)
+			copy(buf[v2HeaderLen+v2UnixAddrLen:], dst.Name)
+		} else {
+			return nil, ErrUnsupportedAddr
+		}
+	}
+
+	for _, tlv := range h.TLVs {
+		if len(tlv.Value) > 0xffff {
+			return nil, fmt.Errorf("proxyproto: TLV of %d bytes is too long", len(tlv.Value))
+		}
+		buf = append(buf, tlv.Type)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(tlv.Value)))
+		buf = append(buf, tlv.Value...)
+	}
+	if len(buf)-v2HeaderLen > 0xffff {
+		return nil, fmt.Errorf("proxyproto: header of %d bytes is too long", len(buf))
+	}
+	binary.BigEndian.PutUint16(buf[14:16], uint16(len(buf)-v2HeaderLen))
+	return buf, nil
+}
@@ -0,0 +1,132 @@
+package proxyproto
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseV1(t *testing.T) {
+	buf := []byte("PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\nGET /")
+	h, n, err := Parse(buf)
+	require.NoError(t, err)
+	assert.Equal(t, len(buf)-len("GET /"), n)
+	assert.Equal(t, 1, h.Version)
+	assert.Equal(t, Proxy, h.Command)
+	assert.Equal(t, "192.168.0.1:56324", h.Source.String())
+	assert.Equal(t, "10.0.0.1:443", h.Destination.String())
+
+	h, _, err = Parse([]byte("PROXY TCP6 2001:db8::1 ::1 1 2\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:1", h.Source.String())
+
+	h, n, err = Parse([]byte("PROXY UNKNOWN ignored\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 23, n)
+	assert.Equal(t, Local, h.Command)
+	assert.Nil(t, h.Source)
+
+	for i := 1; i < len(buf)-len("\r\nGET /"); i++ {
+		_, _, err = Parse(buf[:i])
+		assert.ErrorIs(t, err, ErrIncomplete, "%q", buf[:i])
+	}
+
+	for _, s := range []string{
+		"PROXY TCP4 192.168.0.1 10.0.0.1 56324\r\n",
+		"PROXY TCP4 ::1 10.0.0.1 56324 443\r\n",
+		"PROXY TCP6 192.168.0.1 ::1 56324 443\r\n",
+		"PROXY TCP4 192.168.0.1 10.0.0.1 65536 443\r\n",
+		"PROXY TCP4 192.168.0.1 10.0.0.1 0443 443\r\n",
+		"PROXY UDP4 192.168.0.1 10.0.0.1 56324 443\r\n",
+		"PROXY " + string(make([]byte, 120)),
+	} {
+		_, _, err = Parse([]byte(s))
+		assert.ErrorIs(t, err, ErrInvalidHeader, "%q", s)
+	}
+	for _, s := range []string{"GET / HTTP/1.1\r\n", "PROXX", "\r\n\r\nX"} {
+		_, _, err = Parse([]byte(s))
+		assert.ErrorIs(t, err, ErrNoHeader, "%q", s)
+	}
+}
+
+func TestFormatParseV2(t *testing.T) {
+	headers := []*Header{
+		{
+			Version:     2,
+			Command:     Proxy,
+			Source:      &net.TCPAddr{IP: net.ParseIP("192.168.0.1").To4(), Port: 56324},
+			Destination: &net.TCPAddr{IP: net.ParseIP("10.0.0.1").To4(), Port: 443},
+			TLVs:        []TLV{{Type: TypeAuthority, Value: []byte("example.com")}, {Type: TypeNoop}},
+		},
+		{
+			Version:     2,
+			Command:     Proxy,
+			Source:      &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1},
+			Destination: &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2},
+		},
+		{
+			Version:     2,
+			Command:     Proxy,
+			Source:      &net.UnixAddr{Name: "/tmp/src.sock", Net: "unix"},
+			Destination: &net.UnixAddr{Name: "/tmp/dst.sock", Net: "unix"},
+		},
+		{
+			Version: 2,
+			Command: Local,
+			TLVs:    []TLV{{Type: TypeUniqueID, Value: []byte{1, 2, 3}}},
+		},
+	}
+	for _, h := range headers {
+		buf, err := h.Format()
+		require.NoError(t, err)
+		for i := 0; i < len(buf); i++ {
+			_, _, err = Parse(buf[:i])
+			require.ErrorIs(t, err, ErrIncomplete)
+		}
+		parsed, n, err := Parse(append(buf, "trailing"...))
+		require.NoError(t, err)
+		assert.Equal(t, len(buf), n)
+		assert.Equal(t, h, parsed)
+	}
+
+	v, ok := headers[0].TLV(TypeAuthority)
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", string(v))
+
+	buf, err := headers[0].Format()
+	require.NoError(t, err)
+	buf[12] = 0x31
+	_, _, err = Parse(buf)
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+	buf[12] = 0x21
+	buf[len(buf)-15] = 0xff // the length of the first TLV
+	_, _, err = Parse(buf)
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+}
+
+func TestFormatV1(t *testing.T) {
+	h := &Header{
+		Version:     1,
+		Command:     Proxy,
+		Source:      &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 56324},
+		Destination: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443},
+	}
+	buf, err := h.Format()
+	require.NoError(t, err)
+	assert.Equal(t, "PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\n", string(buf))
+
+	h.Destination = &net.TCPAddr{IP: net.ParseIP("::1"), Port: 443}
+	buf, err = h.Format()
+	require.NoError(t, err)
+	assert.Equal(t, "PROXY TCP6 ::ffff:192.168.0.1 ::1 56324 443\r\n", string(buf))
+
+	h.Source = &net.UDPAddr{IP: net.ParseIP("::1"), Port: 1}
+	_, err = h.Format()
+	assert.ErrorIs(t, err, ErrUnsupportedAddr)
+
+	buf, err = (&Header{Version: 1, Command: Local}).Format()
+	require.NoError(t, err)
+	assert.Equal(t, "PROXY UNKNOWN\r\n", string(buf))
+}
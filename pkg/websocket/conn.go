@@ -0,0 +1,328 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// Conn is a WebSocket connection over a gnet.Conn.
+type Conn struct {
+	conn        gnet.Conn
+	handler     *Handler
+	ctx         any           // user-defined context
+	isClient    bool          // whether the connection is dialed by Handler.Dial
+	upgraded    bool          // whether the opening handshake has completed
+	compress    bool          // whether permessage-deflate is negotiated
+	subprotocol string        // negotiated subprotocol
+	request     []byte        // handshake request sent by the client
+	key         string        // Sec-WebSocket-Key sent by the client
+	handshake   chan error    // result of the handshake of the client
+	req         *http.Request // handshake request received by the server
+	msgOp       OpCode        // opcode of the fragmented message, OpContinuation if there is none
+	msgDeflated bool          // whether the fragmented message is compressed
+	msg         []byte        // fragments of the message received so far
+	closeCode   int           // code of the close frame received or sent
+	closeReason string        // reason of the close frame received or sent
+	closeSent   bool          // whether a close frame has been sent
+}
+
+// closeError is a failure of the protocol which closes the connection with code.
+type closeError struct {
+	code   int
+	reason string
+}
+
+func (e *closeError) Error() string {
+	return "websocket: " + e.reason
+}
+
+func protocolError(reason string) error {
+	return &closeError{CloseProtocolError, reason}
+}
+
+// Underlying returns the gnet.Conn that the connection runs on, whose context must not be changed.
+func (c *Conn) Underlying() gnet.Conn { return c.conn }
+
+// Request returns the handshake request received by the server, it's nil on the client side.
+func (c *Conn) Request() *http.Request { return c.req }
+
+// Subprotocol returns the negotiated subprotocol.
+func (c *Conn) Subprotocol() string { return c.subprotocol }
+
+// Compressed reports whether the permessage-deflate extension is negotiated.
+func (c *Conn) Compressed() bool { return c.compress }
+
+// Context returns the user-defined context.
+func (c *Conn) Context() any { return c.ctx }
+
+// SetContext sets a user-defined context.
+func (c *Conn) SetContext(ctx any) { c.ctx = ctx }
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+// WriteMessage writes a message of op, which is one of OpText, OpBinary, OpPing and OpPong.
+//
+// Note that this method is not concurrency-safe, you must invoke it within any method in EventHandler.
+func (c *Conn) WriteMessage(op OpCode, data []byte) error {
+	frame, err := c.frame(op, data)
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Writev(frame)
+	return err
+}
+
+// AsyncWriteMessage is like WriteMessage but it's concurrency-safe, callback is invoked
+// on the event-loop after the message is written. data must not be modified until then.
+func (c *Conn) AsyncWriteMessage(op OpCode, data []byte, callback gnet.AsyncCallback) error {
+	frame, err := c.frame(op, data)
+	if err != nil {
+		return err
+	}
+	return c.conn.AsyncWritev(frame, callback)
+}
+
+// Close sends a close frame of code and reason, then closes the connection.
+// It's concurrency-safe.
+func (c *Conn) Close(code int, reason string) error {
+	return c.conn.AsyncWritev(c.closeFrame(code, reason), func(gc gnet.Conn, _ error) error {
+		if !c.closeSent {
+			c.closeSent = true
+			c.closeCode, c.closeReason = code, reason
+		}
+		return gc.Close()
+	})
+}
+
+// frame encodes a frame of message op with data.
+func (c *Conn) frame(op OpCode, data []byte) ([][]byte, error) {
+	switch op {
+	case OpText, OpBinary:
+	case OpPing, OpPong:
+		if len(data) > 125 {
+			return nil, ErrControlTooLong
+		}
+	default:
+		return nil, ErrInvalidOpCode
+	}
+
+	deflated := false
+	if c.compress && !op.isControl() && len(data) >= compressThreshold {
+		var err error
+		if data, err = deflate(data); err != nil {
+			return nil, err
+		}
+		deflated = true
+	}
+	return c.encode(op, data, deflated), nil
+}
+
+// closeFrame encodes a close frame of code and reason, the reason is truncated to fit in the frame.
+func (c *Conn) closeFrame(code int, reason string) [][]byte {
+	if code == CloseNoStatusReceived {
+		return c.encode(OpClose, nil, false)
+	}
+	if len(reason) > 123 {
+		reason = reason[:123]
+		for !utf8.ValidString(reason) {
+			reason = reason[:len(reason)-1]
+		}
+	}
+	payload := make([]byte, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], reason)
+	return c.encode(OpClose, payload, false)
+}
+
+// encode encodes a final frame of op with payload, which is masked if the connection is a client.
+func (c *Conn) encode(op OpCode, payload []byte, deflated bool) [][]byte {
+	hdr := make([]byte, 2, 14)
+	hdr[0] = 0x80 | byte(op)
+	if deflated {
+		hdr[0] |= 0x40
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	if !c.isClient {
+		return [][]byte{hdr, payload}
+	}
+
+	// The frames of clients are masked, which is done on a copy of the payload.
+	var key [4]byte
+	_, _ = rand.Read(key[:])
+	hdr[1] |= 0x80
+	hdr = append(hdr, key[:]...)
+	masked := make([]byte, len(payload))
+	copy(masked, payload)
+	mask(masked, key)
+	return [][]byte{hdr, masked}
+}
+
+// writeClose sends a close frame in reply to a close frame or on a failure.
+func (c *Conn) writeClose(code int, reason string) {
+	if c.closeSent {
+		return
+	}
+	c.closeSent = true
+	_, _ = c.conn.Writev(c.closeFrame(code, reason))
+}
+
+// fail closes the connection with the close code of err.
+func (c *Conn) fail(err error) gnet.Action {
+	ce := &closeError{CloseInternalServerErr, err.Error()}
+	_ = errors.As(err, &ce)
+	if !c.closeSent {
+		c.closeCode, c.closeReason = ce.code, ce.reason
+	}
+	c.writeClose(ce.code, ce.reason)
+	return gnet.Close
+}
+
+// serve reads the frames from the connection until it runs out of complete frames.
+func (c *Conn) serve() gnet.Action {
+	for {
+		f, size, err := c.readFrame()
+		if err != nil {
+			return c.fail(err)
+		}
+		if size == 0 {
+			return gnet.None
+		}
+		action, err := c.handleFrame(f)
+		_, _ = c.conn.Discard(size)
+		if err != nil {
+			return c.fail(err)
+		}
+		if action != gnet.None {
+			return action
+		}
+	}
+}
+
+func (c *Conn) handleFrame(f frame) (gnet.Action, error) {
+	switch f.op {
+	case OpPing:
+		_, err := c.conn.Writev(c.encode(OpPong, f.payload, false))
+		return gnet.None, err
+	case OpPong:
+		if h, ok := c.handler.eh.(PongHandler); ok {
+			return h.OnPong(c, f.payload), nil
+		}
+		return gnet.None, nil
+	case OpClose:
+		code, reason, err := parseClose(f.payload)
+		if err != nil {
+			return gnet.None, err
+		}
+		if !c.closeSent {
+			c.closeCode, c.closeReason = code, reason
+			c.writeClose(code, "")
+		}
+		return gnet.Close, nil
+	case OpText, OpBinary:
+		if c.msgOp != OpContinuation {
+			return gnet.None, protocolError("expected continuation frame")
+		}
+		if f.fin {
+			return c.deliver(f.op, f.payload, f.rsv1)
+		}
+		c.msgOp, c.msgDeflated = f.op, f.rsv1
+		c.msg = append(c.msg[:0], f.payload...)
+		return gnet.None, nil
+	default: // OpContinuation
+		if c.msgOp == OpContinuation {
+			return gnet.None, protocolError("unexpected continuation frame")
+		}
+		if len(c.msg)+len(f.payload) > c.handler.config.MaxMessageSize {
+			return gnet.None, &closeError{CloseMessageTooBig, "message too big"}
+		}
+		c.msg = append(c.msg, f.payload...)
+		if !f.fin {
+			return gnet.None, nil
+		}
+		op := c.msgOp
+		c.msgOp = OpContinuation
+		action, err := c.deliver(op, c.msg, c.msgDeflated)
+		if cap(c.msg) > maxRetainedMessageSize {
+			c.msg = nil
+		} else {
+			c.msg = c.msg[:0]
+		}
+		return action, err
+	}
+}
+
+// deliver hands a complete message over to EventHandler.
+func (c *Conn) deliver(op OpCode, data []byte, deflated bool) (gnet.Action, error) {
+	if deflated {
+		var err error
+		if data, err = inflate(data, c.handler.config.MaxMessageSize); err != nil {
+			return gnet.None, err
+		}
+	}
+	if op == OpText && !utf8.Valid(data) {
+		return gnet.None, &closeError{CloseInvalidFramePayloadData, "invalid UTF-8 in text message"}
+	}
+	return c.handler.eh.OnMessage(c, op, data), nil
+}
+
+// parseClose parses the payload of a close frame.
+func parseClose(payload []byte) (code int, reason string, err error) {
+	switch {
+	case len(payload) == 0:
+		return CloseNoStatusReceived, "", nil
+	case len(payload) == 1:
+		return 0, "", protocolError("invalid close frame")
+	}
+	code = int(binary.BigEndian.Uint16(payload))
+	if !validCloseCode(code) {
+		return 0, "", protocolError("invalid close code")
+	}
+	if !utf8.Valid(payload[2:]) {
+		return 0, "", &closeError{CloseInvalidFramePayloadData, "invalid UTF-8 in close reason"}
+	}
+	return code, string(payload[2:]), nil
+}
+
+// validCloseCode reports whether code can be sent in a close frame, see RFC 6455, section 7.4.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
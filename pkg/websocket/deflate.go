@@ -0,0 +1,162 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+	"sync"
+)
+
+// compressThreshold is the minimum size of the messages that are compressed,
+// the smaller ones are hardly shrunk by compression.
+const compressThreshold = 128
+
+const deflateExtension = "permessage-deflate"
+
+// deflateResponse is the only parameters of permessage-deflate that are negotiated,
+// each message is compressed without the context of the previous ones.
+const deflateResponse = deflateExtension + "; server_no_context_takeover; client_no_context_takeover"
+
+var (
+	// deflateTail is the end of the sync flush of each compressed message,
+	// which is removed before the message is sent.
+	deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+	// inflateTail restores deflateTail and appends a final empty block.
+	inflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+	flateWriterPool sync.Pool
+	flateReaderPool sync.Pool
+)
+
+// deflate compresses a message.
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	fw, _ := flateWriterPool.Get().(*flate.Writer)
+	if fw == nil {
+		fw, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	} else {
+		fw.Reset(&buf)
+	}
+	defer flateWriterPool.Put(fw)
+
+	if _, err := fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := fw.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), deflateTail), nil
+}
+
+// inflate decompresses a message which is no larger than limit.
+func inflate(data []byte, limit int) ([]byte, error) {
+	src := io.MultiReader(bytes.NewReader(data), bytes.NewReader(inflateTail))
+	fr, _ := flateReaderPool.Get().(io.ReadCloser)
+	if fr == nil {
+		fr = flate.NewReader(src)
+	} else {
+		_ = fr.(flate.Resetter).Reset(src, nil)
+	}
+	defer flateReaderPool.Put(fr)
+
+	out, err := io.ReadAll(io.LimitReader(fr, int64(limit)+1))
+	if err != nil {
+		return nil, &closeError{CloseInvalidFramePayloadData, "invalid compressed message"}
+	}
+	if len(out) > limit {
+		return nil, &closeError{CloseMessageTooBig, "message too big"}
+	}
+	return out, nil
+}
+
+// acceptDeflate reports whether any of the permessage-deflate offers in the Sec-WebSocket-Extensions
+// header of the client can be accepted, the offers that limit the window of the server can't.
+func acceptDeflate(header []string) bool {
+	for _, offer := range parseExtensions(header) {
+		if offer[0] != deflateExtension {
+			continue
+		}
+		ok := true
+		for _, param := range offer[1:] {
+			name, value, _ := strings.Cut(param, "=")
+			switch name {
+			case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+			case "server_max_window_bits":
+				ok = strings.Trim(value, `"`) == "15"
+			default:
+				ok = false
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDeflateResponse reports whether the extensions in the Sec-WebSocket-Extensions header of the server
+// are acceptable to the client, and whether permessage-deflate is negotiated.
+func checkDeflateResponse(header []string, offered bool) (negotiated, ok bool) {
+	for _, ext := range parseExtensions(header) {
+		if ext[0] != deflateExtension || !offered || negotiated {
+			return false, false
+		}
+		negotiated = true
+		contextTakeover := true
+		for _, param := range ext[1:] {
+			name, value, _ := strings.Cut(param, "=")
+			switch name {
+			case "server_no_context_takeover":
+				contextTakeover = false
+			case "client_no_context_takeover", "server_max_window_bits":
+			case "client_max_window_bits":
+				if value != "" && strings.Trim(value, `"`) != "15" {
+					return false, false
+				}
+			default:
+				return false, false
+			}
+		}
+		if contextTakeover {
+			return false, false
+		}
+	}
+	return negotiated, true
+}
+
+// parseExtensions splits the Sec-WebSocket-Extensions header into the extensions,
+// each of which is the name followed by the parameters.
+func parseExtensions(header []string) (exts [][]string) {
+	for _, h := range header {
+		for _, ext := range strings.Split(h, ",") {
+			var fields []string
+			for _, f := range strings.Split(ext, ";") {
+				if f = strings.TrimSpace(f); f != "" {
+					fields = append(fields, strings.ToLower(f))
+				}
+			}
+			if len(fields) > 0 {
+				exts = append(exts, fields)
+			}
+		}
+	}
+	return
+}
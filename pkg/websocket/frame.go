@@ -0,0 +1,109 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// maxRetainedMessageSize is the maximum capacity of the buffer for fragmented messages
+// that is kept for the next message.
+const maxRetainedMessageSize = 64 << 10
+
+// frame is a WebSocket frame whose payload has been unmasked.
+type frame struct {
+	fin     bool
+	rsv1    bool
+	op      OpCode
+	payload []byte // payload in the inbound buffer, only valid until the frame is discarded
+}
+
+// readFrame peeks a frame from the inbound buffer of the connection, it returns the size
+// of the frame in the buffer, which is 0 if the frame is incomplete.
+func (c *Conn) readFrame() (f frame, size int, err error) {
+	buf, err := c.conn.Peek(2)
+	if err != nil {
+		return f, 0, nil
+	}
+	b0, b1 := buf[0], buf[1]
+	f.fin = b0&0x80 != 0
+	f.rsv1 = b0&0x40 != 0
+	f.op = OpCode(b0 & 0x0f)
+	if b0&0x30 != 0 {
+		return f, 0, protocolError("reserved bits are set")
+	}
+	switch f.op {
+	case OpContinuation, OpText, OpBinary:
+		if f.rsv1 && (!c.compress || f.op == OpContinuation) {
+			return f, 0, protocolError("unexpected compressed frame")
+		}
+	case OpClose, OpPing, OpPong:
+		if !f.fin || f.rsv1 || b1&0x7f > 125 {
+			return f, 0, protocolError("invalid control frame")
+		}
+	default:
+		return f, 0, protocolError("invalid opcode")
+	}
+	// The frames from clients must be masked and the ones from servers must not.
+	masked := b1&0x80 != 0
+	if masked == c.isClient {
+		return f, 0, protocolError("invalid masking")
+	}
+
+	hdrLen := 2
+	switch b1 & 0x7f {
+	case 126:
+		hdrLen += 2
+	case 127:
+		hdrLen += 8
+	}
+	if masked {
+		hdrLen += 4
+	}
+	if buf, err = c.conn.Peek(hdrLen); err != nil {
+		return f, 0, nil
+	}
+	length := uint64(b1 & 0x7f)
+	switch length {
+	case 126:
+		length = uint64(binary.BigEndian.Uint16(buf[2:]))
+	case 127:
+		length = binary.BigEndian.Uint64(buf[2:])
+		if length > math.MaxInt64 {
+			return f, 0, protocolError("invalid payload length")
+		}
+	}
+	if length > uint64(c.handler.config.MaxMessageSize) {
+		return f, 0, &closeError{CloseMessageTooBig, "message too big"}
+	}
+
+	size = hdrLen + int(length)
+	if buf, err = c.conn.Peek(size); err != nil {
+		return f, 0, nil
+	}
+	f.payload = buf[hdrLen:size]
+	if masked {
+		mask(f.payload, [4]byte(buf[hdrLen-4:hdrLen]))
+	}
+	return f, size, nil
+}
+
+// mask masks or unmasks the payload b with key.
+func mask(b []byte, key [4]byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
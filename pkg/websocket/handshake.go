@@ -0,0 +1,270 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var headerEnd = []byte("\r\n\r\n")
+
+// computeAccept computes Sec-WebSocket-Accept from Sec-WebSocket-Key.
+func computeAccept(key string) string {
+	h := sha1.New() //nolint:gosec
+	h.Write([]byte(key))
+	h.Write([]byte(acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerContains reports whether the comma-separated header of name contains token.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// peekHeader peeks the HTTP header of the handshake, it returns nil if the header is incomplete.
+func (c *Conn) peekHeader() ([]byte, error) {
+	buf, _ := c.conn.Peek(-1)
+	if i := bytes.Index(buf, headerEnd); i >= 0 {
+		if i+len(headerEnd) > c.handler.config.MaxHeaderSize {
+			return nil, errHeaderTooLarge
+		}
+		return buf[:i+len(headerEnd)], nil
+	}
+	if len(buf) >= c.handler.config.MaxHeaderSize {
+		return nil, errHeaderTooLarge
+	}
+	return nil, nil
+}
+
+var errHeaderTooLarge = fmt.Errorf("%w: header too large", ErrBadHandshake)
+
+// upgrade runs the opening handshake of the server.
+func (c *Conn) upgrade() gnet.Action {
+	hdr, err := c.peekHeader()
+	if err != nil {
+		return c.refuse(http.StatusRequestHeaderFieldsTooLarge, nil)
+	}
+	if hdr == nil {
+		return gnet.None
+	}
+	r, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(hdr)))
+	if err != nil {
+		return c.refuse(http.StatusBadRequest, nil)
+	}
+	_, _ = c.conn.Discard(len(hdr))
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet || !r.ProtoAtLeast(1, 1):
+		return c.refuse(http.StatusBadRequest, nil)
+	case !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket"):
+		return c.refuse(http.StatusUpgradeRequired, http.Header{"Upgrade": {"websocket"}})
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		return c.refuse(http.StatusUpgradeRequired, http.Header{"Sec-WebSocket-Version": {"13"}})
+	}
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return c.refuse(http.StatusBadRequest, nil)
+	}
+	config := &c.handler.config
+	if config.CheckOrigin != nil && !config.CheckOrigin(r) {
+		return c.refuse(http.StatusForbidden, nil)
+	}
+
+	var resp strings.Builder
+	resp.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	resp.WriteString(computeAccept(key))
+	resp.WriteString("\r\n")
+	if c.subprotocol = selectSubprotocol(r, config.Subprotocols); c.subprotocol != "" {
+		resp.WriteString("Sec-WebSocket-Protocol: " + c.subprotocol + "\r\n")
+	}
+	if config.Compression && acceptDeflate(r.Header.Values("Sec-WebSocket-Extensions")) {
+		c.compress = true
+		resp.WriteString("Sec-WebSocket-Extensions: " + deflateResponse + "\r\n")
+	}
+	resp.WriteString("\r\n")
+	if _, err = c.conn.Write([]byte(resp.String())); err != nil {
+		return gnet.Close
+	}
+
+	c.req = r
+	c.upgraded = true
+	return c.handler.eh.OnOpen(c)
+}
+
+// refuse responds to the handshake request with status and closes the connection.
+func (c *Conn) refuse(status int, header http.Header) gnet.Action {
+	var resp bytes.Buffer
+	fmt.Fprintf(&resp, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	_ = header.Write(&resp)
+	resp.WriteString("Connection: close\r\nContent-Length: 0\r\n\r\n")
+	_, _ = c.conn.Write(resp.Bytes())
+	return gnet.Close
+}
+
+// selectSubprotocol selects the first one of subprotocols that is requested by r.
+func selectSubprotocol(r *http.Request, subprotocols []string) string {
+	for _, p := range subprotocols {
+		if headerContains(r.Header, "Sec-WebSocket-Protocol", p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// Dial dials rawURL with cli and runs the opening handshake with header on the connection, cli must be
+// created with h as its gnet.EventHandler. A "wss" URL requires gnet.WithTLSConfig on cli.
+func (h *Handler) Dial(cli *gnet.Client, rawURL string, header http.Header) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	addr := u.Host
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "80")
+		}
+	case "wss":
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		}
+	default:
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+
+	var key [16]byte
+	_, _ = rand.Read(key[:])
+	c := &Conn{
+		handler:   h,
+		isClient:  true,
+		key:       base64.StdEncoding.EncodeToString(key[:]),
+		handshake: make(chan error, 1),
+	}
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "GET %s HTTP/1.1\r\nHost: %s\r\n", u.RequestURI(), u.Host)
+	req.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\n")
+	req.WriteString("Sec-WebSocket-Key: " + c.key + "\r\n")
+	if len(h.config.Subprotocols) > 0 {
+		req.WriteString("Sec-WebSocket-Protocol: " + strings.Join(h.config.Subprotocols, ", ") + "\r\n")
+	}
+	if h.config.Compression {
+		req.WriteString("Sec-WebSocket-Extensions: " + deflateResponse + "\r\n")
+	}
+	_ = header.Write(&req)
+	req.WriteString("\r\n")
+	c.request = req.Bytes()
+	result := c.handshake
+
+	gc, err := cli.DialContext("tcp", addr, c)
+	if err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(h.config.HandshakeTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-result:
+	case <-timer.C:
+		err = ErrHandshakeTimeout
+	}
+	if err != nil {
+		_ = gc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// readResponse runs the opening handshake of the client.
+func (c *Conn) readResponse() gnet.Action {
+	hdr, err := c.peekHeader()
+	if err != nil {
+		c.finishHandshake(err)
+		return gnet.Close
+	}
+	if hdr == nil {
+		return gnet.None
+	}
+	if err = c.checkResponse(hdr); err != nil {
+		c.finishHandshake(err)
+		return gnet.Close
+	}
+	_, _ = c.conn.Discard(len(hdr))
+
+	c.upgraded = true
+	c.finishHandshake(nil)
+	return c.handler.eh.OnOpen(c)
+}
+
+// checkResponse checks the handshake response hdr of the server.
+func (c *Conn) checkResponse(hdr []byte) error {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(hdr)), nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadHandshake, err)
+	}
+	switch {
+	case resp.StatusCode != http.StatusSwitchingProtocols:
+		return fmt.Errorf("%w: unexpected status %s", ErrBadHandshake, resp.Status)
+	case !headerContains(resp.Header, "Connection", "upgrade") || !headerContains(resp.Header, "Upgrade", "websocket"):
+		return fmt.Errorf("%w: missing upgrade", ErrBadHandshake)
+	case resp.Header.Get("Sec-WebSocket-Accept") != computeAccept(c.key):
+		return fmt.Errorf("%w: mismatched Sec-WebSocket-Accept", ErrBadHandshake)
+	}
+
+	if p := resp.Header.Get("Sec-WebSocket-Protocol"); p != "" {
+		found := false
+		for _, sp := range c.handler.config.Subprotocols {
+			found = found || sp == p
+		}
+		if !found {
+			return fmt.Errorf("%w: unexpected subprotocol %q", ErrBadHandshake, p)
+		}
+		c.subprotocol = p
+	}
+	negotiated, ok := checkDeflateResponse(resp.Header.Values("Sec-WebSocket-Extensions"), c.handler.config.Compression)
+	if !ok {
+		return fmt.Errorf("%w: unsupported extensions", ErrBadHandshake)
+	}
+	c.compress = negotiated
+	return nil
+}
+
+// finishHandshake reports the result of the handshake to Dial.
+func (c *Conn) finishHandshake(err error) {
+	if c.handshake == nil {
+		return
+	}
+	c.handshake <- err
+	c.handshake = nil
+}
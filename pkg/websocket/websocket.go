@@ -0,0 +1,222 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package websocket implements the WebSocket protocol of RFC 6455 and the permessage-deflate
+// extension of RFC 7692 on gnet, for both the connections accepted by the engine and the ones
+// dialed by gnet.Client.
+//
+// Handler is a gnet.EventHandler that runs the opening handshake and parses the frames, then
+// it hands the complete messages over to EventHandler:
+//
+//	h := websocket.NewHandler(myHandler, websocket.Config{Compression: true})
+//	gnet.Run(h, "tcp://:8080")
+//
+// The context of the underlying gnet.Conn is occupied by Handler, use Conn.SetContext instead.
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// OpCode is the opcode of a WebSocket frame.
+type OpCode byte
+
+// Opcodes defined in RFC 6455, section 11.8.
+const (
+	OpContinuation OpCode = 0x0
+	OpText         OpCode = 0x1
+	OpBinary       OpCode = 0x2
+	OpClose        OpCode = 0x8
+	OpPing         OpCode = 0x9
+	OpPong         OpCode = 0xa
+)
+
+func (op OpCode) isControl() bool {
+	return op&0x8 != 0
+}
+
+// Close codes defined in RFC 6455, section 11.7.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+var (
+	// ErrBadHandshake occurs when the opening handshake of Dial is refused or malformed.
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+	// ErrHandshakeTimeout occurs when the opening handshake of Dial doesn't complete in time.
+	ErrHandshakeTimeout = errors.New("websocket: timeout waiting for handshake")
+	// ErrInvalidOpCode occurs when writing a message with an opcode other than text, binary, ping and pong.
+	ErrInvalidOpCode = errors.New("websocket: invalid opcode")
+	// ErrControlTooLong occurs when writing a control message of more than 125 bytes.
+	ErrControlTooLong = errors.New("websocket: control message too long")
+)
+
+const (
+	defaultMaxMessageSize   = 16 << 20
+	defaultMaxHeaderSize    = 8 << 10
+	defaultHandshakeTimeout = 10 * time.Second
+)
+
+// Config is the configuration of Handler.
+type Config struct {
+	// MaxMessageSize is the maximum size of a message after decompression, the connections
+	// receiving larger messages are closed with CloseMessageTooBig, 16MB by default.
+	MaxMessageSize int
+
+	// MaxHeaderSize is the maximum size of the HTTP header of the opening handshake, 8KB by default.
+	MaxHeaderSize int
+
+	// Subprotocols is the subprotocols in order of preference, the server selects the first one
+	// that is requested by the client, and the client requests all of them.
+	Subprotocols []string
+
+	// Compression enables the permessage-deflate extension if the peer supports it, without
+	// context takeover in both directions, so that the messages are compressed independently.
+	Compression bool
+
+	// CheckOrigin reports whether the opening handshake of the server is accepted,
+	// all handshakes are accepted if it's nil.
+	CheckOrigin func(r *http.Request) bool
+
+	// HandshakeTimeout is the maximum amount of time for Dial to complete the opening handshake,
+	// 10 seconds by default.
+	HandshakeTimeout time.Duration
+}
+
+// EventHandler handles the events of WebSocket connections, the methods are invoked on the event-loops.
+type EventHandler interface {
+	// OnOpen fires when the opening handshake of the connection completes.
+	OnOpen(c *Conn) (action gnet.Action)
+
+	// OnMessage fires when a complete text or binary message is received, the messages
+	// that are fragmented or compressed are reassembled and decompressed before it fires.
+	// data is only valid until it returns.
+	OnMessage(c *Conn, op OpCode, data []byte) (action gnet.Action)
+
+	// OnClose fires when the connection is closed after its opening handshake completes, code and reason
+	// are of the close frame that has been received or sent, code is CloseAbnormalClosure if there is none.
+	OnClose(c *Conn, code int, reason string)
+}
+
+// PongHandler is an optional interface of EventHandler, which is notified of the pong frames.
+// Ping frames are always answered with pong frames automatically.
+type PongHandler interface {
+	// OnPong fires when a pong frame is received, data is only valid until it returns.
+	OnPong(c *Conn, data []byte) (action gnet.Action)
+}
+
+// BuiltinEventHandler is a default implementation of EventHandler, it can be embedded
+// to avoid implementing all methods of EventHandler.
+type BuiltinEventHandler struct{}
+
+// OnOpen fires when the opening handshake of the connection completes.
+func (*BuiltinEventHandler) OnOpen(_ *Conn) (action gnet.Action) {
+	return
+}
+
+// OnMessage fires when a complete text or binary message is received.
+func (*BuiltinEventHandler) OnMessage(_ *Conn, _ OpCode, _ []byte) (action gnet.Action) {
+	return
+}
+
+// OnClose fires when the connection is closed.
+func (*BuiltinEventHandler) OnClose(_ *Conn, _ int, _ string) {}
+
+// Handler is a gnet.EventHandler that speaks WebSocket on the connections, it can be embedded
+// in another gnet.EventHandler to handle the events of the engine, e.g. OnBoot and OnTick.
+type Handler struct {
+	*gnet.BuiltinEventEngine
+	eh     EventHandler
+	config Config
+}
+
+// NewHandler creates a Handler that notifies eh of the events of WebSocket connections.
+func NewHandler(eh EventHandler, config Config) *Handler {
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = defaultMaxMessageSize
+	}
+	if config.MaxHeaderSize <= 0 {
+		config.MaxHeaderSize = defaultMaxHeaderSize
+	}
+	if config.HandshakeTimeout <= 0 {
+		config.HandshakeTimeout = defaultHandshakeTimeout
+	}
+	return &Handler{eh: eh, config: config}
+}
+
+// OnOpen prepares the connection for the opening handshake, the connections dialed
+// by Handler.Dial send the handshake request.
+func (h *Handler) OnOpen(gc gnet.Conn) (out []byte, action gnet.Action) {
+	if c, ok := gc.Context().(*Conn); ok && c.isClient {
+		c.conn = gc
+		return c.request, gnet.None
+	}
+	gc.SetContext(&Conn{conn: gc, handler: h})
+	return
+}
+
+// OnTraffic runs the opening handshake and then reads the frames.
+func (h *Handler) OnTraffic(gc gnet.Conn) (action gnet.Action) {
+	c, ok := gc.Context().(*Conn)
+	if !ok {
+		return gnet.Close
+	}
+	if !c.upgraded {
+		if c.isClient {
+			action = c.readResponse()
+		} else {
+			action = c.upgrade()
+		}
+		if action != gnet.None || !c.upgraded {
+			return
+		}
+	}
+	return c.serve()
+}
+
+// OnClose notifies EventHandler of the closure of the connection, or fails Dial
+// if the connection is closed during the opening handshake.
+func (h *Handler) OnClose(gc gnet.Conn, err error) (action gnet.Action) {
+	c, ok := gc.Context().(*Conn)
+	if !ok {
+		return
+	}
+	if !c.upgraded {
+		if err == nil {
+			err = ErrBadHandshake
+		}
+		c.finishHandshake(err)
+		return
+	}
+	code, reason := c.closeCode, c.closeReason
+	if code == 0 {
+		code = CloseAbnormalClosure
+	}
+	h.eh.OnClose(c, code, reason)
+	return
+}
@@ -0,0 +1,306 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+type message struct {
+	op   OpCode
+	data string
+}
+
+type closure struct {
+	code   int
+	reason string
+}
+
+type testHandler struct {
+	BuiltinEventHandler
+	echo    bool
+	openCh  chan *Conn
+	msgCh   chan message
+	pongCh  chan string
+	closeCh chan closure
+}
+
+func newTestHandler(echo bool) *testHandler {
+	return &testHandler{
+		echo:    echo,
+		openCh:  make(chan *Conn, 1),
+		msgCh:   make(chan message, 16),
+		pongCh:  make(chan string, 1),
+		closeCh: make(chan closure, 1),
+	}
+}
+
+func (h *testHandler) OnOpen(c *Conn) gnet.Action {
+	h.openCh <- c
+	return gnet.None
+}
+
+func (h *testHandler) OnMessage(c *Conn, op OpCode, data []byte) gnet.Action {
+	if h.echo {
+		_ = c.WriteMessage(op, data)
+	}
+	h.msgCh <- message{op, string(data)}
+	return gnet.None
+}
+
+func (h *testHandler) OnPong(_ *Conn, data []byte) gnet.Action {
+	h.pongCh <- string(data)
+	return gnet.None
+}
+
+func (h *testHandler) OnClose(_ *Conn, code int, reason string) {
+	h.closeCh <- closure{code, reason}
+}
+
+type testServer struct {
+	*Handler
+	eng    gnet.Engine
+	booted chan struct{}
+}
+
+func (s *testServer) OnBoot(eng gnet.Engine) gnet.Action {
+	s.eng = eng
+	close(s.booted)
+	return gnet.None
+}
+
+func runServer(t *testing.T, addr string, eh EventHandler, config Config) (stop func()) {
+	s := &testServer{Handler: NewHandler(eh, config), booted: make(chan struct{})}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- gnet.Run(s, "tcp://"+addr, gnet.WithReuseAddr(true))
+	}()
+	select {
+	case <-s.booted:
+	case err := <-errCh:
+		require.FailNow(t, "engine exited before booting", "error: %v", err)
+	}
+	return func() {
+		require.NoError(t, s.eng.Stop(context.Background()))
+		require.NoError(t, <-errCh)
+	}
+}
+
+func expect[T any](t *testing.T, ch <-chan T) (v T) {
+	select {
+	case v = <-ch:
+	case <-time.After(time.Second):
+		require.FailNow(t, "timeout waiting for the event")
+	}
+	return
+}
+
+func TestClient(t *testing.T) {
+	for _, compression := range []bool{false, true} {
+		server := newTestHandler(true)
+		stop := runServer(t, "127.0.0.1:9240", server, Config{
+			Subprotocols: []string{"v2", "v1"},
+			Compression:  compression,
+			CheckOrigin: func(r *http.Request) bool {
+				return r.Header.Get("Origin") == "http://example.com"
+			},
+		})
+
+		client := newTestHandler(false)
+		h := NewHandler(client, Config{Subprotocols: []string{"v1", "v2"}, Compression: true})
+		cli, err := gnet.NewClient(h)
+		require.NoError(t, err)
+		require.NoError(t, cli.Start())
+
+		_, err = h.Dial(cli, "ws://127.0.0.1:9240/", nil)
+		assert.ErrorIs(t, err, ErrBadHandshake)
+
+		c, err := h.Dial(cli, "ws://127.0.0.1:9240/chat?id=1", http.Header{"Origin": {"http://example.com"}})
+		require.NoError(t, err)
+		assert.Equal(t, "v2", c.Subprotocol())
+		assert.Equal(t, compression, c.Compressed())
+		assert.Same(t, c, expect(t, client.openCh))
+		sc := expect(t, server.openCh)
+		assert.Equal(t, "/chat?id=1", sc.Request().RequestURI)
+		assert.Equal(t, compression, sc.Compressed())
+
+		// Messages are echoed in both directions, the large ones are compressed if negotiated.
+		large := strings.Repeat("gnet", 1<<14)
+		for _, msg := range []message{{OpText, "hello"}, {OpBinary, large}, {OpText, ""}} {
+			require.NoError(t, c.AsyncWriteMessage(msg.op, []byte(msg.data), nil))
+			assert.Equal(t, msg, expect(t, server.msgCh))
+			assert.Equal(t, msg, expect(t, client.msgCh))
+		}
+		require.NoError(t, c.AsyncWriteMessage(OpPing, []byte("ping"), nil))
+		assert.Equal(t, "ping", expect(t, client.pongCh))
+		assert.ErrorIs(t, c.AsyncWriteMessage(OpPing, make([]byte, 126), nil), ErrControlTooLong)
+		assert.ErrorIs(t, c.AsyncWriteMessage(OpClose, nil, nil), ErrInvalidOpCode)
+
+		require.NoError(t, c.Close(CloseGoingAway, "bye"))
+		assert.Equal(t, closure{CloseGoingAway, "bye"}, expect(t, server.closeCh))
+		assert.Equal(t, closure{CloseGoingAway, "bye"}, expect(t, client.closeCh))
+
+		require.NoError(t, cli.Stop())
+		stop()
+	}
+}
+
+// handshake runs the opening handshake with a raw connection.
+func handshake(t *testing.T, addr, extensions string) (net.Conn, *bufio.Reader, *http.Response) {
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	require.NoError(t, c.SetDeadline(time.Now().Add(time.Second)))
+	req := "GET / HTTP/1.1\r\nHost: " + addr + "\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+	if extensions != "" {
+		req += "Sec-WebSocket-Extensions: " + extensions + "\r\n"
+	}
+	_, err = c.Write([]byte(req + "\r\n"))
+	require.NoError(t, err)
+	r := bufio.NewReader(c)
+	resp, err := http.ReadResponse(r, nil)
+	require.NoError(t, err)
+	return c, r, resp
+}
+
+func writeFrame(t *testing.T, c net.Conn, b0 byte, payload []byte, masked bool) {
+	buf := []byte{b0, 0}
+	switch {
+	case len(payload) <= 125:
+		buf[1] = byte(len(payload))
+	case len(payload) <= 0xffff:
+		buf[1] = 126
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(payload)))
+	default:
+		buf[1] = 127
+		buf = binary.BigEndian.AppendUint64(buf, uint64(len(payload)))
+	}
+	p := append([]byte(nil), payload...)
+	if masked {
+		key := [4]byte{1, 2, 3, 4}
+		buf[1] |= 0x80
+		buf = append(buf, key[:]...)
+		mask(p, key)
+	}
+	_, err := c.Write(append(buf, p...))
+	require.NoError(t, err)
+}
+
+func readFrame(t *testing.T, r *bufio.Reader) (b0 byte, payload []byte) {
+	hdr := make([]byte, 2)
+	_, err := io.ReadFull(r, hdr)
+	require.NoError(t, err)
+	n := int(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		ext := make([]byte, 2)
+		_, err = io.ReadFull(r, ext)
+		require.NoError(t, err)
+		n = int(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		_, err = io.ReadFull(r, ext)
+		require.NoError(t, err)
+		n = int(binary.BigEndian.Uint64(ext))
+	}
+	payload = make([]byte, n)
+	_, err = io.ReadFull(r, payload)
+	require.NoError(t, err)
+	return hdr[0], payload
+}
+
+func expectClose(t *testing.T, r *bufio.Reader, code int) {
+	b0, payload := readFrame(t, r)
+	require.Equal(t, byte(0x80)|byte(OpClose), b0)
+	require.GreaterOrEqual(t, len(payload), 2)
+	assert.Equal(t, code, int(binary.BigEndian.Uint16(payload)))
+}
+
+func TestServer(t *testing.T) {
+	const addr = "127.0.0.1:9241"
+	server := newTestHandler(true)
+	stop := runServer(t, addr, server, Config{MaxMessageSize: 1 << 10, Compression: true})
+	defer stop()
+
+	// The requests that are not upgrades are refused.
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(c), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+
+	c, r, resp := handshake(t, addr, "permessage-deflate; server_max_window_bits=10, permessage-deflate")
+	defer c.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	assert.Equal(t, deflateResponse, resp.Header.Get("Sec-WebSocket-Extensions"))
+	expect(t, server.openCh)
+
+	// A fragmented message is reassembled with a ping in the middle.
+	writeFrame(t, c, byte(OpText), []byte("Hel"), true)
+	writeFrame(t, c, 0x80|byte(OpPing), []byte("p"), true)
+	writeFrame(t, c, 0x80|byte(OpContinuation), []byte("lo"), true)
+	b0, payload := readFrame(t, r)
+	assert.Equal(t, byte(0x80)|byte(OpPong), b0)
+	assert.Equal(t, "p", string(payload))
+	assert.Equal(t, message{OpText, "Hello"}, expect(t, server.msgCh))
+	b0, payload = readFrame(t, r)
+	assert.Equal(t, byte(0x80)|byte(OpText), b0)
+	assert.Equal(t, "Hello", string(payload))
+
+	// So is a compressed one.
+	compressed, err := deflate(bytes.Repeat([]byte("a"), 1000))
+	require.NoError(t, err)
+	writeFrame(t, c, 0x40|byte(OpBinary), compressed[:10], true)
+	writeFrame(t, c, 0x80|byte(OpContinuation), compressed[10:], true)
+	assert.Equal(t, message{OpBinary, strings.Repeat("a", 1000)}, expect(t, server.msgCh))
+	b0, payload = readFrame(t, r)
+	assert.Equal(t, byte(0xc0)|byte(OpBinary), b0)
+	payload, err = inflate(payload, 1<<10)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", 1000), string(payload))
+
+	// The close frame is echoed.
+	writeFrame(t, c, 0x80|byte(OpClose), []byte{0x03, 0xe8, 'o', 'k'}, true)
+	expectClose(t, r, CloseNormalClosure)
+	assert.Equal(t, closure{CloseNormalClosure, "ok"}, expect(t, server.closeCh))
+
+	// Violations of the protocol close the connections with the codes.
+	for _, tc := range []struct {
+		name string
+		b0   byte
+		data []byte
+		mask bool
+		code int
+	}{
+		{"unmasked", 0x80 | byte(OpText), []byte("a"), false, CloseProtocolError},
+		{"reserved opcode", 0x80 | 0x3, nil, true, CloseProtocolError},
+		{"unexpected continuation", 0x80 | byte(OpContinuation), nil, true, CloseProtocolError},
+		{"fragmented control", byte(OpPing), nil, true, CloseProtocolError},
+		{"invalid UTF-8", 0x80 | byte(OpText), []byte{0xff}, true, CloseInvalidFramePayloadData},
+		{"too big", 0x80 | byte(OpBinary), make([]byte, 1<<10+1), true, CloseMessageTooBig},
+		{"invalid close code", 0x80 | byte(OpClose), []byte{0x03, 0xed}, true, CloseProtocolError},
+	} {
+		c, r, _ := handshake(t, addr, "")
+		expect(t, server.openCh)
+		writeFrame(t, c, tc.b0, tc.data, tc.mask)
+		expectClose(t, r, tc.code)
+		assert.Equal(t, tc.code, expect(t, server.closeCh).code, tc.name)
+		_ = c.Close()
+	}
+}
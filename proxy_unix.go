@@ -0,0 +1,169 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+	"github.com/panjf2000/gnet/v2/pkg/proxyproto"
+)
+
+// defaultProxyHeaderTimeout is the maximum amount of time to receive
+// the PROXY protocol header if Options.ProxyProtocolTimeout is not set.
+const defaultProxyHeaderTimeout = 5 * time.Second
+
+// acceptsProxyProtocol reports whether the listener of network and address is in ProxyProtocol.
+func (opts *Options) acceptsProxyProtocol(network, address string) bool {
+	key := listenerKey(network, address)
+	for _, protoAddr := range opts.ProxyProtocol {
+		proto, addr, err := parseProtoAddr(protoAddr)
+		if err == nil && listenerKey(proto, addr) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// awaitProxyHeader defers opening c until its PROXY protocol header is received.
+func (el *eventloop) awaitProxyHeader(c *conn) {
+	timeout := el.engine.opts.ProxyProtocolTimeout
+	if timeout <= 0 {
+		timeout = defaultProxyHeaderTimeout
+	}
+	c.handshakeTimer.Func = c.expireProxyHeader
+	el.timers.Schedule(&c.handshakeTimer, time.Now().Add(timeout))
+}
+
+func (c *conn) expireProxyHeader() error {
+	return c.loop.rejectProxyHeader(c, errorx.ErrProxyHeaderTimeout)
+}
+
+// readProxyHeader reads from c until its PROXY protocol header is complete,
+// then it opens c with the original addresses in the header.
+func (el *eventloop) readProxyHeader(c *conn) error {
+	var (
+		hdr  *proxyproto.Header
+		size int
+	)
+	for {
+		n, err := unix.Read(c.fd, el.buffer)
+		if err != nil || n == 0 {
+			if err == unix.EAGAIN {
+				return nil
+			}
+			if n == 0 {
+				err = io.EOF
+			}
+			return el.rejectProxyHeader(c, fmt.Errorf("%w: %v", errorx.ErrInvalidProxyHeader, os.NewSyscallError("read", err)))
+		}
+		_, _ = c.inboundBuffer.Write(el.buffer[:n])
+
+		head, tail := c.inboundBuffer.Peek(-1)
+		buf := head
+		if len(tail) > 0 {
+			buf = append(append(make([]byte, 0, len(head)+len(tail)), head...), tail...)
+		}
+		hdr, size, err = proxyproto.Parse(buf)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, proxyproto.ErrIncomplete) {
+			return el.rejectProxyHeader(c, fmt.Errorf("%w: %v", errorx.ErrInvalidProxyHeader, err))
+		}
+	}
+
+	_, _ = c.inboundBuffer.Discard(size)
+	el.timers.Stop(&c.handshakeTimer)
+	c.proxyPending = false
+	c.proxyHeader = hdr
+	if hdr.Command == proxyproto.Proxy {
+		c.remoteAddr, c.localAddr = hdr.Source, hdr.Destination
+	}
+	if c.transformPending {
+		// The data that follows the header belongs to the stream transform.
+		el.awaitTransform(c)
+		return el.readTransformHeader(c)
+	}
+	return el.proceed(c)
+}
+
+// proceed opens c, or starts its TLS handshake, after the headers at the start of c
+// have been received, with the data following the headers in the inbound buffer.
+func (el *eventloop) proceed(c *conn) error {
+	if c.tls != nil {
+		// The data that follows the headers belongs to the TLS handshake.
+		if err := el.startHandshake(c); err != nil || c.tls == nil {
+			return err // c has been rejected for too many handshakes in progress
+		}
+	} else {
+		if err := el.open(c); err != nil || !c.opened {
+			return err
+		}
+		// Deliver the data that follows the headers.
+		if !c.inboundBuffer.IsEmpty() && !c.isReadPaused() {
+			if err := el.wake(c); err != nil || !c.opened {
+				return err
+			}
+		}
+	}
+	// The rest of data in the socket won't be notified again in edge-triggered mode.
+	if el.engine.opts.EdgeTriggeredIO {
+		return el.read(c)
+	}
+	return nil
+}
+
+// rejectProxyHeader closes c which fails to send a valid PROXY protocol header in time.
+func (el *eventloop) rejectProxyHeader(c *conn, err error) error {
+	a := &el.engine.admission
+	a.mu.Lock()
+	a.stats.RejectedByProxyProtocol++
+	a.mu.Unlock()
+
+	remoteAddr := c.remoteAddr
+	e := el.abort(c)
+	el.engine.onReject(remoteAddr, err)
+	return e
+}
+
+// abort closes c which has been registered but not opened yet, OnClose doesn't fire for it.
+func (el *eventloop) abort(c *conn) error {
+	el.connections.delConn(c)
+	el.delConnId(c)
+	el.timers.Stop(&c.handshakeTimer)
+	c.proxyPending = false
+	c.transformPending = false
+	err0, err1 := el.poller.Delete(c.fd), unix.Close(c.fd)
+	c.release()
+	if err0 != nil {
+		return fmt.Errorf("failed to delete fd=%d from poller in event-loop(%d): %v",
+			c.fd, el.idx, os.NewSyscallError("delete", err0))
+	}
+	if err1 != nil {
+		return fmt.Errorf("failed to close fd=%d in event-loop(%d): %v",
+			c.fd, el.idx, os.NewSyscallError("close", err1))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+	"github.com/panjf2000/gnet/v2/pkg/proxyproto"
+)
+
+func TestProxyProtocol(t *testing.T) {
+	t.Run("lt", func(t *testing.T) {
+		testProxyProtocol(t)
+	})
+	t.Run("et", func(t *testing.T) {
+		testProxyProtocol(t, WithEdgeTriggeredIO(true))
+	})
+}
+
+func testProxyProtocol(t *testing.T, opts ...Option) {
+	s := &testProxyServer{
+		openCh:   make(chan Conn, 1),
+		rejectCh: make(chan error, 1),
+	}
+	// The listener is bound to port 0, which is the address it's keyed by.
+	addr := runTestServer(t, s, "tcp", append(opts, WithProxyProtocol(300*time.Millisecond, "tcp://127.0.0.1:0"))...)
+
+	expectOpen := func() Conn {
+		select {
+		case c := <-s.openCh:
+			return c
+		case <-time.After(time.Second):
+			require.FailNow(t, "OnOpen is not fired")
+		}
+		return nil
+	}
+	expectReject := func(c net.Conn, expectedErr error) {
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err := c.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+		select {
+		case err = <-s.rejectCh:
+			assert.ErrorIs(t, err, expectedErr)
+		case <-time.After(time.Second):
+			require.FailNow(t, "OnReject is not fired")
+		}
+	}
+
+	// The data following the header is delivered, even if the header is split.
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Write([]byte("PROXY TCP4 192.168.0.1 "))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = c.Write([]byte("10.0.0.1 56324 443\r\nping"))
+	require.NoError(t, err)
+	expectRead(t, c, "ping")
+	gc := expectOpen()
+	assert.Equal(t, "192.168.0.1:56324", gc.RemoteAddr().String())
+	assert.Equal(t, "10.0.0.1:443", gc.LocalAddr().String())
+	assert.Equal(t, 1, gc.ProxyHeader().Version)
+	echoConn(t, c)
+
+	// A LOCAL header keeps the addresses of the connection.
+	c, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Write([]byte("PROXY UNKNOWN\r\n"))
+	require.NoError(t, err)
+	gc = expectOpen()
+	assert.Equal(t, c.LocalAddr().String(), gc.RemoteAddr().String())
+	echoConn(t, c)
+
+	// The client sends a version 2 header with TLVs.
+	cli, err := NewClient(&BuiltinEventEngine{})
+	require.NoError(t, err)
+	require.NoError(t, cli.Start())
+	defer cli.Stop() //nolint:errcheck
+	hdr := &proxyproto.Header{
+		Version: 2,
+		Command: proxyproto.Proxy,
+		Source:  &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234},
+		TLVs:    []proxyproto.TLV{{Type: proxyproto.TypeAuthority, Value: []byte("example.com")}},
+	}
+	cc, err := cli.DialProxy("tcp", addr, hdr)
+	require.NoError(t, err)
+	gc = expectOpen()
+	assert.Equal(t, "[2001:db8::1]:1234", gc.RemoteAddr().String())
+	assert.Equal(t, cc.RemoteAddr().String(), gc.LocalAddr().String())
+	authority, ok := gc.ProxyHeader().TLV(proxyproto.TypeAuthority)
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", string(authority))
+	require.NoError(t, cc.Close())
+
+	// Malformed and missing headers are rejected.
+	c, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Write([]byte("GET / HTTP/1.1\r\n"))
+	require.NoError(t, err)
+	expectReject(c, errorx.ErrInvalidProxyHeader)
+
+	c, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	expectReject(c, errorx.ErrProxyHeaderTimeout)
+	assert.EqualValues(t, 2, s.eng.AdmissionStats().RejectedByProxyProtocol)
+	select {
+	case <-s.openCh:
+		require.FailNow(t, "OnOpen fired for the rejected connection")
+	default:
+	}
+}
+
+type testProxyServer struct {
+	testBaseServer
+	openCh   chan Conn
+	rejectCh chan error
+}
+
+func (s *testProxyServer) OnOpen(c Conn) (out []byte, action Action) {
+	s.openCh <- c
+	return
+}
+
+func (s *testProxyServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testProxyServer) OnReject(_ net.Addr, err error) {
+	s.rejectCh <- err
+}
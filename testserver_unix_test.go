@@ -0,0 +1,185 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/panjf2000/gnet/v2/internal/socket"
+)
+
+// testBaseServer is embedded by the test servers, it keeps the engine that it runs
+// and tells the test when the engine has booted, see runTestServer.
+type testBaseServer struct {
+	*BuiltinEventEngine
+	eng    Engine
+	booted chan struct{}
+	errCh  chan error // receives the error returned by Run
+}
+
+func (s *testBaseServer) OnBoot(eng Engine) (action Action) {
+	s.eng = eng
+	close(s.booted)
+	return
+}
+
+func (s *testBaseServer) server() *testBaseServer {
+	return s
+}
+
+// stop stops the engine and checks that it shuts down without errors.
+func (s *testBaseServer) stop(t *testing.T) {
+	require.NoError(t, s.eng.Stop(context.Background()))
+	require.NoError(t, <-s.errCh)
+}
+
+// addr returns the address that the listener of network listens on.
+func (s *testBaseServer) addr(network string) string {
+	eng := s.eng.eng
+	eng.lnMu.RLock()
+	defer eng.lnMu.RUnlock()
+	for _, ln := range eng.listeners {
+		if ln.network != network {
+			continue
+		}
+		if network == "unix" {
+			return ln.address
+		}
+		// The port is picked by the system if the address has port 0.
+		sa, err := unix.Getsockname(ln.fd)
+		if err != nil {
+			return ln.addr.String()
+		}
+		return socket.SockaddrToTCPOrUnixAddr(sa).String()
+	}
+	return ""
+}
+
+// testHandler is an EventHandler that embeds testBaseServer.
+type testHandler interface {
+	EventHandler
+	server() *testBaseServer
+}
+
+// runTestServer runs h on port 0 of the loopback address, or on a socket in a temporary
+// directory for unix, and returns the address that the engine listens on once it boots.
+// The engine is stopped at the end of the test if it's still running.
+func runTestServer(t *testing.T, h testHandler, network string, opts ...Option) string {
+	var addr string
+	switch {
+	case network == "unix":
+		addr = sockPath(t)
+	case loadOptions(opts...).ReusePort:
+		// Each event-loop binds its own listener, which would get its own port from port 0.
+		addr = freeAddr(t, network)
+	default:
+		addr = "127.0.0.1:0"
+	}
+	startTestServer(t, h, []string{network + "://" + addr}, opts...)
+	return h.server().addr(network)
+}
+
+// startTestServer runs h on protoAddrs and waits for it to boot,
+// the engine is stopped at the end of the test if it's still running.
+func startTestServer(t *testing.T, h testHandler, protoAddrs []string, opts ...Option) {
+	s := h.server()
+	s.booted, s.errCh = make(chan struct{}), make(chan error, 1)
+	go func() {
+		s.errCh <- Rotate(h, protoAddrs, append(opts, WithReuseAddr(true))...)
+	}()
+	s.waitForStart(t, protoAddrs[0])
+	t.Cleanup(func() {
+		if s.eng.Validate() == nil {
+			s.stop(t)
+		}
+	})
+}
+
+// waitForStart waits for the engine to start serving protoAddr, it fails the test if the engine exits in advance.
+// OnBoot fires before the event-loops start, so the engine is registered with protoAddr after they have started,
+// which makes the event-loops safe to be accessed by the test afterwards.
+func (s *testBaseServer) waitForStart(t *testing.T, protoAddr string) {
+	select {
+	case <-s.booted:
+	case err := <-s.errCh:
+		require.FailNow(t, "engine exited before booting", "error: %v", err)
+	}
+	require.Eventually(t, func() bool {
+		v, ok := allEngines.Load(protoAddr)
+		return ok && v.(*engine) == s.eng.eng
+	}, 5*time.Second, time.Millisecond, "engine didn't start")
+}
+
+// sockPath returns the path of a unix socket in a temporary directory that is removed at the end of the test,
+// the path is in lower case since the protocol addresses are lowercased, which t.TempDir isn't.
+func sockPath(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "gnet")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return filepath.Join(dir, "gnet.sock")
+}
+
+// freeAddr returns an address of the loopback interface with a port that is free for network at present,
+// for the listeners that can't be bound to port 0, e.g. the ones bound by each event-loop.
+func freeAddr(t *testing.T, network string) string {
+	if strings.HasPrefix(network, "udp") {
+		pc, err := net.ListenPacket(network, "127.0.0.1:0")
+		require.NoError(t, err)
+		defer pc.Close()
+		return pc.LocalAddr().String()
+	}
+	ln, err := net.Listen(network, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// echoOver dials addr and checks that the data sent over the connection is echoed.
+func echoOver(t *testing.T, network, addr string) {
+	c, err := net.Dial(network, addr)
+	require.NoError(t, err)
+	defer c.Close()
+	echoConn(t, c)
+}
+
+// echoConn checks that the data sent over c is echoed.
+func echoConn(t *testing.T, c net.Conn) {
+	require.NoError(t, c.SetDeadline(time.Now().Add(time.Second)))
+	_, err := c.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
+
+func expectRead(t *testing.T, c net.Conn, expected string) {
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, len(expected))
+	_, err := io.ReadFull(c, buf)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(buf))
+}
+
+// testEchoServer echoes the data it receives.
+type testEchoServer struct {
+	testBaseServer
+}
+
+func (s *testEchoServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	_, _ = c.Write(buf)
+	return
+}
@@ -0,0 +1,376 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/panjf2000/gnet/v2/internal/queue"
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+const (
+	// defaultTLSHandshakeTimeout is the maximum amount of time to complete
+	// the TLS handshake if Options.TLSHandshakeTimeout is not set.
+	defaultTLSHandshakeTimeout = 10 * time.Second
+
+	// defaultMaxTLSHandshakesPerLoop is the maximum number of TLS handshakes in progress
+	// on an event-loop if Options.MaxTLSHandshakesPerLoop is not set.
+	defaultMaxTLSHandshakesPerLoop = 1024
+)
+
+// tlsTransport is the net.Conn underlying the tls.Conn of a connection.
+//
+// The handshake runs in a separate goroutine with blocking reads on the records
+// fed by the event-loop, and the records written by it are sent on the event-loop.
+// crypto/tls can't drive the handshake as a state machine: an error returned by
+// the underlying reads fails the handshake for good, and the only event-driven API
+// is the one of QUIC, which hands over handshake messages rather than records.
+// So the goroutine blocks in place of the event-loop, only until the handshake
+// completes or the connection is closed, e.g. by the handshake timeout. The number
+// of these goroutines is bounded by Options.MaxTLSHandshakesPerLoop on each event-loop.
+//
+// Once the handshake completes, both reads and writes happen on the event-loop and
+// never block: reads fail with os.ErrDeadlineExceeded when all records have been
+// consumed, as if the read deadline had passed, which tls.Conn recovers from as
+// documented by tls.Conn.SetReadDeadline, keeping the partial records for the next
+// read, and writes go to the connection directly. A failure of the socket is recorded
+// in err rather than closing the connection, since tls.Conn holds its locks meanwhile,
+// which closing the connection takes again to send the close_notify alert.
+type tlsTransport struct {
+	c          *conn
+	localAddr  net.Addr
+	remoteAddr net.Addr
+
+	mu       sync.Mutex
+	cond     sync.Cond
+	in       bytes.Buffer // records received from the remote
+	out      []byte       // records written by the handshake, waiting to be sent
+	blocking bool         // whether the handshake is in progress
+	closed   bool
+	err      error // failure of the socket after the handshake, only accessed on the event-loop
+}
+
+func (t *tlsTransport) Read(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.in.Len() == 0 {
+		if t.closed {
+			return 0, net.ErrClosed
+		}
+		if !t.blocking {
+			return 0, os.ErrDeadlineExceeded
+		}
+		t.cond.Wait()
+	}
+	return t.in.Read(p)
+}
+
+func (t *tlsTransport) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return 0, net.ErrClosed
+	}
+	if !t.blocking {
+		t.mu.Unlock()
+		if t.err != nil {
+			return 0, t.err
+		}
+		n, fatal, err := t.c.transmit(p)
+		if fatal {
+			t.err = err
+		}
+		return n, err
+	}
+	t.out = append(t.out, p...)
+	t.mu.Unlock()
+	if err := t.c.loop.poller.Trigger(queue.HighPriority, t.c.loop.flushHandshake, t); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// feed appends the records received from the remote.
+func (t *tlsTransport) feed(p []byte) {
+	t.mu.Lock()
+	_, _ = t.in.Write(p)
+	t.cond.Signal()
+	t.mu.Unlock()
+}
+
+// take returns the records written by the handshake.
+func (t *tlsTransport) take() (out []byte, closed bool) {
+	t.mu.Lock()
+	out, t.out = t.out, nil
+	closed = t.closed
+	t.mu.Unlock()
+	return
+}
+
+func (t *tlsTransport) setBlocking(blocking bool) {
+	t.mu.Lock()
+	t.blocking = blocking
+	t.mu.Unlock()
+}
+
+func (t *tlsTransport) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+func (t *tlsTransport) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	t.in.Reset()
+	t.out = nil
+	t.cond.Broadcast()
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *tlsTransport) LocalAddr() net.Addr                { return t.localAddr }
+func (t *tlsTransport) RemoteAddr() net.Addr               { return t.remoteAddr }
+func (t *tlsTransport) SetDeadline(_ time.Time) error      { return nil }
+func (t *tlsTransport) SetReadDeadline(_ time.Time) error  { return nil }
+func (t *tlsTransport) SetWriteDeadline(_ time.Time) error { return nil }
+
+// tlsSession is the TLS state of a connection.
+type tlsSession struct {
+	conn        *tls.Conn
+	transport   tlsTransport
+	established bool          // whether the handshake has completed successfully
+	finished    bool          // whether the handshake has finished
+	err         error         // error of the handshake
+	done        chan struct{} // closed when the handshake has finished
+}
+
+func newTLSSession(c *conn, config *tls.Config, isClient bool) *tlsSession {
+	s := &tlsSession{done: make(chan struct{})}
+	s.transport.c = c
+	s.transport.blocking = true
+	s.transport.cond.L = &s.transport.mu
+	if isClient {
+		s.conn = tls.Client(&s.transport, config)
+	} else {
+		s.conn = tls.Server(&s.transport, config)
+	}
+	return s
+}
+
+// finish marks the handshake as finished with err.
+func (s *tlsSession) finish(err error) {
+	if s.finished {
+		return
+	}
+	s.finished = true
+	s.established = err == nil
+	s.err = err
+	close(s.done)
+}
+
+// close stops the session of the connection that is being closed.
+func (s *tlsSession) close() {
+	s.finish(net.ErrClosed)
+	_ = s.transport.Close()
+}
+
+// SetTLSConfig replaces Options.TLSConfig atomically, which takes effect on the connections
+// accepted or dialed afterwards, the established TLS sessions are not affected. Passing nil
+// disables TLS for the new connections.
+func (e Engine) SetTLSConfig(config *tls.Config) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	e.eng.tlsConfig.Store(config)
+	return nil
+}
+
+// writeTLS encrypts data into records and sends them, c is closed after tls.Conn.Write
+// returns if the records fail to be sent.
+func (c *conn) writeTLS(data []byte) (int, error) {
+	n, err := c.tls.conn.Write(data)
+	if e := c.tls.transport.err; e != nil {
+		c.closeOnWriteError(e)
+		return 0, e
+	}
+	return n, err
+}
+
+// handshaking reports whether c is waiting for the TLS handshake to complete.
+func (c *conn) handshaking() bool {
+	return c.tls != nil && !c.tls.established
+}
+
+// startHandshake runs the TLS handshake of c in a separate goroutine, c is opened when it completes.
+// c is rejected if there are already Options.MaxTLSHandshakesPerLoop handshakes in progress on el.
+func (el *eventloop) startHandshake(c *conn) error {
+	limit := el.engine.opts.MaxTLSHandshakesPerLoop
+	if limit <= 0 {
+		limit = defaultMaxTLSHandshakesPerLoop
+	}
+	// Only the event-loop starts handshakes, so the count can't exceed the limit.
+	if int(atomic.LoadInt32(&el.handshakes)) >= limit {
+		return el.rejectTLSHandshake(c, errorx.ErrTooManyTLSHandshakes)
+	}
+
+	timeout := el.engine.opts.TLSHandshakeTimeout
+	if timeout <= 0 {
+		timeout = defaultTLSHandshakeTimeout
+	}
+	c.handshakeTimer.Func = c.expireTLSHandshake
+	el.timers.Schedule(&c.handshakeTimer, time.Now().Add(timeout))
+
+	s := c.tls
+	s.transport.localAddr, s.transport.remoteAddr = c.localAddr, c.remoteAddr
+	// Hand over the data that has been read ahead, e.g. the data following the PROXY protocol header.
+	_, _ = c.inboundBuffer.WriteTo(&s.transport.in)
+	atomic.AddInt32(&el.handshakes, 1)
+	el.engine.admission.handshakes.Add(1)
+	go func() {
+		err := s.conn.Handshake()
+		atomic.AddInt32(&el.handshakes, -1)
+		el.engine.admission.handshakes.Add(-1)
+		_ = el.poller.Trigger(queue.HighPriority, func(_ any) error {
+			return el.finishHandshake(c, s, err)
+		}, nil)
+	}()
+	return nil
+}
+
+func (c *conn) expireTLSHandshake() error {
+	return c.loop.rejectTLSHandshake(c, errorx.ErrTLSHandshakeTimeout)
+}
+
+// flushHandshake sends the records written by the handshake of the tlsTransport.
+func (el *eventloop) flushHandshake(a any) error {
+	t := a.(*tlsTransport)
+	out, closed := t.take()
+	if closed || len(out) == 0 {
+		return nil
+	}
+	_, _ = t.c.send(out)
+	return nil
+}
+
+// readHandshake feeds the records read from c to its TLS handshake.
+func (el *eventloop) readHandshake(c *conn) error {
+	for {
+		n, err := unix.Read(c.fd, el.buffer)
+		if err != nil || n == 0 {
+			if err == unix.EAGAIN {
+				return nil
+			}
+			if n == 0 {
+				err = io.EOF
+			}
+			return el.rejectTLSHandshake(c, fmt.Errorf("%w: %v", errorx.ErrTLSHandshake, os.NewSyscallError("read", err)))
+		}
+		if c.transform != nil {
+			c.transform.Inbound(el.buffer[:n])
+		}
+		c.tls.transport.feed(el.buffer[:n])
+	}
+}
+
+// finishHandshake opens c after the handshake of session s completes with err.
+func (el *eventloop) finishHandshake(c *conn, s *tlsSession, err error) error {
+	if c.tls != s || s.transport.isClosed() {
+		return nil // the connection has been closed
+	}
+	if err != nil {
+		return el.rejectTLSHandshake(c, fmt.Errorf("%w: %v", errorx.ErrTLSHandshake, err))
+	}
+
+	el.timers.Stop(&c.handshakeTimer)
+	s.transport.setBlocking(false)
+	s.finish(nil)
+	if err = el.open(c); err != nil || !c.opened {
+		return err
+	}
+	// Decrypt the records that have arrived along with the end of the handshake.
+	return el.decrypt(c)
+}
+
+// decrypt hands the plaintext of the records received on c over to OnTraffic.
+func (el *eventloop) decrypt(c *conn) error {
+	defer el.recoverPanic(c)
+
+	for !c.isReadPaused() {
+		n, err := c.tls.conn.Read(el.buffer)
+		// Reading may write records, e.g. the response to a key update.
+		if e := c.tls.transport.err; e != nil {
+			return el.close(c, e)
+		}
+		if n > 0 {
+			c.buffer = el.buffer[:n]
+			action := el.eventHandler.OnTraffic(c)
+			switch action {
+			case None:
+			case Close:
+				return el.close(c, nil)
+			case Shutdown:
+				return errorx.ErrEngineShutdown
+			}
+			if !c.opened {
+				return nil // closed by a failed write in OnTraffic
+			}
+			_, _ = c.inboundBuffer.Write(c.buffer)
+			c.buffer = c.buffer[:0]
+		}
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil // all records have been consumed
+			}
+			return el.close(c, err)
+		}
+	}
+	return nil
+}
+
+// rejectTLSHandshake closes c whose TLS handshake fails with err.
+func (el *eventloop) rejectTLSHandshake(c *conn, err error) error {
+	a := &el.engine.admission
+	a.mu.Lock()
+	if err == errorx.ErrTooManyTLSHandshakes {
+		a.stats.RejectedByTLSHandshakeLimit++
+	} else {
+		a.stats.RejectedByTLSHandshake++
+	}
+	a.mu.Unlock()
+
+	// Send the alert of the failure to the remote as much as possible.
+	c.writeResidual()
+	c.tls.finish(err)
+	remoteAddr := c.remoteAddr
+	e := el.abort(c)
+	el.engine.onReject(remoteAddr, err)
+	return e
+}
@@ -0,0 +1,370 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/panjf2000/gnet/v2/pkg/certstore"
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// newTestCert returns a self-signed certificate of cn for dnsNames and 127.0.0.1.
+func newTestCert(t *testing.T, cn string, dnsNames ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              dnsNames,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(crand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// newTestTLSConfigs returns the TLS configurations of a server with
+// a self-signed certificate for 127.0.0.1 and a client trusting it.
+func newTestTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	cert := newTestCert(t, "gnet")
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	server = &tls.Config{Certificates: []tls.Certificate{cert}}
+	client = &tls.Config{RootCAs: pool}
+	return
+}
+
+func TestTLS(t *testing.T) {
+	t.Run("lt", func(t *testing.T) {
+		testTLS(t)
+	})
+	t.Run("et", func(t *testing.T) {
+		testTLS(t, WithEdgeTriggeredIO(true))
+	})
+}
+
+func testTLS(t *testing.T, opts ...Option) {
+	serverConfig, clientConfig := newTestTLSConfigs(t)
+	s := &testProxyServer{
+		openCh:   make(chan Conn, 1),
+		rejectCh: make(chan error, 1),
+	}
+	addr := runTestServer(t, s, "tcp", append(opts, WithTLSConfig(serverConfig),
+		WithTLSHandshakeTimeout(300*time.Millisecond))...)
+
+	expectReject := func(c net.Conn, expectedErr error) {
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+		_, _ = io.Copy(io.Discard, c) // the alert may be sent before EOF
+		select {
+		case err := <-s.rejectCh:
+			assert.ErrorIs(t, err, expectedErr)
+		case <-time.After(time.Second):
+			require.FailNow(t, "OnReject is not fired")
+		}
+	}
+
+	// OnOpen fires after the handshake and OnTraffic sees the plaintext.
+	c, err := tls.Dial("tcp", addr, clientConfig)
+	require.NoError(t, err)
+	defer c.Close()
+	select {
+	case <-s.openCh:
+	case <-time.After(time.Second):
+		require.FailNow(t, "OnOpen is not fired")
+	}
+	echoConn(t, c)
+
+	// A large payload spans multiple records.
+	data := make([]byte, 1<<20)
+	_, err = crand.Read(data)
+	require.NoError(t, err)
+	go func() {
+		_, _ = c.Write(data)
+	}()
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, len(data))
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, buf))
+
+	// The client of gnet runs the handshake before Dial returns.
+	ch := &testTLSClient{trafficCh: make(chan []byte, 1)}
+	cli, err := NewClient(ch, WithTLSConfig(clientConfig))
+	require.NoError(t, err)
+	require.NoError(t, cli.Start())
+	defer cli.Stop() //nolint:errcheck
+	cc, err := cli.Dial("tcp", addr)
+	require.NoError(t, err)
+	<-s.openCh
+	_, err = cc.Write([]byte("ping"))
+	require.NoError(t, err)
+	select {
+	case b := <-ch.trafficCh:
+		assert.Equal(t, "ping", string(b))
+	case <-time.After(time.Second):
+		require.FailNow(t, "no data is echoed to the client")
+	}
+	require.NoError(t, cc.Close())
+
+	// Dial fails if the server can't be verified.
+	cli, err = NewClient(ch, WithTLSConfig(&tls.Config{}))
+	require.NoError(t, err)
+	require.NoError(t, cli.Start())
+	defer cli.Stop() //nolint:errcheck
+	_, err = cli.Dial("tcp", addr)
+	assert.ErrorIs(t, err, errorx.ErrTLSHandshake)
+	select {
+	case err = <-s.rejectCh:
+		assert.ErrorIs(t, err, errorx.ErrTLSHandshake)
+	case <-time.After(time.Second):
+		require.FailNow(t, "OnReject is not fired")
+	}
+
+	// Failed and incomplete handshakes are rejected.
+	pc, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer pc.Close()
+	_, err = pc.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	expectReject(pc, errorx.ErrTLSHandshake)
+
+	pc, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer pc.Close()
+	expectReject(pc, errorx.ErrTLSHandshakeTimeout)
+	assert.EqualValues(t, 3, s.eng.AdmissionStats().RejectedByTLSHandshake)
+	select {
+	case <-s.openCh:
+		require.FailNow(t, "OnOpen fired for the rejected connection")
+	default:
+	}
+}
+
+func TestTLSHandshakeLimit(t *testing.T) {
+	serverConfig, clientConfig := newTestTLSConfigs(t)
+	s := &testProxyServer{
+		openCh:   make(chan Conn, 1),
+		rejectCh: make(chan error, 3),
+	}
+	addr := runTestServer(t, s, "tcp", WithNumEventLoop(1), WithTLSConfig(serverConfig), WithTLSHandshakeTimeout(300*time.Millisecond), WithMaxTLSHandshakesPerLoop(2))
+
+	// The stalled clients send a partial record and hold the handshakes in progress.
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer c.Close() //nolint:gocritic
+		_, err = c.Write([]byte{0x16, 0x03, 0x01})
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool {
+		return s.eng.AdmissionStats().TLSHandshakes == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// The connection beyond the limit is closed before the handshake.
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = c.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	assert.ErrorIs(t, <-s.rejectCh, errorx.ErrTooManyTLSHandshakes)
+
+	// The goroutines of the stalled handshakes exit at the handshake timeout.
+	for i := 0; i < 2; i++ {
+		select {
+		case err = <-s.rejectCh:
+			assert.ErrorIs(t, err, errorx.ErrTLSHandshakeTimeout)
+		case <-time.After(time.Second):
+			require.FailNow(t, "the stalled handshake doesn't time out")
+		}
+	}
+	require.Eventually(t, func() bool {
+		return s.eng.AdmissionStats().TLSHandshakes == 0
+	}, time.Second, 10*time.Millisecond)
+	stats := s.eng.AdmissionStats()
+	assert.EqualValues(t, 1, stats.RejectedByTLSHandshakeLimit)
+	assert.EqualValues(t, 2, stats.RejectedByTLSHandshake)
+
+	// The handshakes are accepted again.
+	tc, err := tls.Dial("tcp", addr, clientConfig)
+	require.NoError(t, err)
+	defer tc.Close()
+	<-s.openCh
+	echoConn(t, tc)
+}
+
+type testTLSClient struct {
+	*BuiltinEventEngine
+	trafficCh chan []byte
+}
+
+func (c *testTLSClient) OnTraffic(conn Conn) (action Action) {
+	buf, _ := conn.Next(-1)
+	c.trafficCh <- append([]byte(nil), buf...)
+	return
+}
+
+// testTLSResetServer writes to the connection after the remote has reset it.
+type testTLSResetServer struct {
+	testBaseServer
+	resetCh  chan struct{} // the remote has sent the request and gets reset by the test
+	writeErr chan error
+	closeCh  chan error
+}
+
+func (s *testTLSResetServer) OnTraffic(c Conn) (action Action) {
+	_, _ = c.Next(-1)
+	s.resetCh <- struct{}{}
+	<-s.resetCh
+	_, err := c.Write(make([]byte, 1<<10))
+	s.writeErr <- err
+	return
+}
+
+func (s *testTLSResetServer) OnClose(_ Conn, err error) (action Action) {
+	s.closeCh <- err
+	return
+}
+
+func TestTLSResetDuringWrite(t *testing.T) {
+	serverConfig, clientConfig := newTestTLSConfigs(t)
+	s := &testTLSResetServer{
+		resetCh:  make(chan struct{}),
+		writeErr: make(chan error, 1),
+		closeCh:  make(chan error, 1),
+	}
+	addr := runTestServer(t, s, "tcp", WithTLSConfig(serverConfig))
+
+	c, err := tls.Dial("tcp", addr, clientConfig)
+	require.NoError(t, err)
+	_, err = c.Write([]byte("ping"))
+	require.NoError(t, err)
+	select {
+	case <-s.resetCh:
+	case <-time.After(time.Second):
+		require.FailNow(t, "OnTraffic is not fired")
+	}
+	// Reset the connection, then let the server write to it.
+	require.NoError(t, c.NetConn().(*net.TCPConn).SetLinger(0))
+	require.NoError(t, c.NetConn().Close())
+	time.Sleep(50 * time.Millisecond)
+	s.resetCh <- struct{}{}
+
+	select {
+	case err = <-s.writeErr:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "the write is blocked")
+	}
+	select {
+	case err = <-s.closeCh:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "OnClose is not fired")
+	}
+}
+
+func TestTLSCertificates(t *testing.T) {
+	certA := newTestCert(t, "a", "a.example.com")
+	certB := newTestCert(t, "b", "*.b.example.com")
+	certC := newTestCert(t, "c", "a.example.com")
+	clientCert := newTestCert(t, "client")
+	roots := x509.NewCertPool()
+	for _, cert := range []tls.Certificate{certA, certB, certC} {
+		roots.AddCert(cert.Leaf)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert.Leaf)
+
+	store := certstore.New()
+	require.NoError(t, store.Set(certA, certB))
+	serverConfig := store.Config(&tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs})
+	s := &testProxyServer{
+		openCh:   make(chan Conn, 1),
+		rejectCh: make(chan error, 1),
+	}
+	addr := runTestServer(t, s, "tcp", WithTLSConfig(serverConfig))
+
+	// dial connects with SNI of serverName and returns the common names of both sides.
+	dial := func(serverName string) (server, client string) {
+		c, err := tls.Dial("tcp", addr, &tls.Config{
+			ServerName:   serverName,
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{clientCert},
+		})
+		require.NoError(t, err)
+		defer c.Close()
+		echoConn(t, c)
+		select {
+		case gc := <-s.openCh:
+			// Read the state on the event-loop.
+			stateCh := make(chan tls.ConnectionState, 1)
+			s.eng.Trigger(gc.ConnId(), func(gc Conn) {
+				state, ok := gc.TLSConnectionState()
+				assert.True(t, ok)
+				stateCh <- state
+			})
+			state := <-stateCh
+			require.Len(t, state.PeerCertificates, 1)
+			client = state.PeerCertificates[0].Subject.CommonName
+		case <-time.After(time.Second):
+			require.FailNow(t, "OnOpen is not fired")
+		}
+		return c.ConnectionState().PeerCertificates[0].Subject.CommonName, client
+	}
+
+	// The certificate is selected by SNI, and the client certificate is exposed on Conn.
+	server, client := dial("a.example.com")
+	assert.Equal(t, "a", server)
+	assert.Equal(t, "client", client)
+	server, _ = dial("x.b.example.com")
+	assert.Equal(t, "b", server)
+
+	// The certificates are rotated without restarting the engine.
+	require.NoError(t, store.Set(certC))
+	server, _ = dial("a.example.com")
+	assert.Equal(t, "c", server)
+
+	// So is the whole configuration, the clients without certificates are rejected now.
+	require.NoError(t, s.eng.SetTLSConfig(store.Config(&tls.Config{ClientAuth: tls.RequireAnyClientCert})))
+	server, _ = dial("a.example.com")
+	assert.Equal(t, "c", server)
+	c, err := tls.Dial("tcp", addr, &tls.Config{ServerName: "a.example.com", RootCAs: roots})
+	if err == nil {
+		// The client of TLS 1.3 finds the failure after the handshake.
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err = c.Read(make([]byte, 1))
+		_ = c.Close()
+	}
+	assert.Error(t, err)
+	select {
+	case err = <-s.rejectCh:
+		assert.ErrorIs(t, err, errorx.ErrTLSHandshake)
+	case <-time.After(time.Second):
+		require.FailNow(t, "OnReject is not fired")
+	}
+}
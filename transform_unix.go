@@ -0,0 +1,103 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// defaultStreamTransformTimeout is the maximum amount of time to receive
+// the header of the stream transform if Options.StreamTransformTimeout is not set.
+const defaultStreamTransformTimeout = 5 * time.Second
+
+// awaitTransform defers opening c until the header of its stream transform is received.
+func (el *eventloop) awaitTransform(c *conn) {
+	timeout := el.engine.opts.StreamTransformTimeout
+	if timeout <= 0 {
+		timeout = defaultStreamTransformTimeout
+	}
+	c.handshakeTimer.Func = c.expireTransform
+	el.timers.Schedule(&c.handshakeTimer, time.Now().Add(timeout))
+}
+
+func (c *conn) expireTransform() error {
+	return c.loop.rejectTransform(c, errorx.ErrStreamTransformTimeout)
+}
+
+// readTransformHeader reads from c until the header of its stream transform is complete,
+// then it transforms the data following the header in place and proceeds with c.
+func (el *eventloop) readTransformHeader(c *conn) error {
+	var size int
+	for {
+		// The data following the PROXY protocol header may have brought the header already.
+		if !c.inboundBuffer.IsEmpty() {
+			head, tail := c.inboundBuffer.Peek(-1)
+			buf := head
+			if len(tail) > 0 {
+				buf = append(append(make([]byte, 0, len(head)+len(tail)), head...), tail...)
+			}
+			n, err := c.transform.Init(buf)
+			if err != nil {
+				return el.rejectTransform(c, fmt.Errorf("%w: %v", errorx.ErrStreamTransform, err))
+			}
+			if size = n; size > 0 {
+				break
+			}
+		}
+
+		n, err := unix.Read(c.fd, el.buffer)
+		if err != nil || n == 0 {
+			if err == unix.EAGAIN {
+				return nil
+			}
+			if n == 0 {
+				err = io.EOF
+			}
+			return el.rejectTransform(c, fmt.Errorf("%w: %v", errorx.ErrStreamTransform, os.NewSyscallError("read", err)))
+		}
+		_, _ = c.inboundBuffer.Write(el.buffer[:n])
+	}
+
+	_, _ = c.inboundBuffer.Discard(size)
+	el.timers.Stop(&c.handshakeTimer)
+	c.transformPending = false
+	head, tail := c.inboundBuffer.Peek(-1)
+	c.transform.Inbound(head)
+	c.transform.Inbound(tail)
+	return el.proceed(c)
+}
+
+// rejectTransform closes c which fails to send a valid header of the stream transform in time.
+func (el *eventloop) rejectTransform(c *conn, err error) error {
+	a := &el.engine.admission
+	a.mu.Lock()
+	a.stats.RejectedByStreamTransform++
+	a.mu.Unlock()
+
+	remoteAddr := c.remoteAddr
+	e := el.abort(c)
+	el.engine.onReject(remoteAddr, err)
+	return e
+}
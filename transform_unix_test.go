@@ -0,0 +1,185 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// xorTransform is a StreamTransform that XORs each byte with a counter starting from
+// the key in its header, so that the bytes transformed out of order are corrupted.
+type xorTransform struct {
+	in, out byte
+}
+
+func (t *xorTransform) Init(data []byte) (int, error) {
+	if data[0] != 'X' {
+		return 0, errors.New("invalid magic")
+	}
+	if len(data) < 2 {
+		return 0, nil
+	}
+	t.in, t.out = data[1], data[1]
+	return 2, nil
+}
+
+func (t *xorTransform) Inbound(b []byte) {
+	for i := range b {
+		b[i] ^= t.in
+		t.in++
+	}
+}
+
+func (t *xorTransform) Outbound(dst, src []byte) {
+	for i := range src {
+		dst[i] = src[i] ^ t.out
+		t.out++
+	}
+}
+
+// xorConn is the client side of xorTransform.
+type xorConn struct {
+	net.Conn
+	t xorTransform
+}
+
+func dialXOR(t *testing.T, addr string, key byte) *xorConn {
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_, err = c.Write([]byte{'X', key})
+	require.NoError(t, err)
+	return &xorConn{Conn: c, t: xorTransform{in: key, out: key}}
+}
+
+func (c *xorConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	c.t.Inbound(p[:n])
+	return
+}
+
+func (c *xorConn) Write(p []byte) (int, error) {
+	b := make([]byte, len(p))
+	c.t.Outbound(b, p)
+	return c.Conn.Write(b)
+}
+
+func TestStreamTransform(t *testing.T) {
+	t.Run("lt", func(t *testing.T) {
+		testStreamTransform(t)
+	})
+	t.Run("et", func(t *testing.T) {
+		testStreamTransform(t, WithEdgeTriggeredIO(true))
+	})
+}
+
+func testStreamTransform(t *testing.T, opts ...Option) {
+	s := &testProxyServer{
+		openCh:   make(chan Conn, 1),
+		rejectCh: make(chan error, 1),
+	}
+	addr := runTestServer(t, s, "tcp", append(opts, WithStreamTransform(300*time.Millisecond, func() StreamTransform {
+		return new(xorTransform)
+	}))...)
+
+	expectOpen := func() Conn {
+		select {
+		case c := <-s.openCh:
+			return c
+		case <-time.After(time.Second):
+			require.FailNow(t, "OnOpen is not fired")
+		}
+		return nil
+	}
+
+	// OnOpen fires after the header, even if it's split, and the data following it is delivered.
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Write([]byte{'X'})
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	xc := &xorConn{Conn: c, t: xorTransform{in: 0xf0, out: 0xf0}}
+	_, err = c.Write([]byte{0xf0})
+	require.NoError(t, err)
+	_, err = xc.Write([]byte("ping"))
+	require.NoError(t, err)
+	expectRead(t, xc, "ping")
+	gc := expectOpen()
+	assert.IsType(t, &xorTransform{}, gc.StreamTransform())
+	echoConn(t, xc)
+
+	// A large payload, as well as the data pushed by AsyncWrite and AsyncWritev, is transformed in order.
+	data := make([]byte, 1<<20)
+	_, err = crand.Read(data)
+	require.NoError(t, err)
+	go func() {
+		_, _ = xc.Write(data)
+	}()
+	require.NoError(t, xc.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, len(data))
+	_, err = io.ReadFull(xc, buf)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, buf))
+	require.NoError(t, s.eng.AsyncWrite(gc.ConnId(), []byte("push"), nil))
+	expectRead(t, xc, "push")
+	require.NoError(t, gc.AsyncWritev([][]byte{[]byte("pu"), []byte("sh")}, nil))
+	expectRead(t, xc, "push")
+
+	// TLS runs on top of the transform.
+	serverConfig, clientConfig := newTestTLSConfigs(t)
+	require.NoError(t, s.eng.SetTLSConfig(serverConfig))
+	xc = dialXOR(t, addr, 0x42)
+	defer xc.Close()
+	clientConfig.ServerName = "127.0.0.1"
+	tc := tls.Client(xc, clientConfig)
+	require.NoError(t, tc.SetDeadline(time.Now().Add(time.Second)))
+	require.NoError(t, tc.Handshake())
+	gc = expectOpen()
+	_, ok := gc.TLSConnectionState()
+	assert.True(t, ok)
+	echoConn(t, tc)
+	require.NoError(t, s.eng.SetTLSConfig(nil))
+
+	// Invalid and missing headers are rejected.
+	expectReject := func(c net.Conn, expectedErr error) {
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err := c.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+		select {
+		case err = <-s.rejectCh:
+			assert.ErrorIs(t, err, expectedErr)
+		case <-time.After(time.Second):
+			require.FailNow(t, "OnReject is not fired")
+		}
+	}
+	c, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Write([]byte("GET / HTTP/1.1\r\n"))
+	require.NoError(t, err)
+	expectReject(c, errorx.ErrStreamTransform)
+
+	c, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	expectReject(c, errorx.ErrStreamTransformTimeout)
+	assert.EqualValues(t, 2, s.eng.AdmissionStats().RejectedByStreamTransform)
+	select {
+	case <-s.openCh:
+		require.FailNow(t, "OnOpen fired for the rejected connection")
+	default:
+	}
+}
@@ -0,0 +1,97 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gnet
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+func TestOutboundWatermarks(t *testing.T) {
+	t.Run("writes", func(t *testing.T) {
+		testOutboundWatermarks(t, 0)
+	})
+	// A single write larger than the high watermark pauses writing until the outbound buffer drains.
+	t.Run("large-write", func(t *testing.T) {
+		testOutboundWatermarks(t, 192*1024)
+	})
+}
+
+func testOutboundWatermarks(t *testing.T, large int) {
+	s := &testWatermarkServer{
+		large:      large,
+		fullCh:     make(chan int, 1),
+		writableCh: make(chan int, 1),
+	}
+	addr := runTestServer(t, s, "tcp", WithSocketSendBuffer(8*1024), WithOutboundWatermarks(16*1024, 64*1024))
+
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.(*net.TCPConn).SetReadBuffer(8*1024))
+	_, err = c.Write([]byte("go"))
+	require.NoError(t, err)
+
+	var buffered int
+	select {
+	case buffered = <-s.fullCh:
+	case <-time.After(3 * time.Second):
+		require.FailNow(t, "high watermark is not reached")
+	}
+	assert.GreaterOrEqual(t, buffered, 64*1024)
+
+	// Drain the connection so that the outbound buffer falls below the low watermark.
+	go func() { _, _ = io.Copy(io.Discard, c) }()
+	select {
+	case buffered = <-s.writableCh:
+	case <-time.After(3 * time.Second):
+		require.FailNow(t, "OnWritable is not fired")
+	}
+	assert.LessOrEqual(t, buffered, 16*1024)
+}
+
+type testWatermarkServer struct {
+	testBaseServer
+	large      int // size of the single write, or 0 to keep writing until the writes fail
+	fullCh     chan int
+	writableCh chan int
+}
+
+func (s *testWatermarkServer) OnTraffic(c Conn) (action Action) {
+	_, _ = c.Discard(-1)
+	if s.large > 0 {
+		if _, err := c.Write(make([]byte, s.large)); err == nil {
+			s.fullCh <- c.OutboundBuffered()
+		}
+		return
+	}
+	data := make([]byte, 32*1024)
+	for i := 0; i < 1<<12; i++ {
+		if _, err := c.Write(data); err != nil {
+			if errors.Is(err, errorx.ErrOutboundBufferFull) {
+				// Writing keeps failing until the outbound buffer drains.
+				_, err = c.Writev([][]byte{data})
+				if errors.Is(err, errorx.ErrOutboundBufferFull) {
+					s.fullCh <- c.OutboundBuffered()
+				}
+			}
+			return
+		}
+	}
+	return
+}
+
+func (s *testWatermarkServer) OnWritable(c Conn) (action Action) {
+	s.writableCh <- c.OutboundBuffered()
+	_, _ = c.Write([]byte("more"))
+	return
+}